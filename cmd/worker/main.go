@@ -1,17 +1,33 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"runtime"
+	"strconv"
 	"strings"
+	"time"
+	// Workflows render template dates in WorkflowParams.TimeZone; embed the
+	// zone database so every worker renders them the same way.
+	_ "time/tzdata"
 
-	tactivity "go.temporal.io/sdk/activity"
 	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/contrib/opentelemetry"
+	"go.temporal.io/sdk/interceptor"
 	"go.temporal.io/sdk/worker"
 	"go.uber.org/zap"
 
 	"github.com/yourorg/zone-names/internal/activities"
+	"github.com/yourorg/zone-names/internal/api"
+	znclient "github.com/yourorg/zone-names/internal/client"
+	"github.com/yourorg/zone-names/internal/health"
+	"github.com/yourorg/zone-names/internal/janitor"
+	"github.com/yourorg/zone-names/internal/logging"
 	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/tracing"
 	"github.com/yourorg/zone-names/internal/workflow"
 )
 
@@ -28,32 +44,135 @@ func main() {
 	zl := newZap(getenv("LOG_LEVEL", "info"))
 	defer zl.Sync()
 
-	// Metrics server
 	znmetrics.Init()
-	go func() {
-		addr := znmetrics.AddrFromEnv()
-		_ = znmetrics.Serve(addr)
-	}()
 
-	c, err := client.Dial(client.Options{HostPort: taddr, Namespace: ns})
+	// SDK metrics are served on the same /metrics endpoint; SDK, workflow and
+	// activity logs go through zl.
+	mh, mcloser := znmetrics.TemporalHandler(func(err error) {
+		zl.Warn("temporal metric not registered", zap.Error(err))
+	})
+	defer mcloser.Close()
+
+	// Tracing: exported over OTLP when OTEL_EXPORTER_OTLP_ENDPOINT is set. The
+	// interceptor must be created after the provider is installed.
+	if tracing.Enabled() {
+		shutdown, err := tracing.Setup(context.Background(), "zone-names-worker")
+		if err != nil {
+			log.Fatal("tracing:", err)
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			_ = shutdown(ctx)
+		}()
+	}
+	tracer, err := opentelemetry.NewTracingInterceptor(opentelemetry.TracerOptions{})
+	if err != nil {
+		log.Fatal("tracing interceptor:", err)
+	}
+
+	c, err := client.Dial(client.Options{
+		HostPort:       taddr,
+		Namespace:      ns,
+		Logger:         logging.NewZapAdapter(zl),
+		MetricsHandler: mh,
+		Interceptors:   []interceptor.ClientInterceptor{tracer},
+	})
 	if err != nil {
 		log.Fatal("temporal client:", err)
 	}
 	defer c.Close()
 
-	w := worker.New(c, q, worker.Options{})
-	acts := activities.New(activities.Config{ScratchDir: tmpDir})
+	// Metrics, health, readiness and (with PPROF=1) pprof on METRICS_ADDR.
+	// Readiness needs the client, so the server starts after Dial.
+	minFree := getenvInt("SCRATCH_MIN_FREE_BYTES", 1<<30)
+	hh := health.New(health.Options{
+		Ready: []health.Check{health.Temporal(c), health.Scratch(tmpDir, uint64(minFree))},
+		Pprof: getenvBool("PPROF", false),
+	})
+	hs := &http.Server{Addr: znmetrics.AddrFromEnv(), Handler: hh, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := hs.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			zl.Error("health server stopped", zap.Error(err))
+		}
+	}()
+
+	// Scratch janitor: removes directories that crashed workers or terminated
+	// workflows left behind, SCRATCH_GC_TTL after their workflow closed.
+	// SCRATCH_GC_INTERVAL=0 turns it off.
+	gcCtx, stopGC := context.WithCancel(context.Background())
+	defer stopGC()
+	if every := getenvDuration("SCRATCH_GC_INTERVAL", time.Hour); every > 0 {
+		j := &janitor.Janitor{Client: c, Dir: tmpDir, TTL: getenvDuration("SCRATCH_GC_TTL", 24*time.Hour), Logger: logging.NewZapAdapter(zl)}
+		go j.Run(gcCtx, every)
+	}
+
+	// Jobs API, only when API_ADDR is set. It starts workflows on callers'
+	// behalf, so it needs a token; jobs are limited to s3:// (or
+	// API_ALLOWED_PREFIXES) and may only notify API_NOTIFY_PREFIXES.
+	var as *http.Server
+	if addr := os.Getenv("API_ADDR"); addr != "" {
+		token := os.Getenv("API_TOKEN")
+		if token == "" {
+			log.Fatal("API_ADDR is set but API_TOKEN is empty")
+		}
+		h := api.New(znclient.New(c, q), api.Options{
+			Token:           token,
+			AllowedPrefixes: getenvList("API_ALLOWED_PREFIXES"),
+			NotifyPrefixes:  getenvList("API_NOTIFY_PREFIXES"),
+		})
+		as = &http.Server{Addr: addr, Handler: h, ReadHeaderTimeout: 10 * time.Second}
+		go func() {
+			if err := as.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				zl.Error("jobs API stopped", zap.Error(err))
+			}
+		}()
+		zl.Info("jobs API listening", zap.String("addr", addr))
+	}
+
+	// Activity slots: MAX_CONCURRENT_ACTIVITIES for the main task queue (0:
+	// the SDK default), MAX_CONCURRENT_DEDUPE for the dedupe queue, where
+	// every running activity holds a Badger DB open.
+	maxActs := getenvInt("MAX_CONCURRENT_ACTIVITIES", 0)
+	maxDedupe := getenvInt("MAX_CONCURRENT_DEDUPE", runtime.NumCPU())
+
+	w := worker.New(c, q, worker.Options{MaxConcurrentActivityExecutionSize: maxActs})
+	acts := activities.New(activities.Config{ScratchDir: tmpDir, MinFreeBytes: uint64(minFree)})
 	// Register activities with explicit names matching workflow.ExecuteActivity calls
-	w.RegisterActivityWithOptions(acts.StreamPartition, tactivity.RegisterOptions{Name: "Activities.StreamPartition"})
-	w.RegisterActivityWithOptions(acts.ShardDedupeBadger, tactivity.RegisterOptions{Name: "Activities.ShardDedupeBadger"})
-	w.RegisterActivityWithOptions(acts.MergeSortedAndWriteManifest, tactivity.RegisterOptions{Name: "Activities.MergeSortedAndWriteManifest"})
-	w.RegisterActivityWithOptions(acts.CleanupScratch, tactivity.RegisterOptions{Name: "Activities.CleanupScratch"})
+	acts.Register(w)
 	w.RegisterWorkflow(workflow.Zone2NamesWorkflow)
 
-	zl.Info("worker started", zap.String("namespace", ns), zap.String("taskQueue", q), zap.String("tmp", tmpDir), zap.String("metrics", getenv("METRICS_ADDR", ":9090")))
-	if err := w.Run(worker.InterruptCh()); err != nil {
+	dq := workflow.DedupeTaskQueue(q)
+	dw := worker.New(c, dq, worker.Options{MaxConcurrentActivityExecutionSize: maxDedupe})
+	acts.RegisterDedupe(dw)
+	if err := dw.Start(); err != nil {
+		log.Fatal("dedupe worker:", err)
+	}
+	defer dw.Stop()
+
+	zl.Info("worker started", zap.String("namespace", ns), zap.String("taskQueue", q), zap.String("dedupeTaskQueue", dq),
+		zap.Int("maxConcurrentActivities", maxActs), zap.Int("maxConcurrentDedupe", maxDedupe),
+		zap.String("tmp", tmpDir), zap.String("metrics", hs.Addr))
+
+	// On SIGINT/SIGTERM fail /readyz first so no new traffic is routed here,
+	// then stop the worker; the health server stays up until it has stopped.
+	interrupt := worker.InterruptCh()
+	stop := make(chan interface{}, 1)
+	go func() {
+		sig := <-interrupt
+		zl.Info("shutting down", zap.Any("signal", sig))
+		hh.Drain()
+		stop <- sig
+	}()
+	if err := w.Run(stop); err != nil {
 		log.Fatal("worker failed:", err)
 	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if as != nil {
+		_ = as.Shutdown(ctx)
+	}
+	_ = hs.Shutdown(ctx)
 }
 
 func getenv(k, def string) string {
@@ -63,6 +182,58 @@ func getenv(k, def string) string {
 	return def
 }
 
+// getenvList reads a comma-separated list, dropping empty items.
+func getenvList(k string) []string {
+	var out []string
+	for _, v := range strings.Split(os.Getenv(k), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// getenvInt reads a non-negative integer setting; a malformed value is fatal.
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		log.Fatalf("%s: want a non-negative integer, got %q", k, v)
+	}
+	return n
+}
+
+// getenvBool reads a boolean setting ("1", "true", "0", "false", ...); a
+// malformed value is fatal.
+func getenvBool(k string, def bool) bool {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		log.Fatalf("%s: want a boolean, got %q", k, v)
+	}
+	return b
+}
+
+// getenvDuration reads a non-negative duration ("90m", "24h"); a malformed
+// value is fatal.
+func getenvDuration(k string, def time.Duration) time.Duration {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		log.Fatalf("%s: want a non-negative duration, got %q", k, v)
+	}
+	return d
+}
+
 func newZap(level string) *zap.Logger {
 	cfg := zap.NewProductionConfig()
 	switch strings.ToLower(level) {
@@ -0,0 +1,246 @@
+// Command znctl starts and tracks Zone2NamesWorkflow runs on a Temporal
+// cluster:
+//
+//	znctl start --zone s3://zones/com.zone.gz --out s3://zone-names/com/names.txt --filter NS --follow
+//	znctl status <workflow-id>
+//	znctl follow <workflow-id>
+//	znctl result <workflow-id>
+//	znctl cancel <workflow-id>
+//	znctl list [--status Running] [--limit 20]
+//	znctl schedule apply --file schedules.json
+//	znctl schedule backfill <schedule-id> --from 2024-05-01 --to 2024-05-03
+//
+// The connection is configured like the worker: TEMPORAL_ADDRESS (or
+// TEMPORAL_TARGET_HOST), TEMPORAL_NAMESPACE and TEMPORAL_TASK_QUEUE.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	tclient "go.temporal.io/sdk/client"
+
+	znclient "github.com/yourorg/zone-names/internal/client"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+const usage = `usage: znctl <command> [flags]
+
+commands:
+  start    start a run (flags mirror WorkflowParams; --wait or --follow to block)
+  status   show a run's status and progress
+  follow   print progress until a run closes, then its result
+  result   wait for a run and print its result as JSON
+  cancel   request cancellation of a run
+  list     list recent runs
+  schedule manage Temporal Schedules for recurring runs ("znctl schedule" for its commands)
+
+Run "znctl <command> -h" for the command's flags.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stdout, os.Stderr, dial); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "znctl:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+// dial connects to Temporal using the worker's environment variables.
+func dial() (*znclient.Client, func(), error) {
+	c, err := tclient.Dial(tclient.Options{
+		HostPort:  getenv("TEMPORAL_TARGET_HOST", getenv("TEMPORAL_ADDRESS", "localhost:7233")),
+		Namespace: getenv("TEMPORAL_NAMESPACE", "default"),
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("temporal client: %w", err)
+	}
+	return znclient.New(c, getenv("TEMPORAL_TASK_QUEUE", znclient.DefaultTaskQueue)), c.Close, nil
+}
+
+type dialFunc func() (*znclient.Client, func(), error)
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer, dial dialFunc) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+	cmd, args := args[0], args[1:]
+	if cmd == "schedule" {
+		return runSchedule(ctx, args, stdout, stderr, dial)
+	}
+	fs := flag.NewFlagSet("znctl "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	interval := 5 * time.Second
+	intervalFlag := func() { fs.DurationVar(&interval, "interval", interval, "progress polling interval") }
+
+	var exec func(c *znclient.Client) error
+	switch cmd {
+	case "start":
+		var p types.WorkflowParams
+		znclient.BindParamFlags(fs, &p)
+		fs.StringVar(&p.ScratchSubdir, "scratch-subdir", "", "scratch subdirectory (default: the workflow ID)")
+		id := fs.String("id", "", "workflow ID (default: derived from the zone name and time)")
+		wait := fs.Bool("wait", false, "wait for the run and print its result")
+		follow := fs.Bool("follow", false, "print progress until the run closes, then its result")
+		intervalFlag()
+		exec = func(c *znclient.Client) error {
+			r, err := c.Start(ctx, *id, p)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stderr, "started %s (run %s)\n", r.ID, r.RunID)
+			fmt.Fprintln(stdout, r.ID)
+			switch {
+			case *follow:
+				return followRun(ctx, c, r.ID, r.RunID, interval, stdout, stderr)
+			case *wait:
+				return printResult(ctx, c, r.ID, r.RunID, stdout)
+			}
+			return nil
+		}
+	case "status":
+		runID := fs.String("run", "", "run ID (default: latest)")
+		exec = func(c *znclient.Client) error {
+			id := fs.Arg(0)
+			e, err := c.Describe(ctx, id, *runID)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(stdout, "%s  run %s  %s  started %s", e.ID, e.RunID, e.Status, e.StartTime.Format(time.RFC3339))
+			if !e.CloseTime.IsZero() {
+				fmt.Fprintf(stdout, "  closed %s", e.CloseTime.Format(time.RFC3339))
+			}
+			fmt.Fprintln(stdout)
+			if p, err := c.Progress(ctx, id, e.RunID); err == nil {
+				fmt.Fprintln(stdout, formatProgress(p))
+			}
+			return nil
+		}
+	case "follow":
+		runID := fs.String("run", "", "run ID (default: latest)")
+		intervalFlag()
+		exec = func(c *znclient.Client) error {
+			return followRun(ctx, c, fs.Arg(0), *runID, interval, stdout, stderr)
+		}
+	case "result":
+		runID := fs.String("run", "", "run ID (default: latest)")
+		exec = func(c *znclient.Client) error { return printResult(ctx, c, fs.Arg(0), *runID, stdout) }
+	case "cancel":
+		runID := fs.String("run", "", "run ID (default: latest)")
+		exec = func(c *znclient.Client) error {
+			if err := c.Cancel(ctx, fs.Arg(0), *runID); err != nil {
+				return err
+			}
+			fmt.Fprintln(stderr, "cancellation requested for", fs.Arg(0))
+			return nil
+		}
+	case "list":
+		status := fs.String("status", "", "only runs with this status (Running, Completed, Failed, Canceled, ...)")
+		query := fs.String("query", "", "extra visibility query, ANDed with the workflow type")
+		limit := fs.Int("limit", 20, "maximum number of runs")
+		exec = func(c *znclient.Client) error {
+			filter := *query
+			if *status != "" {
+				s := fmt.Sprintf("ExecutionStatus = '%s'", *status)
+				if filter != "" {
+					s += " AND (" + filter + ")"
+				}
+				filter = s
+			}
+			runs, err := c.List(ctx, filter, *limit)
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "WORKFLOW ID\tSTATUS\tSTARTED\tCLOSED")
+			for _, e := range runs {
+				closed := "-"
+				if !e.CloseTime.IsZero() {
+					closed = e.CloseTime.Format(time.RFC3339)
+				}
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.ID, e.Status, e.StartTime.Format(time.RFC3339), closed)
+			}
+			return tw.Flush()
+		}
+	default:
+		fmt.Fprint(stderr, usage)
+		return fmt.Errorf("unknown command %q", cmd)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case cmd == "start" || cmd == "list":
+		if fs.NArg() > 0 {
+			return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+		}
+	case fs.NArg() != 1:
+		return fmt.Errorf("%s takes exactly one workflow ID", cmd)
+	}
+	if interval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+
+	c, closeFn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	return exec(c)
+}
+
+func followRun(ctx context.Context, c *znclient.Client, id, runID string, interval time.Duration, stdout, stderr io.Writer) error {
+	ms, err := c.Follow(ctx, id, runID, interval, func(p types.Progress) {
+		fmt.Fprintf(stderr, "%s  %s\n", time.Now().Format(time.TimeOnly), formatProgress(p))
+	})
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, ms)
+}
+
+func printResult(ctx context.Context, c *znclient.Client, id, runID string, stdout io.Writer) error {
+	ms, err := c.Wait(ctx, id, runID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(stdout, ms)
+}
+
+func formatProgress(p types.Progress) string {
+	s := p.Phase
+	if p.Shards > 0 {
+		s += fmt.Sprintf("  records %d  shards %d/%d deduplicated", p.Records, p.ShardsDeduped, p.Shards)
+	}
+	if p.Unique > 0 {
+		s += fmt.Sprintf("  names %d", p.Unique)
+	}
+	return s
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	tclient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	znclient "github.com/yourorg/zone-names/internal/client"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+func runCmd(t *testing.T, tc *mocks.Client, args ...string) (string, string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	dial := func() (*znclient.Client, func(), error) { return znclient.New(tc, "q"), func() {}, nil }
+	err := run(context.Background(), args, &stdout, &stderr, dial)
+	return stdout.String(), stderr.String(), err
+}
+
+func TestStartWait(t *testing.T) {
+	tc := &mocks.Client{}
+	want := types.WorkflowParams{
+		ZoneURI:   "s3://zones/com.zone.gz",
+		OutputURI: "s3://out/com/names.txt",
+		Shards:    16,
+		Filters:   []string{"NS", "A"},
+		IDNMode:   "alabel",
+	}
+	wr := &mocks.WorkflowRun{}
+	wr.On("GetID").Return("job-1")
+	wr.On("GetRunID").Return("run-1")
+	tc.On("ExecuteWorkflow", mock.Anything, tclient.StartWorkflowOptions{ID: "job-1", TaskQueue: "q", Memo: map[string]any{"params": want}}, znclient.WorkflowType, want).
+		Return(wr, nil).Once()
+	res := &mocks.WorkflowRun{}
+	res.On("Get", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { *args.Get(1).(*types.MergeStats) = types.MergeStats{Emitted: 7} }).Return(nil)
+	tc.On("GetWorkflow", mock.Anything, "job-1", "run-1").Return(res)
+
+	out, _, err := runCmd(t, tc, "start", "--id", "job-1", "--zone", want.ZoneURI, "--out", want.OutputURI,
+		"--shards", "16", "--filter", "ns,a", "--idn", "alabel", "--wait")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "job-1\n") || !strings.Contains(out, `"Emitted": 7`) {
+		t.Fatalf("stdout %q", out)
+	}
+	tc.AssertExpectations(t)
+}
+
+func TestStartInvalid(t *testing.T) {
+	tc := &mocks.Client{}
+	_, _, err := runCmd(t, tc, "start", "--zone", "http://x/zone", "--out", "s3://o/names.txt")
+	if err == nil || !strings.Contains(err.Error(), "ZoneURI") {
+		t.Fatalf("err %v", err)
+	}
+	tc.AssertNotCalled(t, "ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestStatusAndList(t *testing.T) {
+	tc := &mocks.Client{}
+	info := &workflowpb.WorkflowExecutionInfo{
+		Execution: &commonpb.WorkflowExecution{WorkflowId: "job-1", RunId: "run-1"},
+		Status:    enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING,
+		StartTime: timestamppb.Now(),
+	}
+	tc.On("DescribeWorkflowExecution", mock.Anything, "job-1", "").
+		Return(&workflowservice.DescribeWorkflowExecutionResponse{WorkflowExecutionInfo: info}, nil)
+	val := &mocks.Value{}
+	val.On("Get", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*types.Progress) = types.Progress{Phase: types.PhaseDeduping, Shards: 4, ShardsDeduped: 3, Records: 100}
+	}).Return(nil)
+	tc.On("QueryWorkflow", mock.Anything, "job-1", "run-1", types.QueryProgress).Return(val, nil)
+
+	out, _, err := runCmd(t, tc, "status", "job-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "job-1  run run-1  Running") || !strings.Contains(out, "shards 3/4") {
+		t.Fatalf("status %q", out)
+	}
+
+	tc.On("ListWorkflow", mock.Anything, mock.MatchedBy(func(r *workflowservice.ListWorkflowExecutionsRequest) bool {
+		return r.Query == "WorkflowType = 'Zone2NamesWorkflow' AND (ExecutionStatus = 'Running')" && r.PageSize == 5
+	})).Return(&workflowservice.ListWorkflowExecutionsResponse{Executions: []*workflowpb.WorkflowExecutionInfo{info}}, nil)
+	out, _, err = runCmd(t, tc, "list", "--status", "Running", "--limit", "5")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out), "\n"); len(lines) != 2 || !strings.HasPrefix(lines[1], "job-1 ") {
+		t.Fatalf("list %q", out)
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"bogus"},
+		{"status"},
+		{"cancel", "a", "b"},
+		{"list", "extra"},
+		{"follow", "--interval", "0s", "job"},
+	} {
+		if _, _, err := runCmd(t, &mocks.Client{}, args...); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	znclient "github.com/yourorg/zone-names/internal/client"
+)
+
+const scheduleUsage = `usage: znctl schedule <command> [flags]
+
+commands:
+  apply     create or update the schedules in a JSON file (--file)
+  list      list schedules running Zone2NamesWorkflow
+  describe  show a schedule, its recent and next runs
+  trigger   start a run now
+  pause     stop starting runs (--note)
+  unpause   resume starting runs (--note)
+  backfill  start the runs due between --from and --to
+  delete    delete a schedule (runs already started are not affected)
+`
+
+func runSchedule(ctx context.Context, args []string, stdout, stderr io.Writer, dial dialFunc) error {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, scheduleUsage)
+		return flag.ErrHelp
+	}
+	cmd, args := args[0], args[1:]
+	fs := flag.NewFlagSet("znctl schedule "+cmd, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	var exec func(c *znclient.Client) error
+	wantID := true
+	switch cmd {
+	case "apply":
+		wantID = false
+		file := fs.String("file", "", "JSON file with an array of schedules (\"-\" for stdin)")
+		exec = func(c *znclient.Client) error {
+			scheds, err := readSchedules(*file)
+			if err != nil {
+				return err
+			}
+			for _, s := range scheds {
+				created, err := c.ApplySchedule(ctx, s)
+				if err != nil {
+					return err
+				}
+				verb := "updated"
+				if created {
+					verb = "created"
+				}
+				fmt.Fprintf(stdout, "%s %s\n", verb, s.ID)
+			}
+			return nil
+		}
+	case "list":
+		wantID = false
+		exec = func(c *znclient.Client) error {
+			scheds, err := c.ListSchedules(ctx)
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(tw, "SCHEDULE ID\tCRON\tPAUSED\tLAST RUN\tNEXT RUN")
+			for _, s := range scheds {
+				fmt.Fprintf(tw, "%s\t%s\t%t\t%s\t%s\n", s.ID, strings.Join(s.Cron, "; "), s.Paused, lastTime(s.Recent), firstTime(s.Next))
+			}
+			return tw.Flush()
+		}
+	case "describe":
+		exec = func(c *znclient.Client) error {
+			s, err := c.DescribeSchedule(ctx, fs.Arg(0))
+			if err != nil {
+				return err
+			}
+			return writeJSON(stdout, s)
+		}
+	case "trigger":
+		exec = func(c *znclient.Client) error { return c.TriggerSchedule(ctx, fs.Arg(0)) }
+	case "pause", "unpause":
+		note := fs.String("note", "", "reason, shown in describe and the Temporal UI")
+		exec = func(c *znclient.Client) error {
+			if cmd == "pause" {
+				return c.PauseSchedule(ctx, fs.Arg(0), *note)
+			}
+			return c.UnpauseSchedule(ctx, fs.Arg(0), *note)
+		}
+	case "backfill":
+		from := fs.String("from", "", "start: a date (2006-01-02, from 00:00 UTC) or an RFC 3339 time")
+		to := fs.String("to", "", "end: a date (through the end of that day, UTC) or an RFC 3339 time")
+		overlap := fs.String("overlap", "", "overlap policy for the backfilled runs (default buffer-all: one after another)")
+		exec = func(c *znclient.Client) error {
+			start, err := parseBound("--from", *from, false)
+			if err != nil {
+				return err
+			}
+			end, err := parseBound("--to", *to, true)
+			if err != nil {
+				return err
+			}
+			if err := c.Backfill(ctx, fs.Arg(0), start, end, *overlap); err != nil {
+				return err
+			}
+			fmt.Fprintf(stderr, "backfill requested for %s, %s to %s\n", fs.Arg(0), start.Format(time.RFC3339), end.Format(time.RFC3339))
+			return nil
+		}
+	case "delete":
+		exec = func(c *znclient.Client) error { return c.DeleteSchedule(ctx, fs.Arg(0)) }
+	default:
+		fmt.Fprint(stderr, scheduleUsage)
+		return fmt.Errorf("unknown schedule command %q", cmd)
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	switch {
+	case wantID && fs.NArg() != 1:
+		return fmt.Errorf("schedule %s takes exactly one schedule ID", cmd)
+	case !wantID && fs.NArg() > 0:
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	c, closeFn, err := dial()
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+	return exec(c)
+}
+
+// readSchedules reads and validates a schedule file, so that a bad entry
+// fails the apply before any schedule is touched.
+func readSchedules(file string) ([]znclient.ScheduleConfig, error) {
+	if file == "" {
+		return nil, errors.New("--file is required")
+	}
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var scheds []znclient.ScheduleConfig
+	if err := dec.Decode(&scheds); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	seen := map[string]bool{}
+	for _, s := range scheds {
+		if err := s.Validate(); err != nil {
+			return nil, err
+		}
+		if seen[s.ID] {
+			return nil, fmt.Errorf("schedule %s: duplicate id", s.ID)
+		}
+		seen[s.ID] = true
+	}
+	return scheds, nil
+}
+
+// parseBound parses a backfill bound. A date as the end bound includes the
+// whole day.
+func parseBound(name, v string, end bool) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, errors.New(name + " is required")
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		if end {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: want 2006-01-02 or an RFC 3339 time, got %q", name, v)
+	}
+	return t, nil
+}
+
+func firstTime(ts []time.Time) string {
+	if len(ts) == 0 {
+		return "-"
+	}
+	return ts[0].Format(time.RFC3339)
+}
+
+func lastTime(ts []time.Time) string {
+	if len(ts) == 0 {
+		return "-"
+	}
+	return ts[len(ts)-1].Format(time.RFC3339)
+}
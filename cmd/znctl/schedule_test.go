@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	enumspb "go.temporal.io/api/enums/v1"
+	tclient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/temporal"
+)
+
+func TestScheduleApply(t *testing.T) {
+	tc, sc, h := &mocks.Client{}, &mocks.ScheduleClient{}, &mocks.ScheduleHandle{}
+	tc.On("ScheduleClient").Return(sc)
+	sc.On("Create", mock.Anything, mock.MatchedBy(func(o tclient.ScheduleOptions) bool { return o.ID == "com-daily" })).
+		Return(&mocks.ScheduleHandle{}, nil).Once()
+	sc.On("Create", mock.Anything, mock.MatchedBy(func(o tclient.ScheduleOptions) bool { return o.ID == "net-daily" })).
+		Return(nil, temporal.ErrScheduleAlreadyRunning).Once()
+	sc.On("GetHandle", mock.Anything, "net-daily").Return(h)
+	h.On("Update", mock.Anything, mock.Anything).Return(nil).Once()
+
+	out, _, err := runCmd(t, tc, "schedule", "apply", "--file", "../../examples/schedules.example.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "created com-daily\nupdated net-daily\n" {
+		t.Fatalf("stdout %q", out)
+	}
+	tc.AssertExpectations(t)
+	h.AssertExpectations(t)
+}
+
+func TestScheduleBackfill(t *testing.T) {
+	tc, sc, h := &mocks.Client{}, &mocks.ScheduleClient{}, &mocks.ScheduleHandle{}
+	tc.On("ScheduleClient").Return(sc)
+	sc.On("GetHandle", mock.Anything, "com-daily").Return(h)
+	h.On("Backfill", mock.Anything, tclient.ScheduleBackfillOptions{Backfill: []tclient.ScheduleBackfill{{
+		Start:   time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		End:     time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC), // through the end of --to
+		Overlap: enumspb.SCHEDULE_OVERLAP_POLICY_BUFFER_ALL,
+	}}}).Return(nil).Once()
+
+	if _, _, err := runCmd(t, tc, "schedule", "backfill", "--from", "2024-05-01", "--to", "2024-05-03", "com-daily"); err != nil {
+		t.Fatal(err)
+	}
+	h.AssertExpectations(t)
+
+	for _, args := range [][]string{
+		{"schedule", "backfill", "--to", "2024-05-03", "com-daily"},
+		{"schedule", "backfill", "--from", "May 1", "--to", "2024-05-03", "com-daily"},
+		{"schedule", "backfill", "--from", "2024-05-01", "--to", "2024-05-03", "--overlap", "queue", "com-daily"},
+	} {
+		if _, _, err := runCmd(t, tc, args...); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
+
+func TestScheduleUsageErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{"schedule"},
+		{"schedule", "bogus"},
+		{"schedule", "trigger"},
+		{"schedule", "list", "extra"},
+		{"schedule", "apply"},
+		{"schedule", "apply", "--file", "../../examples/request.example.json"},
+	} {
+		_, _, err := runCmd(t, &mocks.Client{}, args...)
+		if err == nil {
+			t.Errorf("%q: expected error", args)
+		} else if strings.Contains(err.Error(), "mock") {
+			t.Errorf("%q: reached the client: %v", args, err)
+		}
+	}
+}
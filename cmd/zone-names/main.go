@@ -0,0 +1,312 @@
+// Command zone-names runs the extraction pipeline in-process, without
+// Temporal, for ad-hoc use:
+//
+//	zone-names extract --zone com.zone.gz --out names.txt --shards 16 --filter NS --idn alabel
+//
+// It calls the same activity methods as the worker, runs shard dedupe in
+// parallel goroutines and writes the same output and manifest.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/yourorg/zone-names/internal/activities"
+	znclient "github.com/yourorg/zone-names/internal/client"
+	"github.com/yourorg/zone-names/internal/types"
+	"github.com/yourorg/zone-names/internal/workflow"
+)
+
+const usage = `usage: zone-names extract --zone URI --out URI [flags]
+
+Run "zone-names extract -h" for the flags.
+`
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if err := run(ctx, os.Args[1:], os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "zone-names:", err)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(ctx context.Context, args []string, stderr io.Writer) error {
+	if len(args) == 0 || args[0] != "extract" {
+		fmt.Fprint(stderr, usage)
+		return flag.ErrHelp
+	}
+	opts, err := parseExtract(args[1:], stderr)
+	if err != nil {
+		return err
+	}
+	ms, err := extract(ctx, opts)
+	if err != nil {
+		return err
+	}
+	if ms.Skipped {
+		fmt.Fprintf(stderr, "input unchanged since previous run; %d names in %s\n", ms.Emitted, opts.params.OutputURI)
+	} else {
+		fmt.Fprintf(stderr, "%d names -> %s (manifest %s)\n", ms.Emitted, opts.params.OutputURI, opts.manifest)
+	}
+	return nil
+}
+
+type extractOpts struct {
+	params   types.WorkflowParams
+	manifest string
+	scratch  string // scratch root; the run uses a fresh subdirectory
+	parallel int
+	log      io.Writer
+}
+
+func parseExtract(args []string, stderr io.Writer) (extractOpts, error) {
+	o := extractOpts{log: stderr}
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	znclient.BindParamFlags(fs, &o.params)
+	fs.Lookup("zone").Usage = "zone file: local path, file:// or s3:// URI (.gz is decompressed)"
+	fs.Lookup("out").Usage = "output: local path, file:// or s3:// URI"
+	fs.StringVar(&o.manifest, "manifest", "", "manifest location (default: next to --out, as the workflow does)")
+	fs.StringVar(&o.scratch, "scratch", getenv("ZN_TMP_DIR", os.TempDir()), "scratch root directory")
+	fs.IntVar(&o.parallel, "parallel", runtime.NumCPU(), "shards deduplicated at once")
+	if err := fs.Parse(args); err != nil {
+		return o, err
+	}
+	p := &o.params
+	if fs.NArg() > 0 {
+		return o, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if p.ZoneURI == "" || p.OutputURI == "" {
+		return o, errors.New("--zone and --out are required")
+	}
+	if o.parallel < 1 {
+		return o, errors.New("--parallel must be at least 1")
+	}
+	var err error
+	if p.ZoneURI, err = toURI(p.ZoneURI); err != nil {
+		return o, err
+	}
+	if p.OutputURI, err = toURI(p.OutputURI); err != nil {
+		return o, err
+	}
+	if o.manifest == "" {
+		o.manifest = workflow.ManifestPath(p.OutputURI)
+	} else if o.manifest, err = toURI(o.manifest); err != nil {
+		return o, err
+	}
+	return o, p.Validate()
+}
+
+// extract mirrors Zone2NamesWorkflow: unchanged check, partition, parallel
+// dedupe, optional hierarchical reduce, merge, scratch cleanup and the
+// completion webhook.
+func extract(ctx context.Context, o extractOpts) (ms types.MergeStats, err error) {
+	p := o.params
+	if err := os.MkdirAll(o.scratch, 0o755); err != nil {
+		return types.MergeStats{}, err
+	}
+	dir, err := os.MkdirTemp(o.scratch, "cli-")
+	if err != nil {
+		return types.MergeStats{}, err
+	}
+	p.ScratchSubdir = filepath.Base(dir)
+	acts := activities.New(activities.Config{ScratchDir: o.scratch})
+	cleanup := func() {
+		_ = acts.CleanupScratch(context.Background(), types.CleanupParams{ScratchSubdir: p.ScratchSubdir})
+	}
+	defer func() { notify(acts, o, p.ScratchSubdir, ms, err) }()
+
+	if !p.Force {
+		prev, err := acts.CheckUnchanged(ctx, types.UnchangedParams{ZoneURI: p.ZoneURI, ManifestURI: o.manifest, Params: p})
+		switch {
+		case err != nil:
+			fmt.Fprintln(o.log, "unchanged check failed; running full pipeline:", err)
+		case prev.Unchanged:
+			cleanup()
+			return prev.Previous, nil
+		}
+	}
+
+	part, err := acts.StreamPartition(ctx, p)
+	if err != nil {
+		cleanup()
+		return types.MergeStats{}, fmt.Errorf("partition: %w", err)
+	}
+	partShards := len(part.ShardURIs)
+	splits := p.ShardSplits(part)
+	if len(splits) > 0 {
+		if part, err = splitShards(ctx, acts, p.ZoneLabel(), part, splits, o.parallel); err != nil {
+			cleanup()
+			return types.MergeStats{}, fmt.Errorf("split: %w", err)
+		}
+	}
+
+	dedupeTiming := types.PhaseTiming{StartedAt: time.Now().UTC()}
+	stats := make([]types.ShardStats, len(part.ShardURIs))
+	sorted := make([]string, len(part.ShardURIs))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(o.parallel)
+	if n := p.MaxParallelDedupe; n > 0 && n < o.parallel {
+		g.SetLimit(n)
+	}
+	for i, shard := range part.ShardURIs {
+		sorted[i] = shard + ".sorted"
+		dp := types.ShardDedupeParams{ShardURI: shard, OutputURI: sorted[i], WithTypes: p.WantsRRTypes(), SortOrder: p.Order(), Zone: p.ZoneLabel()}
+		g.Go(func() error {
+			var err error
+			stats[i], err = acts.ShardDedupeBadger(gctx, dp)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		cleanup()
+		return types.MergeStats{}, fmt.Errorf("dedupe: %w", err)
+	}
+	dedupeTiming.FinishedAt = time.Now().UTC()
+
+	if p.Merge() == types.MergeHierarchical {
+		if sorted, err = reduceSorted(ctx, acts, sorted, p, o.parallel); err != nil {
+			cleanup()
+			return types.MergeStats{}, fmt.Errorf("merge: %w", err)
+		}
+	}
+
+	ms, err = acts.MergeSortedAndWriteManifest(ctx, types.MergeParams{
+		SortedShardURIs: sorted,
+		OutURI:          p.OutputURI,
+		ManifestURI:     o.manifest,
+		Params:          p,
+		Shards:          partShards,
+		SplitShards:     len(splits),
+		ShardStats:      stats,
+		TotalSeen:       part.Records,
+		Input:           types.FileInfo{URI: p.ZoneURI, Bytes: part.SizeBytes, SHA256: part.InputHash, ETag: part.InputETag, Includes: part.Includes},
+		Phases:          types.PhaseTimings{Partition: part.Timing, Dedupe: dedupeTiming},
+	})
+	if err != nil {
+		cleanup()
+		return types.MergeStats{}, fmt.Errorf("merge: %w", err)
+	}
+	if !p.KeepScratch {
+		cleanup()
+	}
+	return ms, nil
+}
+
+// notify posts the completion webhook, if requested, once. The run ID in the
+// notification is the scratch subdirectory name; there is no workflow ID.
+// A failed delivery is reported but doesn't change the outcome.
+func notify(acts *activities.Activities, o extractOpts, runID string, ms types.MergeStats, runErr error) {
+	p := o.params
+	event := types.EventSucceeded
+	switch {
+	case runErr != nil:
+		event = types.EventFailed
+	case ms.Skipped:
+		event = types.EventSkipped
+	}
+	if !p.Notify.Wants(event) {
+		return
+	}
+	np := types.NotifyParams{
+		Notify:      *p.Notify,
+		Event:       event,
+		RunID:       runID,
+		ZoneURI:     p.ZoneURI,
+		OutputURI:   p.OutputURI,
+		ManifestURI: o.manifest,
+	}
+	if runErr != nil {
+		np.Error = runErr.Error()
+	}
+	// Not ctx: the run may have ended because ctx was cancelled.
+	if err := acts.Notify(context.Background(), np); err != nil {
+		fmt.Fprintln(o.log, "webhook notification failed:", err)
+	}
+}
+
+// splitShards is the in-process counterpart of the workflow's skewed shard
+// split.
+func splitShards(ctx context.Context, acts *activities.Activities, zone string, part types.PartitionResult, splits map[int]int, parallel int) (types.PartitionResult, error) {
+	var mu sync.Mutex
+	subs := make(map[int]types.SplitShardResult, len(splits))
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(parallel)
+	for i, n := range splits {
+		g.Go(func() error {
+			res, err := acts.SplitShard(gctx, types.SplitShardParams{ShardURI: part.ShardURIs[i], Parts: n, Zone: zone})
+			mu.Lock()
+			subs[i] = res
+			mu.Unlock()
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return part, err
+	}
+	return part.ReplaceShards(subs), nil
+}
+
+// reduceSorted is the in-process counterpart of the workflow's hierarchical
+// reduce: groups of MergeFanIn files are merged in parallel, level by level.
+func reduceSorted(ctx context.Context, acts *activities.Activities, uris []string, p types.WorkflowParams, parallel int) ([]string, error) {
+	fanIn := p.MergeFanIn
+	if fanIn <= 1 {
+		fanIn = types.DefaultMergeFanIn
+	}
+	for level := 0; len(uris) > fanIn; level++ {
+		var next []string
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(parallel)
+		for start := 0; start < len(uris); start += fanIn {
+			group := uris[start:min(start+fanIn, len(uris))]
+			dir := group[0][:strings.LastIndex(group[0], "/")+1]
+			mp := types.MergeShardsParams{ShardURIs: group, OutputURI: fmt.Sprintf("%smerge-%d-%03d.sorted", dir, level, len(next)), SortOrder: p.Order(), Zone: p.ZoneLabel()}
+			next = append(next, mp.OutputURI)
+			g.Go(func() error {
+				_, err := acts.MergeShards(gctx, mp)
+				return err
+			})
+		}
+		if err := g.Wait(); err != nil {
+			return nil, err
+		}
+		uris = next
+	}
+	return uris, nil
+}
+
+// toURI turns a plain local path into an absolute file:// URI; URIs with a
+// scheme are returned unchanged.
+func toURI(s string) (string, error) {
+	if strings.Contains(s, "://") {
+		return s, nil
+	}
+	abs, err := filepath.Abs(s)
+	if err != nil {
+		return "", err
+	}
+	return "file://" + abs, nil
+}
+
+func getenv(k, def string) string {
+	if v := os.Getenv(k); v != "" {
+		return v
+	}
+	return def
+}
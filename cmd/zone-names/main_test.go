@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/zone-names/internal/types"
+	"github.com/yourorg/zone-names/internal/webhooktest"
+	"github.com/yourorg/zone-names/internal/workflow"
+)
+
+const fixtureZone = "../../internal/activities/testdata/example.zone"
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out", "names.txt")
+	scratch := filepath.Join(dir, "scratch")
+	args := []string{"extract", "--zone", fixtureZone, "--out", out, "--shards", "4", "--filter", "a,aaaa", "--filter", "NS", "--scratch", scratch, "--parallel", "2"}
+
+	var stderr bytes.Buffer
+	if err := run(context.Background(), args, &stderr); err != nil {
+		t.Fatalf("run: %v\n%s", err, stderr.String())
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "example\nmx.example\nns1.example\nns2.example\nwww.example\nxn--bcher-kva.example\n"
+	if string(got) != want {
+		t.Fatalf("names:\n%s\nwant:\n%s", got, want)
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "out", "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var man types.Manifest
+	if err := json.Unmarshal(b, &man); err != nil {
+		t.Fatal(err)
+	}
+	if man.Unique != 6 || len(man.ShardStats) != 4 || man.Input.URI != "file://"+mustAbs(t, fixtureZone) ||
+		strings.Join(man.Params.Filters, ",") != "A,AAAA,NS" {
+		t.Fatalf("manifest %+v", man)
+	}
+	if man.Phases.Dedupe.StartedAt.IsZero() || man.Phases.Merge.FinishedAt.IsZero() {
+		t.Fatalf("phases %+v", man.Phases)
+	}
+	if ents, _ := os.ReadDir(scratch); len(ents) != 0 {
+		t.Fatalf("scratch not cleaned up: %v", ents)
+	}
+
+	// A second run finds the manifest and skips the work.
+	stderr.Reset()
+	if err := run(context.Background(), args, &stderr); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stderr.String(), "unchanged") {
+		t.Fatalf("second run was not skipped: %s", stderr.String())
+	}
+}
+
+func TestExtractHierarchical(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "names.txt")
+	args := []string{"extract", "--zone", fixtureZone, "--out", out, "--shards", "9", "--merge", "hierarchical", "--fan-in", "2", "--scratch", dir}
+	if err := run(context.Background(), args, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(out)
+	if n := strings.Count(string(got), "\n"); n != 8 {
+		t.Fatalf("got %d names:\n%s", n, got)
+	}
+}
+
+func TestExtractSplitsShards(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "names.txt")
+	args := []string{"extract", "--zone", fixtureZone, "--out", out, "--shards", "2", "--split-shard-bytes", "40", "--scratch", dir}
+	if err := run(context.Background(), args, &bytes.Buffer{}); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := os.ReadFile(workflow.ManifestPath("file://" + out)[len("file://"):])
+	var man types.Manifest
+	if err := json.Unmarshal(b, &man); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := os.ReadFile(out)
+	// The manifest keeps the partition count; ShardStats has the sub-shards.
+	if n := strings.Count(string(got), "\n"); n != 8 || man.Shards != 2 || man.SplitShards == 0 || len(man.ShardStats) <= 2 {
+		t.Fatalf("got %d names from %d shards (%d split, %d deduped):\n%s", n, man.Shards, man.SplitShards, len(man.ShardStats), got)
+	}
+}
+
+func TestExtractNotify(t *testing.T) {
+	hook := webhooktest.NewServer(t, "k")
+	dir := t.TempDir()
+	args := []string{"extract", "--zone", fixtureZone, "--out", filepath.Join(dir, "names.txt"), "--scratch", dir,
+		"--notify-url", hook.URL, "--notify-secret", "k"}
+	for range 2 {
+		if err := run(context.Background(), args, &bytes.Buffer{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A zone that doesn't exist fails the run, which is reported too.
+	args[2] = filepath.Join(dir, "missing.zone")
+	if err := run(context.Background(), args, &bytes.Buffer{}); err == nil {
+		t.Fatal("want error for missing zone")
+	}
+
+	ds := hook.Deliveries()
+	if len(ds) != 3 {
+		t.Fatalf("%d deliveries", len(ds))
+	}
+	for i, want := range []string{types.EventSucceeded, types.EventSkipped, types.EventFailed} {
+		if n := ds[i].Notification; n.Event != want || !ds[i].SignatureOK || !strings.HasPrefix(n.RunID, "cli-") {
+			t.Errorf("delivery %d: %+v", i, n)
+		}
+	}
+	if s := ds[0].Notification.Summary; s == nil || s.Unique != 8 {
+		t.Errorf("summary %+v", s)
+	}
+	if ds[2].Notification.Error == "" {
+		t.Error("failure without error")
+	}
+}
+
+func TestExtractUsage(t *testing.T) {
+	for _, args := range [][]string{
+		nil,
+		{"bogus"},
+		{"extract", "--out", "x"},
+		{"extract", "--zone", "z", "--out", "x", "extra"},
+		{"extract", "--zone", "z", "--out", "x", "--parallel", "0"},
+	} {
+		if err := run(context.Background(), args, &bytes.Buffer{}); err == nil {
+			t.Errorf("%q: expected error", args)
+		}
+	}
+}
+
+func mustAbs(t *testing.T, p string) string {
+	t.Helper()
+	abs, err := filepath.Abs(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return abs
+}
@@ -2,7 +2,7 @@ package activities
 
 import (
 	"context"
-	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 
@@ -13,14 +13,16 @@ import (
 // It is safe to call even if the directory doesn't exist.
 func (a *Activities) CleanupScratch(ctx context.Context, p types.CleanupParams) error {
 	sub := filepath.Clean(p.ScratchSubdir)
-	if sub == "." || sub == "" || sub == "/" || sub == ".." {
-		// Safety: never allow deleting the entire scratch root or going up the tree.
-		return errors.New("invalid scratch subdir for cleanup")
-	}
 	base := filepath.Join(a.cfg.ScratchDir, sub)
+	// Safety: never delete the entire scratch root or anything outside it.
+	rel, err := filepath.Rel(a.cfg.ScratchDir, base)
+	if p.ScratchSubdir == "" || filepath.IsAbs(sub) || err != nil || rel == "." || !filepath.IsLocal(rel) {
+		return invalidParams(fmt.Errorf("scratch subdir %q for cleanup", p.ScratchSubdir))
+	}
 	// RemoveAll is idempotent; ignore if not exists
 	if err := os.RemoveAll(base); err != nil {
 		return err
 	}
+	logger(ctx).Info("removed scratch directory", "dir", base)
 	return nil
 }
@@ -0,0 +1,37 @@
+package activities
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+func TestCleanupScratch(t *testing.T) {
+	env, a := newActivityEnv(t)
+	sub := filepath.Join(a.cfg.ScratchDir, "wf-1")
+	_ = os.MkdirAll(filepath.Join(sub, "shard-00.txt.badger"), 0o755)
+	if _, err := env.ExecuteActivity("Activities.CleanupScratch", types.CleanupParams{ScratchSubdir: "wf-1"}); err != nil {
+		t.Fatalf("cleanup: %v", err)
+	}
+	if _, err := os.Stat(sub); !os.IsNotExist(err) {
+		t.Fatalf("subdir still there: %v", err)
+	}
+	// Idempotent.
+	if _, err := env.ExecuteActivity("Activities.CleanupScratch", types.CleanupParams{ScratchSubdir: "wf-1"}); err != nil {
+		t.Fatalf("second cleanup: %v", err)
+	}
+}
+
+func TestCleanupScratchRefusesRoot(t *testing.T) {
+	env, a := newActivityEnv(t)
+	for _, sub := range []string{"", ".", "..", "/", "a/../..", "../sibling", "/etc"} {
+		if _, err := env.ExecuteActivity("Activities.CleanupScratch", types.CleanupParams{ScratchSubdir: sub}); err == nil {
+			t.Fatalf("cleanup of %q should fail", sub)
+		}
+	}
+	if _, err := os.Stat(a.cfg.ScratchDir); err != nil {
+		t.Fatalf("scratch root removed: %v", err)
+	}
+}
@@ -2,21 +2,29 @@ package activities
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
-	"go.temporal.io/sdk/activity"
-
 	"github.com/dgraph-io/badger/v4"
+	"go.opentelemetry.io/otel/attribute"
+
 	iopkg "github.com/yourorg/zone-names/internal/iopkg"
 	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/tracing"
 	"github.com/yourorg/zone-names/internal/types"
 )
 
 func (a *Activities) ShardDedupeBadger(ctx context.Context, p types.ShardDedupeParams) (types.ShardStats, error) {
-	in, err := iopkg.OpenReader(p.ShardURI)
+	defer znmetrics.ObservePhase(p.Zone, znmetrics.PhaseDedupe, time.Now())
+	active := znmetrics.ActiveShards.WithLabelValues(p.Zone)
+	active.Inc()
+	defer active.Dec()
+
+	in, err := iopkg.OpenReader(ctx, p.ShardURI)
 	if err != nil {
 		return types.ShardStats{}, err
 	}
@@ -27,6 +35,7 @@ func (a *Activities) ShardDedupeBadger(ctx context.Context, p types.ShardDedupeP
 	shardPath := strings.TrimPrefix(p.ShardURI, "file://")
 	dir := filepath.Dir(shardPath)
 	dbpath := filepath.Join(dir, filepath.Base(shardPath)+".badger")
+	space := a.guard(dir)
 	opts := badger.DefaultOptions(dbpath).WithLogger(nil)
 	db, err := badger.Open(opts)
 	if err != nil {
@@ -34,17 +43,49 @@ func (a *Activities) ShardDedupeBadger(ctx context.Context, p types.ShardDedupeP
 	}
 	defer db.Close()
 
+	// Ingest (shard into Badger) and emit (Badger out in order) are traced
+	// separately; errors are recorded on the activity's span.
+	_, ingest := tracing.Start(ctx, "dedupe.ingest", attribute.String("shard", p.ShardURI))
+	defer ingest.End()
 	sc := bufio.NewScanner(in)
 	sc.Buffer(make([]byte, 1024), 1024*1024)
 	var total uint64
 	lastHB := time.Now()
 	for sc.Scan() {
-		k := append([]byte(nil), sc.Bytes()...)
+		line := sc.Bytes()
+		var rrtype []byte
+		if p.WithTypes {
+			if i := bytes.IndexByte(line, '\t'); i >= 0 {
+				line, rrtype = line[:i], line[i+1:]
+			}
+		}
+		// Badger iterates keys in byte order, so store the sort key rather
+		// than the name itself.
+		if err := canceled(ctx, total); err != nil {
+			return types.ShardStats{}, err
+		}
+		if err := space.check(total); err != nil {
+			return types.ShardStats{}, err
+		}
+		k := []byte(sortKey(p.SortOrder, string(line)))
 		err := db.Update(func(txn *badger.Txn) error {
-			_, e := txn.Get(k)
+			it, e := txn.Get(k)
 			if e == badger.ErrKeyNotFound {
+				if len(rrtype) > 0 {
+					return txn.Set(k, append([]byte(nil), rrtype...))
+				}
 				return txn.Set(k, []byte{1})
 			}
+			if e != nil || len(rrtype) == 0 {
+				return nil
+			}
+			v, e := it.ValueCopy(nil)
+			if e != nil {
+				return e
+			}
+			if merged, added := addType(v, rrtype); added {
+				return txn.Set(k, merged)
+			}
 			return nil
 		})
 		if err != nil {
@@ -53,15 +94,20 @@ func (a *Activities) ShardDedupeBadger(ctx context.Context, p types.ShardDedupeP
 		total++
 		// Heartbeat frequently by count and also time-based as a safety net.
 		if total%5000 == 0 || time.Since(lastHB) > 10*time.Second {
-			activity.RecordHeartbeat(ctx, total)
+			heartbeat(ctx, total)
 			lastHB = time.Now()
 		}
 	}
 	if err := sc.Err(); err != nil {
 		return types.ShardStats{}, err
 	}
+	ingest.SetAttributes(attribute.Int64("lines", int64(total)))
+	ingest.End()
+
+	ectx, emit := tracing.Start(ctx, "dedupe.emit", attribute.String("output", p.OutputURI))
+	defer emit.End()
 
-	out, closeOut, err := iopkg.CreateWriter(p.OutputURI)
+	out, closeOut, err := iopkg.CreateWriter(ectx, p.OutputURI)
 	if err != nil {
 		return types.ShardStats{}, err
 	}
@@ -76,17 +122,35 @@ func (a *Activities) ShardDedupeBadger(ctx context.Context, p types.ShardDedupeP
 		it := txn.NewIterator(badger.DefaultIteratorOptions)
 		defer it.Close()
 		for it.Rewind(); it.Valid(); it.Next() {
+			if err := canceled(ctx, uniq); err != nil {
+				return err
+			}
+			if err := space.check(uniq); err != nil {
+				return err
+			}
 			item := it.Item()
 			k := item.KeyCopy(nil)
-			if _, err := bw.Write(k); err != nil {
+			if _, err := bw.WriteString(nameFromKey(p.SortOrder, string(k))); err != nil {
 				return err
 			}
+			if p.WithTypes {
+				v, err := item.ValueCopy(nil)
+				if err != nil {
+					return err
+				}
+				if err := bw.WriteByte('\t'); err != nil {
+					return err
+				}
+				if _, err := bw.Write(v); err != nil {
+					return err
+				}
+			}
 			if err := bw.WriteByte('\n'); err != nil {
 				return err
 			}
 			uniq++
 			if uniq%10000 == 0 || time.Since(lastHB) > 10*time.Second {
-				activity.RecordHeartbeat(ctx, map[string]any{"total": total, "unique": uniq})
+				heartbeat(ctx, map[string]any{"total": total, "unique": uniq})
 				lastHB = time.Now()
 			}
 		}
@@ -98,10 +162,23 @@ func (a *Activities) ShardDedupeBadger(ctx context.Context, p types.ShardDedupeP
 	if err := bw.Flush(); err != nil {
 		return types.ShardStats{}, err
 	}
+	emit.SetAttributes(attribute.Int64("unique", int64(uniq)))
 
 	// metrics
-	znmetrics.DedupeInput.Add(float64(total))
-	znmetrics.DedupeUnique.Add(float64(uniq))
+	znmetrics.DedupeInput.WithLabelValues(p.Zone).Add(float64(total))
+	znmetrics.DedupeUnique.WithLabelValues(p.Zone).Add(float64(uniq))
+	logger(ctx).Info("deduped shard", "shard", p.ShardURI, "total", total, "unique", uniq)
 
 	return types.ShardStats{Total: total, Unique: uniq}, nil
 }
+
+// addType adds t to the sorted, comma-separated type list in set. It reports
+// false (and returns set unchanged) when t is already present.
+func addType(set, t []byte) ([]byte, bool) {
+	parts := bytes.Split(set, []byte{','})
+	i, found := slices.BinarySearchFunc(parts, t, bytes.Compare)
+	if found {
+		return set, false
+	}
+	return bytes.Join(slices.Insert(parts, i, t), []byte{','}), true
+}
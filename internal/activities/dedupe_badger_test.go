@@ -0,0 +1,105 @@
+package activities
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/yourorg/zone-names/internal/tracing"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+func writeShard(t *testing.T, content string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "shard-00.txt")
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + p
+}
+
+func dedupe(t *testing.T, p types.ShardDedupeParams) (types.ShardStats, string) {
+	t.Helper()
+	env, _ := newActivityEnv(t)
+	v, err := env.ExecuteActivity("Activities.ShardDedupeBadger", p)
+	if err != nil {
+		t.Fatalf("ShardDedupeBadger: %v", err)
+	}
+	var st types.ShardStats
+	if err := v.Get(&st); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(p.OutputURI[len("file://"):])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st, string(b)
+}
+
+func TestShardDedupeBadger(t *testing.T) {
+	in := writeShard(t, "www.example\nexample\nwww.example\na.example\nexample\n")
+	st, out := dedupe(t, types.ShardDedupeParams{ShardURI: in, OutputURI: in + ".sorted"})
+	if st.Total != 5 || st.Unique != 3 {
+		t.Fatalf("stats %+v", st)
+	}
+	if want := "a.example\nexample\nwww.example\n"; out != want {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestShardDedupeBadgerWithTypes(t *testing.T) {
+	in := writeShard(t, "www.example\tAAAA\nexample\tNS\nwww.example\tA\nwww.example\tAAAA\nexample\tSOA\n")
+	st, out := dedupe(t, types.ShardDedupeParams{ShardURI: in, OutputURI: in + ".sorted", WithTypes: true})
+	if st.Unique != 2 {
+		t.Fatalf("stats %+v", st)
+	}
+	if want := "example\tNS,SOA\nwww.example\tA,AAAA\n"; out != want {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestShardDedupeBadgerCanonical(t *testing.T) {
+	in := writeShard(t, "b.example\nab.example\nz.a.example\nexample\na.example\n")
+	_, out := dedupe(t, types.ShardDedupeParams{ShardURI: in, OutputURI: in + ".sorted", SortOrder: types.OrderCanonical})
+	if want := "example\na.example\nz.a.example\nab.example\nb.example\n"; out != want {
+		t.Fatalf("got %q want %q", out, want)
+	}
+}
+
+func TestShardDedupeBadgerSpans(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Install(sdktrace.NewSimpleSpanProcessor(exp), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	_, a := newActivityEnv(t)
+	in := writeShard(t, "b.example\na.example\nb.example\n")
+	ctx, parent := tracing.Start(context.Background(), "activity")
+	if _, err := a.ShardDedupeBadger(ctx, types.ShardDedupeParams{ShardURI: in, OutputURI: in + ".sorted"}); err != nil {
+		t.Fatal(err)
+	}
+	parent.End()
+
+	got := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range exp.GetSpans().Snapshots() {
+		got[s.Name()] = s
+	}
+	ingest, emit := got["dedupe.ingest"], got["dedupe.emit"]
+	if ingest == nil || emit == nil {
+		t.Fatalf("spans %v", got)
+	}
+	if ingest.Parent().SpanID() != parent.SpanContext().SpanID() || emit.StartTime().Before(ingest.EndTime()) {
+		t.Fatal("ingest and emit should be consecutive children of the activity span")
+	}
+	if !slices.Contains(emit.Attributes(), attribute.Int64("unique", 2)) {
+		t.Fatalf("emit attributes %v", emit.Attributes())
+	}
+}
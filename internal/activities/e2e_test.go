@@ -0,0 +1,219 @@
+package activities
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"go.temporal.io/sdk/testsuite"
+
+	"github.com/yourorg/zone-names/internal/s3test"
+	"github.com/yourorg/zone-names/internal/types"
+	"github.com/yourorg/zone-names/internal/zonegen"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata/golden")
+
+// e2eCases run StreamPartition -> ShardDedupeBadger -> MergeSortedAndWriteManifest
+// on a synthetic zone and compare names and manifest against testdata/golden/<name>.
+var e2eCases = []struct {
+	name   string
+	zone   zonegen.Config
+	params types.WorkflowParams
+}{
+	{
+		name:   "mixed",
+		zone:   zonegen.Config{Origin: "test", Names: 2000, Seed: 1, IDNShare: 0.1, DupShare: 0.2, Includes: 3},
+		params: types.WorkflowParams{Shards: 7, AllowInclude: true},
+	},
+	{
+		name:   "gzip-ns-ulabel",
+		zone:   zonegen.Config{Origin: "test", Names: 1000, Seed: 2, IDNShare: 0.3, DupShare: 0.1, Gzip: true},
+		params: types.WorkflowParams{Shards: 5, Filters: []string{"NS"}, IDNMode: "ulabel"},
+	},
+	{
+		name: "parts-canonical",
+		zone: zonegen.Config{Origin: "test", Names: 1500, Seed: 3, DupShare: 0.1},
+		params: types.WorkflowParams{
+			Shards:       4,
+			SortOrder:    types.OrderCanonical,
+			OutputLayout: types.OutputLayout{Mode: types.LayoutParts, PartMaxBytes: 8 << 10},
+		},
+	},
+}
+
+func TestEndToEndGolden(t *testing.T) {
+	for _, tc := range e2eCases {
+		t.Run(tc.name, func(t *testing.T) {
+			env, a := newActivityEnv(t)
+			work := t.TempDir()
+			zone, st, err := zonegen.Write(work, tc.zone)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p := tc.params
+			p.ZoneURI = "file://" + zone
+			p.OutputURI = "file://" + filepath.Join(work, "out", "names.txt")
+			p.ScratchSubdir = "e2e"
+			manURI := "file://" + filepath.Join(work, "out", "manifest.json")
+
+			man := runPipeline(t, env, a, p, manURI)
+			names := outputNames(t, man)
+
+			// Independent of the golden files: without filters or IDN
+			// conversion, the output is exactly the generator's name set.
+			if len(p.Filters) == 0 && p.IDNMode == "" && p.SortOrder == "" {
+				if want := strings.Join(st.Names, "\n") + "\n"; names != want {
+					t.Fatalf("names differ from generator (%d vs %d names)", strings.Count(names, "\n"), len(st.Names))
+				}
+			}
+
+			raw, _ := os.ReadFile(zone)
+			if man.Input.SHA256 != sha256Hex(string(raw)) || man.Input.Bytes != int64(len(raw)) {
+				t.Fatalf("input digest/size %+v", man.Input)
+			}
+			golden(t, filepath.Join("testdata", "golden", tc.name, "names.txt"), []byte(names))
+			golden(t, filepath.Join("testdata", "golden", tc.name, "manifest.json"), normalizeManifest(t, man, work))
+		})
+	}
+}
+
+// TestEndToEndS3 runs the pipeline with input, output and manifest on the
+// in-process S3 server, then checks that a rerun is skipped via the ETag.
+func TestEndToEndS3(t *testing.T) {
+	srv := s3test.NewServer(t)
+	srv.SetEnv(t)
+	work := t.TempDir()
+	zone, st, err := zonegen.Write(work, zonegen.Config{Origin: "test", Names: 500, Seed: 4, DupShare: 0.2, Gzip: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(zone)
+	if err := srv.PutObject("zones", "in/test.zone.gz", raw); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.CreateBucket("out"); err != nil {
+		t.Fatal(err)
+	}
+
+	env, a := newActivityEnv(t)
+	p := types.WorkflowParams{
+		ZoneURI:       "s3://zones/in/test.zone.gz",
+		OutputURI:     "s3://out/run/names.txt",
+		Shards:        3,
+		ScratchSubdir: "e2e-s3",
+	}
+	manURI := "s3://out/run/manifest.json"
+	man := runPipeline(t, env, a, p, manURI)
+	if man.Input.ETag == "" || man.Input.SHA256 != sha256Hex(string(raw)) {
+		t.Fatalf("input %+v", man.Input)
+	}
+	if got, want := readURI(t, p.OutputURI), strings.Join(st.Names, "\n")+"\n"; got != want {
+		t.Fatalf("names differ from generator (%d vs %d names)", strings.Count(got, "\n"), len(st.Names))
+	}
+
+	v, err := env.ExecuteActivity("Activities.CheckUnchanged", types.UnchangedParams{ZoneURI: p.ZoneURI, ManifestURI: manURI, Params: p})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var res types.UnchangedResult
+	_ = v.Get(&res)
+	if !res.Unchanged || res.Previous.Emitted != uint64(len(st.Names)) {
+		t.Fatalf("rerun not skipped: %+v", res)
+	}
+}
+
+// runPipeline runs partition, per-shard dedupe and merge as the workflow
+// would and returns the manifest written to manURI.
+func runPipeline(t *testing.T, env *testsuite.TestActivityEnvironment, a *Activities, p types.WorkflowParams, manURI string) types.Manifest {
+	t.Helper()
+	part := partition(t, env, a, p)
+	mp := types.MergeParams{
+		OutURI:      p.OutputURI,
+		ManifestURI: manURI,
+		Params:      p,
+		TotalSeen:   part.Records,
+		Input:       types.FileInfo{URI: p.ZoneURI, Bytes: part.SizeBytes, SHA256: part.InputHash, ETag: part.InputETag, Includes: part.Includes},
+	}
+	for _, shard := range part.ShardURIs {
+		dp := types.ShardDedupeParams{ShardURI: shard, OutputURI: shard + ".sorted", WithTypes: p.WantsRRTypes(), SortOrder: p.Order()}
+		v, err := env.ExecuteActivity("Activities.ShardDedupeBadger", dp)
+		if err != nil {
+			t.Fatalf("dedupe: %v", err)
+		}
+		var ss types.ShardStats
+		_ = v.Get(&ss)
+		mp.ShardStats = append(mp.ShardStats, ss)
+		mp.SortedShardURIs = append(mp.SortedShardURIs, dp.OutputURI)
+	}
+	if _, err := env.ExecuteActivity("Activities.MergeSortedAndWriteManifest", mp); err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+
+	var man types.Manifest
+	if err := json.Unmarshal([]byte(readURI(t, manURI)), &man); err != nil {
+		t.Fatal(err)
+	}
+	return man
+}
+
+// outputNames returns all names written, decompressing and joining parts.
+func outputNames(t *testing.T, man types.Manifest) string {
+	t.Helper()
+	if len(man.Parts) == 0 {
+		return readURI(t, man.Output.URI)
+	}
+	var all bytes.Buffer
+	for _, p := range man.Parts {
+		zr, err := zstd.NewReader(strings.NewReader(readURI(t, p.URI)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.Copy(&all, zr)
+		zr.Close()
+	}
+	return all.String()
+}
+
+// normalizeManifest strips everything that varies between runs: temp paths,
+// timings, worker identity and the input digest (gzip output is not stable
+// across Go releases; it is checked against the file separately).
+func normalizeManifest(t *testing.T, man types.Manifest, work string) []byte {
+	t.Helper()
+	man.Phases = types.PhaseTimings{}
+	man.CreatedAt = time.Time{}
+	man.Worker = ""
+	man.Input.SHA256, man.Input.Bytes = "$INPUT_SHA256", 0
+	b, err := json.MarshalIndent(man, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.ReplaceAll(b, []byte(work), []byte("$WORK"))
+}
+
+func golden(t *testing.T, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run with -update to create)", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s differs from golden; run `go test ./internal/activities -run EndToEnd -update` and review the diff", path)
+	}
+}
@@ -0,0 +1,112 @@
+package activities
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/miekg/dns"
+	tactivity "go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/temporal"
+
+	"github.com/yourorg/zone-names/internal/iopkg"
+	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// errInvalidParams is wrapped by errors caused by an activity's parameters
+// rather than by its environment.
+var errInvalidParams = errors.New("invalid parameters")
+
+func invalidParams(err error) error {
+	return fmt.Errorf("%w: %w", errInvalidParams, err)
+}
+
+// statusError is a webhook receiver's non-2xx response.
+type statusError struct {
+	url    string
+	status string
+	code   int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("notify: %s returned %s", e.url, e.status)
+}
+
+// classify turns errors that retrying can't fix into non-retryable
+// application errors with one of the types.ErrType* types, so the workflow
+// fails on the first attempt. Anything else (network errors, 5xx, timeouts,
+// cancellation) is returned unchanged and retried per the retry policy.
+func classify(err error) error {
+	var ae *temporal.ApplicationError
+	if err == nil || errors.As(err, &ae) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	var typ string
+	var pe *dns.ParseError
+	var se *statusError
+	switch {
+	case errors.Is(err, errInvalidParams), errors.Is(err, iopkg.ErrUnsupportedScheme):
+		typ = types.ErrTypeInvalidParams
+	case errors.As(err, &pe), errors.Is(err, gzip.ErrHeader), errors.Is(err, errBadInclude):
+		typ = types.ErrTypeInvalidInput
+	case errors.Is(err, errNoSpace):
+		typ = types.ErrTypeInsufficientSpace
+	case iopkg.IsPermission(err):
+		typ = types.ErrTypeAccessDenied
+	case iopkg.IsNotExist(err):
+		typ = types.ErrTypeNotFound
+	case errors.As(err, &se):
+		switch {
+		case se.code == 401 || se.code == 403:
+			typ = types.ErrTypeAccessDenied
+		case se.code == 404 || se.code == 410:
+			typ = types.ErrTypeNotFound
+		// 408 and 429 ask the sender to come back later.
+		case se.code/100 == 4 && se.code != 408 && se.code != 429:
+			typ = types.ErrTypeInvalidParams
+		}
+	}
+	if typ == "" {
+		return err
+	}
+	return temporal.NewNonRetryableApplicationError(err.Error(), typ, err)
+}
+
+// classified wraps an activity for registration so its errors go through
+// classify. Direct callers (cmd/zone-names) keep getting the plain errors.
+func classified[P, R any](f func(context.Context, P) (R, error)) func(context.Context, P) (R, error) {
+	return func(ctx context.Context, p P) (R, error) {
+		r, err := f(ctx, p)
+		err = classify(err)
+		countError(ctx, err)
+		return r, err
+	}
+}
+
+// classifiedErr is classified for activities without a result.
+func classifiedErr[P any](f func(context.Context, P) error) func(context.Context, P) error {
+	return func(ctx context.Context, p P) error {
+		err := classify(f(ctx, p))
+		countError(ctx, err)
+		return err
+	}
+}
+
+// countError counts a failed attempt in metrics.ActivityErrors, typed by its
+// ApplicationError type, or as retryable or canceled.
+func countError(ctx context.Context, err error) {
+	if err == nil || !tactivity.IsActivity(ctx) {
+		return
+	}
+	typ := "retryable"
+	var ae *temporal.ApplicationError
+	switch {
+	case errors.As(err, &ae) && ae.Type() != "":
+		typ = ae.Type()
+	case errors.Is(err, context.Canceled):
+		typ = "canceled"
+	}
+	znmetrics.ActivityErrors.WithLabelValues(tactivity.GetInfo(ctx).ActivityType.Name, typ).Inc()
+}
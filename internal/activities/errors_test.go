@@ -0,0 +1,98 @@
+package activities
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/smithy-go"
+	"github.com/miekg/dns"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.temporal.io/sdk/temporal"
+
+	"github.com/yourorg/zone-names/internal/iopkg"
+	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/types"
+	"github.com/yourorg/zone-names/internal/webhooktest"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string // "" means retryable
+	}{
+		{fmt.Errorf("open: %w", os.ErrNotExist), types.ErrTypeNotFound},
+		{&smithy.GenericAPIError{Code: "NoSuchBucket"}, types.ErrTypeNotFound},
+		{&smithy.GenericAPIError{Code: "AccessDenied"}, types.ErrTypeAccessDenied},
+		{fmt.Errorf("mkdir: %w", os.ErrPermission), types.ErrTypeAccessDenied},
+		{fmt.Errorf("open: %w", iopkg.ErrUnsupportedScheme), types.ErrTypeInvalidParams},
+		{invalidParams(errors.New("bad")), types.ErrTypeInvalidParams},
+		{&dns.ParseError{}, types.ErrTypeInvalidInput},
+		{fmt.Errorf("%w: x", errBadInclude), types.ErrTypeInvalidInput},
+		{&statusError{code: http.StatusForbidden}, types.ErrTypeAccessDenied},
+		{&statusError{code: http.StatusGone}, types.ErrTypeNotFound},
+		{&statusError{code: http.StatusBadRequest}, types.ErrTypeInvalidParams},
+		{&statusError{code: http.StatusTooManyRequests}, ""},
+		{&statusError{code: http.StatusBadGateway}, ""},
+		{&smithy.GenericAPIError{Code: "SlowDown"}, ""},
+		{io.ErrUnexpectedEOF, ""},
+	} {
+		err := classify(tc.err)
+		var ae *temporal.ApplicationError
+		switch {
+		case tc.want == "" && errors.As(err, &ae):
+			t.Errorf("%v: want retryable, got %v", tc.err, err)
+		case tc.want != "" && (!errors.As(err, &ae) || !ae.NonRetryable() || ae.Type() != tc.want):
+			t.Errorf("%v: want non-retryable %s, got %v", tc.err, tc.want, err)
+		}
+	}
+	if classify(nil) != nil {
+		t.Fatal("classify(nil) != nil")
+	}
+}
+
+// The registered activities fail fast; calling the methods directly still
+// returns the plain error.
+func TestRegisteredActivitiesClassify(t *testing.T) {
+	env, a := newActivityEnv(t)
+	notFound := znmetrics.ActivityErrors.WithLabelValues("Activities.StreamPartition", types.ErrTypeNotFound)
+	before := testutil.ToFloat64(notFound)
+	missing := "file://" + filepath.Join(t.TempDir(), "missing.zone")
+	p := types.WorkflowParams{ZoneURI: missing, ScratchSubdir: "wf"}
+	wantType := func(name string, err error, typ string) {
+		t.Helper()
+		var ae *temporal.ApplicationError
+		if !errors.As(err, &ae) || !ae.NonRetryable() || ae.Type() != typ {
+			t.Fatalf("%s: want non-retryable %s, got %v", name, typ, err)
+		}
+	}
+
+	_, err := env.ExecuteActivity("Activities.StreamPartition", p)
+	wantType("missing zone", err, types.ErrTypeNotFound)
+	if _, err := a.StreamPartition(context.Background(), p); !os.IsNotExist(err) {
+		t.Fatalf("direct call: got %v", err)
+	}
+	// Only the activity attempt is counted, not the direct call.
+	if got := testutil.ToFloat64(notFound); got != before+1 {
+		t.Fatalf("activity errors %v, want %v", got, before+1)
+	}
+
+	p.ZoneURI = "gs://zones/com.zone"
+	_, err = env.ExecuteActivity("Activities.StreamPartition", p)
+	wantType("unsupported scheme", err, types.ErrTypeInvalidParams)
+
+	_, err = env.ExecuteActivity("Activities.CleanupScratch", types.CleanupParams{ScratchSubdir: "../other"})
+	wantType("cleanup outside scratch", err, types.ErrTypeInvalidParams)
+
+	srv := webhooktest.NewServer(t, "")
+	srv.FailNext(1, http.StatusUnauthorized)
+	_, err = env.ExecuteActivity("Activities.Notify", types.NotifyParams{
+		Notify: types.Notify{URL: srv.URL}, Event: types.EventFailed, RunID: "r",
+	})
+	wantType("webhook 401", err, types.ErrTypeAccessDenied)
+}
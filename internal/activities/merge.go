@@ -5,93 +5,246 @@ import (
 	"container/heap"
 	"context"
 	"encoding/json"
+	"errors"
 	"io"
+	"path/filepath"
 	"strings"
 	"time"
 
-	"go.temporal.io/sdk/activity"
+	"go.opentelemetry.io/otel/attribute"
 
 	iopkg "github.com/yourorg/zone-names/internal/iopkg"
 	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/tracing"
 	"github.com/yourorg/zone-names/internal/types"
 )
 
 func (a *Activities) MergeSortedAndWriteManifest(ctx context.Context, p types.MergeParams) (types.MergeStats, error) {
-	type src struct {
-		r      *bufio.Reader
-		closer io.Closer
-		uri    string
-	}
-	readers := make([]src, 0, len(p.SortedShardURIs))
-	for _, u := range p.SortedShardURIs {
-		rc, err := iopkg.OpenReader(u)
-		if err != nil {
-			return types.MergeStats{}, err
+	started := time.Now().UTC()
+	zone := p.Params.ZoneLabel()
+	defer znmetrics.ObservePhase(zone, znmetrics.PhaseMerge, started)
+	// merge.names covers reading the shards and writing (and uploading) the
+	// output, merge.manifest the manifest.
+	mctx, span := tracing.Start(ctx, "merge.names", attribute.Int("shards", len(p.SortedShardURIs)), attribute.String("strategy", p.Params.Merge()))
+	nw, err := newNameWriter(mctx, p.OutURI, p.Params.Format(), p.Params.OutputLayout)
+	if err != nil {
+		tracing.End(span, err)
+		return types.MergeStats{}, err
+	}
+
+	emitted, err := mergeOrConcat(mctx, p.SortedShardURIs, p.Params, func(it item) error {
+		rec := nameRecord{Name: it.val}
+		if it.types != "" {
+			rec.RRTypes = strings.Split(it.types, ",")
 		}
-		readers = append(readers, src{r: bufio.NewReader(rc), closer: rc, uri: u})
+		return nw.Write(rec)
+	})
+	if err != nil {
+		if aerr := nw.Abort(ctx); aerr != nil {
+			logger(ctx).Warn("could not remove partial output", "output", p.OutURI, "error", aerr)
+		}
+		tracing.End(span, err)
+		return types.MergeStats{}, err
+	}
+
+	// The webhook (and its secret) is not part of the output's description.
+	p.Params.Notify = nil
+	if p.Shards == 0 {
+		p.Shards = len(p.ShardStats)
+	}
+	man := types.Manifest{
+		Version:     types.ManifestVersion,
+		Input:       p.Input,
+		ManifestURI: p.ManifestURI,
+		Params:      p.Params,
+		TotalSeen:   p.TotalSeen,
+		Unique:      emitted,
+		Shards:      p.Shards,
+		SplitShards: p.SplitShards,
+		ShardStats:  p.ShardStats,
+		Phases:      p.Phases,
+		Worker:      a.cfg.Identity,
+	}
+	err = nw.Close(&man)
+	span.SetAttributes(attribute.Int64("names", int64(emitted)), attribute.Int64("bytes", man.Output.Bytes))
+	tracing.End(span, err)
+	if err != nil {
+		return types.MergeStats{}, err
+	}
+	man.Phases.Merge = types.PhaseTiming{StartedAt: started, FinishedAt: time.Now().UTC(), Worker: a.cfg.Identity}
+	man.CreatedAt = man.Phases.Merge.FinishedAt
+	mctx, span = tracing.Start(ctx, "merge.manifest")
+	err = writeManifest(mctx, p.ManifestURI, man)
+	tracing.End(span, err)
+	if err != nil {
+		return types.MergeStats{}, err
 	}
 
-	out, outCloser, err := iopkg.CreateWriter(p.OutURI)
+	// metrics
+	znmetrics.MergedEmitted.WithLabelValues(zone).Add(float64(emitted))
+	znmetrics.BytesWritten.WithLabelValues(zone, znmetrics.PhaseMerge).Add(float64(man.Output.Bytes))
+	if p.TotalSeen > 0 {
+		znmetrics.DedupeRatio.WithLabelValues(zone).Set(float64(emitted) / float64(p.TotalSeen))
+	}
+	logger(ctx).Info("wrote output and manifest", "output", p.OutURI, "manifest", p.ManifestURI, "unique", emitted)
+	return types.MergeStats{Emitted: emitted}, nil
+}
+
+// MergeShards merges a group of sorted shards into one sorted intermediate
+// file in the same line format, for the hierarchical merge strategy.
+func (a *Activities) MergeShards(ctx context.Context, p types.MergeShardsParams) (types.MergeStats, error) {
+	defer znmetrics.ObservePhase(p.Zone, znmetrics.PhaseMergeShards, time.Now())
+	out, closer, err := iopkg.CreateWriter(ctx, p.OutputURI)
 	if err != nil {
 		return types.MergeStats{}, err
 	}
-	defer outCloser.Close()
-	bw := bufio.NewWriter(out)
+	defer closer.Close()
+	bw := bufio.NewWriterSize(out, 1<<20)
+	// Intermediate files go to scratch; the zero guard never fails.
+	var space spaceGuard
+	if path, ok := strings.CutPrefix(p.OutputURI, "file://"); ok {
+		space = a.guard(filepath.Dir(path))
+	}
+	var written uint64
+	n, err := mergeSorted(ctx, p.ShardURIs, p.SortOrder, func(it item) error {
+		if err := space.check(written); err != nil {
+			return err
+		}
+		written++
+		line := it.val
+		if it.types != "" {
+			line += "\t" + it.types
+		}
+		_, err := bw.WriteString(line + "\n")
+		return err
+	})
+	if err != nil {
+		return types.MergeStats{}, err
+	}
+	if err := bw.Flush(); err != nil {
+		return types.MergeStats{}, err
+	}
+	if err := closer.Close(); err != nil {
+		return types.MergeStats{}, err
+	}
+	logger(ctx).Debug("merged shard group", "shards", len(p.ShardURIs), "output", p.OutputURI, "names", n)
+	return types.MergeStats{Emitted: n}, nil
+}
+
+func mergeOrConcat(ctx context.Context, uris []string, p types.WorkflowParams, emit func(item) error) (uint64, error) {
+	switch p.Merge() {
+	case types.MergeSingle, types.MergeHierarchical:
+		// In hierarchical mode the workflow has already reduced uris to a
+		// handful of pre-merged files; the final pass is the same k-way merge.
+		return mergeSorted(ctx, uris, p.Order(), emit)
+	case types.MergeConcat:
+		return concatSorted(ctx, uris, emit)
+	default:
+		return 0, errors.New("unsupported merge strategy: " + p.MergeStrategy)
+	}
+}
+
+// mergeSorted k-way merges sorted shard files and calls emit once per
+// distinct name, in order. It returns the number of names emitted.
+func mergeSorted(ctx context.Context, uris []string, order string, emit func(item) error) (uint64, error) {
+	readers := make([]*bufio.Reader, 0, len(uris))
+	for _, u := range uris {
+		rc, err := iopkg.OpenReader(ctx, u)
+		if err != nil {
+			return 0, err
+		}
+		defer rc.Close()
+		readers = append(readers, bufio.NewReader(rc))
+	}
 
 	h := &minHeap{}
 	heap.Init(h)
 	for i := range readers {
-		if s, ok := readLine(readers[i].r); ok {
-			heap.Push(h, item{val: s, i: i})
+		if s, ok := readLine(readers[i]); ok {
+			heap.Push(h, newItem(order, s, i))
 		}
 	}
 
 	var last string
-	var emitted uint64
-	const hbEvery = 50000
+	var emitted, popped uint64
 	for h.Len() > 0 {
+		if err := canceled(ctx, popped); err != nil {
+			return 0, err
+		}
+		popped++
 		it := heap.Pop(h).(item)
 		if it.val != last {
-			if _, err := bw.WriteString(it.val + "\n"); err != nil {
-				return types.MergeStats{}, err
+			if err := emit(it); err != nil {
+				return 0, err
 			}
 			last = it.val
 			emitted++
-			if emitted%hbEvery == 0 {
-				activity.RecordHeartbeat(ctx, emitted)
+			if emitted%mergeHBEvery == 0 {
+				heartbeat(ctx, emitted)
 			}
 		}
-		if s, ok := readLine(readers[it.i].r); ok {
-			heap.Push(h, item{val: s, i: it.i})
+		if s, ok := readLine(readers[it.i]); ok {
+			heap.Push(h, newItem(order, s, it.i))
 		}
 	}
-	if err := bw.Flush(); err != nil {
-		return types.MergeStats{}, err
-	}
-	for _, s := range readers {
-		_ = s.closer.Close()
+	return emitted, nil
+}
+
+// concatSorted streams shard files one after another. Shards are disjoint, so
+// no dedupe is needed, but the result is only sorted within each shard.
+func concatSorted(ctx context.Context, uris []string, emit func(item) error) (uint64, error) {
+	var emitted uint64
+	for i, u := range uris {
+		rc, err := iopkg.OpenReader(ctx, u)
+		if err != nil {
+			return 0, err
+		}
+		r := bufio.NewReader(rc)
+		for {
+			if err := canceled(ctx, emitted); err != nil {
+				_ = rc.Close()
+				return 0, err
+			}
+			s, ok := readLine(r)
+			if !ok {
+				break
+			}
+			if err := emit(newItem(types.OrderBytes, s, i)); err != nil {
+				_ = rc.Close()
+				return 0, err
+			}
+			emitted++
+			if emitted%mergeHBEvery == 0 {
+				heartbeat(ctx, emitted)
+			}
+		}
+		_ = rc.Close()
 	}
+	return emitted, nil
+}
+
+const mergeHBEvery = 50000
 
-	// manifest
-	man := map[string]any{
-		"output":      p.OutURI,
-		"manifest":    p.ManifestURI,
-		"params":      p.Params,
-		"total_seen":  p.TotalSeen,
-		"shard_stats": p.ShardStats,
-		"unique":      emitted,
-		"started_at":  time.Now().UTC().Format(time.RFC3339),
+func writeManifest(ctx context.Context, uri string, man types.Manifest) error {
+	mb, err := json.MarshalIndent(man, "", "  ")
+	if err != nil {
+		return err
+	}
+	mw, cw, err := iopkg.CreateWriter(ctx, uri)
+	if err != nil {
+		return err
 	}
-	mb, _ := json.MarshalIndent(man, "", "  ")
-	mw, cw, err := iopkg.CreateWriter(p.ManifestURI)
-	if err == nil {
-		_, _ = mw.Write(mb)
+	if _, err := mw.Write(mb); err != nil {
 		_ = cw.Close()
+		return err
 	}
+	return cw.Close()
+}
 
-	// metrics
-	znmetrics.MergedEmitted.Add(float64(emitted))
-	return types.MergeStats{Emitted: emitted}, nil
+func readManifest(ctx context.Context, uri string) (types.Manifest, error) {
+	var man types.Manifest
+	err := iopkg.ReadJSON(ctx, uri, &man)
+	return man, err
 }
 
 func readLine(r *bufio.Reader) (string, bool) {
@@ -107,12 +260,20 @@ func readLine(r *bufio.Reader) (string, bool) {
 
 type minHeap []item
 type item struct {
-	val string
-	i   int
+	key   string // sortKey of val; heap order
+	val   string
+	types string // comma-separated RR types, when the shard carries them
+	i     int
+}
+
+// newItem splits a sorted shard line ("name" or "name<TAB>types").
+func newItem(order, line string, i int) item {
+	name, types, _ := strings.Cut(line, "\t")
+	return item{key: sortKey(order, name), val: name, types: types, i: i}
 }
 
 func (h minHeap) Len() int           { return len(h) }
-func (h minHeap) Less(i, j int) bool { return h[i].val < h[j].val }
+func (h minHeap) Less(i, j int) bool { return h[i].key < h[j].key }
 func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
 func (h *minHeap) Push(x any)        { *h = append(*h, x.(item)) }
 func (h *minHeap) Pop() any          { old := *h; n := len(old); x := old[n-1]; *h = old[:n-1]; return x }
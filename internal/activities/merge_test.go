@@ -0,0 +1,372 @@
+package activities
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/parquet-go/parquet-go"
+
+	iopkg "github.com/yourorg/zone-names/internal/iopkg"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// sortedShards writes each string as a sorted shard file and returns their URIs.
+func sortedShards(t *testing.T, shards ...string) []string {
+	t.Helper()
+	dir := t.TempDir()
+	uris := make([]string, len(shards))
+	for i, s := range shards {
+		p := filepath.Join(dir, "shard-"+two(i)+".txt.sorted")
+		if err := os.WriteFile(p, []byte(s), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		uris[i] = "file://" + p
+	}
+	return uris
+}
+
+func merge(t *testing.T, shards []string, params types.WorkflowParams) (types.MergeStats, types.Manifest) {
+	t.Helper()
+	env, _ := newActivityEnv(t)
+	dir := t.TempDir()
+	if params.OutputURI == "" {
+		params.OutputURI = "file://" + filepath.Join(dir, "names.txt")
+	}
+	mp := types.MergeParams{
+		SortedShardURIs: shards,
+		OutURI:          params.OutputURI,
+		ManifestURI:     "file://" + filepath.Join(dir, "manifest.json"),
+		Params:          params,
+		TotalSeen:       99,
+		Input:           types.FileInfo{URI: "file:///zones/example.zone", Bytes: 10, SHA256: "in"},
+	}
+	v, err := env.ExecuteActivity("Activities.MergeSortedAndWriteManifest", mp)
+	if err != nil {
+		t.Fatalf("MergeSortedAndWriteManifest: %v", err)
+	}
+	var ms types.MergeStats
+	if err := v.Get(&ms); err != nil {
+		t.Fatal(err)
+	}
+	b, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var man types.Manifest
+	if err := json.Unmarshal(b, &man); err != nil {
+		t.Fatal(err)
+	}
+	return ms, man
+}
+
+func readURI(t *testing.T, uri string) string {
+	t.Helper()
+	rc, err := iopkg.OpenReader(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	b, err := io.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestMergeSingle(t *testing.T) {
+	shards := sortedShards(t, "a.example\nc.example\n", "b.example\nd.example\n", "")
+	ms, man := merge(t, shards, types.WorkflowParams{})
+	if ms.Emitted != 4 {
+		t.Fatalf("emitted %d", ms.Emitted)
+	}
+	out := readURI(t, man.Output.URI)
+	if out != "a.example\nb.example\nc.example\nd.example\n" {
+		t.Fatalf("output %q", out)
+	}
+	if man.Version != types.ManifestVersion || man.Unique != 4 || man.TotalSeen != 99 || man.Input.SHA256 != "in" || man.Shards != len(man.ShardStats) {
+		t.Fatalf("manifest %+v", man)
+	}
+	if man.Output.Bytes != int64(len(out)) || man.Output.SHA256 != sha256Hex(out) {
+		t.Fatalf("output info %+v", man.Output)
+	}
+	if man.Worker != "test-worker" || man.Phases.Merge.StartedAt.IsZero() || man.CreatedAt.IsZero() {
+		t.Fatalf("worker/timing %+v", man)
+	}
+}
+
+// TestMergeManifestRecordsRun checks that the manifest carries what the
+// workflow passes through from earlier phases, and that a rerun overwrites it.
+func TestMergeManifestRecordsRun(t *testing.T) {
+	env, _ := newActivityEnv(t)
+	dir := t.TempDir()
+	start := time.Date(2024, 5, 2, 6, 0, 0, 0, time.UTC)
+	mp := types.MergeParams{
+		SortedShardURIs: sortedShards(t, "a.example\n", "b.example\n"),
+		OutURI:          "file://" + filepath.Join(dir, "names.txt"),
+		ManifestURI:     "file://" + filepath.Join(dir, "manifest.json"),
+		Params:          types.WorkflowParams{Filters: []string{"NS"}},
+		ShardStats:      []types.ShardStats{{Total: 3, Unique: 1}, {Total: 2, Unique: 1}},
+		TotalSeen:       5,
+		Input:           types.FileInfo{URI: "file:///zones/example.zone", Bytes: 10, SHA256: "in"},
+		Phases: types.PhaseTimings{
+			Partition: types.PhaseTiming{StartedAt: start, FinishedAt: start.Add(time.Minute), Worker: "w1"},
+			Dedupe:    types.PhaseTiming{StartedAt: start.Add(time.Minute), FinishedAt: start.Add(2 * time.Minute)},
+		},
+	}
+	for run := 0; run < 2; run++ {
+		if _, err := env.ExecuteActivity("Activities.MergeSortedAndWriteManifest", mp); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+		mp.TotalSeen++
+	}
+	man, err := readManifest(context.Background(), mp.ManifestURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if man.ManifestURI != mp.ManifestURI || man.TotalSeen != 6 || man.Shards != 2 || len(man.ShardStats) != 2 || man.ShardStats[0].Total != 3 {
+		t.Fatalf("manifest %+v", man)
+	}
+	if man.Phases.Partition != mp.Phases.Partition || man.Phases.Dedupe != mp.Phases.Dedupe {
+		t.Fatalf("phases %+v", man.Phases)
+	}
+	if m := man.Phases.Merge; m.Worker != "test-worker" || m.FinishedAt.Before(m.StartedAt) || !man.CreatedAt.Equal(m.FinishedAt) {
+		t.Fatalf("merge timing %+v, created %v", m, man.CreatedAt)
+	}
+	if len(man.Params.Filters) != 1 || man.Params.Filters[0] != "NS" {
+		t.Fatalf("params %+v", man.Params)
+	}
+}
+
+func TestMergeCanonicalOrder(t *testing.T) {
+	shards := sortedShards(t, "example\nz.a.example\n", "a.example\nb.example\n")
+	_, man := merge(t, shards, types.WorkflowParams{SortOrder: types.OrderCanonical})
+	if out := readURI(t, man.Output.URI); out != "example\na.example\nz.a.example\nb.example\n" {
+		t.Fatalf("output %q", out)
+	}
+}
+
+func TestMergeConcat(t *testing.T) {
+	shards := sortedShards(t, "c.example\nd.example\n", "a.example\n")
+	_, man := merge(t, shards, types.WorkflowParams{MergeStrategy: types.MergeConcat})
+	if out := readURI(t, man.Output.URI); out != "c.example\nd.example\na.example\n" {
+		t.Fatalf("output %q", out)
+	}
+}
+
+func TestMergeParts(t *testing.T) {
+	shards := sortedShards(t, "a.example\nc.example\ne.example\n", "b.example\nd.example\n")
+	// 10 bytes per name: every part closes after two names.
+	_, man := merge(t, shards, types.WorkflowParams{OutputLayout: types.OutputLayout{Mode: types.LayoutParts, PartMaxBytes: 20}})
+	if len(man.Parts) != 3 {
+		t.Fatalf("parts %+v", man.Parts)
+	}
+	want := []struct{ first, last, body string }{
+		{"a.example", "b.example", "a.example\nb.example\n"},
+		{"c.example", "d.example", "c.example\nd.example\n"},
+		{"e.example", "e.example", "e.example\n"},
+	}
+	for i, p := range man.Parts {
+		if !strings.HasSuffix(p.URI, "/names-0000"+string(rune('0'+i))+".txt.zst") {
+			t.Fatalf("part %d uri %s", i, p.URI)
+		}
+		if p.First != want[i].first || p.Last != want[i].last {
+			t.Fatalf("part %d range %s..%s", i, p.First, p.Last)
+		}
+		stored := readURI(t, p.URI)
+		if p.SHA256 != sha256Hex(stored) || p.Bytes != int64(len(stored)) {
+			t.Fatalf("part %d digest/size", i)
+		}
+		zr, err := zstd.NewReader(strings.NewReader(stored))
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, _ := io.ReadAll(zr)
+		zr.Close()
+		if string(b) != want[i].body {
+			t.Fatalf("part %d body %q", i, b)
+		}
+	}
+}
+
+// TestMergePartsUncompressed checks uncompressed parts, that an output
+// ending exactly on a part boundary gets no empty last part, and part names
+// for an output not called names.txt.
+func TestMergePartsUncompressed(t *testing.T) {
+	shards := sortedShards(t, "a.example\nc.example\n", "b.example\nd.example\n")
+	out := "file://" + filepath.Join(t.TempDir(), "com.txt")
+	layout := types.OutputLayout{Mode: types.LayoutParts, PartMaxBytes: 20, Compression: "none"}
+	ms, man := merge(t, shards, types.WorkflowParams{OutputURI: out, OutputLayout: layout})
+	if ms.Emitted != 4 || len(man.Parts) != 2 {
+		t.Fatalf("emitted %d, parts %+v", ms.Emitted, man.Parts)
+	}
+	var total int64
+	for i, p := range man.Parts {
+		if want := fmt.Sprintf("%s-%05d.txt", strings.TrimSuffix(out, ".txt"), i); p.URI != want {
+			t.Fatalf("part %d uri %s, want %s", i, p.URI, want)
+		}
+		if body := readURI(t, p.URI); p.Count != 2 || p.Bytes != int64(len(body)) || p.SHA256 != sha256Hex(body) {
+			t.Fatalf("part %d %+v, body %q", i, p, body)
+		}
+		total += p.Bytes
+	}
+	if man.Output.URI != out || man.Output.Bytes != total || man.Output.SHA256 != "" {
+		t.Fatalf("output summary %+v", man.Output)
+	}
+	if _, err := os.Stat(strings.TrimPrefix(out, "file://")); !os.IsNotExist(err) {
+		t.Fatalf("parts layout wrote a single output too: %v", err)
+	}
+}
+
+func TestMergeParquet(t *testing.T) {
+	shards := sortedShards(t, "example\tNS,SOA\nxn--bcher-kva.example\tNS\n", "www.example\tA,AAAA\n")
+	dir := t.TempDir()
+	out := filepath.Join(dir, "names.parquet")
+	_, man := merge(t, shards, types.WorkflowParams{OutputURI: "file://" + out, OutputFormat: types.FormatParquet})
+	rows, err := parquet.ReadFile[parquetRow](out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 3 || man.Unique != 3 {
+		t.Fatalf("rows %+v", rows)
+	}
+	www := rows[1]
+	if www.Name != "www.example" || www.TLD != "example" || www.SLD != "www" || www.LabelLength != 3 || www.IDN {
+		t.Fatalf("www row %+v", www)
+	}
+	if strings.Join(www.RRTypes, ",") != "A,AAAA" {
+		t.Fatalf("www types %q", www.RRTypes)
+	}
+	if idn := rows[2]; !idn.IDN || idn.SLD != "xn--bcher-kva" {
+		t.Fatalf("idn row %+v", idn)
+	}
+	if apex := rows[0]; apex.SLD != "" || apex.LabelLength != 0 {
+		t.Fatalf("apex row %+v", apex)
+	}
+}
+
+// TestMergeParquetParts checks Parquet in the parts layout, and that shards
+// without RR types give empty rr_types.
+func TestMergeParquetParts(t *testing.T) {
+	shards := sortedShards(t, "a.example\nc.example\n", "b.example\n")
+	out := "file://" + filepath.Join(t.TempDir(), "names.parquet")
+	layout := types.OutputLayout{Mode: types.LayoutParts, PartMaxBytes: 20}
+	_, man := merge(t, shards, types.WorkflowParams{OutputURI: out, OutputFormat: types.FormatParquet, OutputLayout: layout})
+	if len(man.Parts) != 2 {
+		t.Fatalf("parts %+v", man.Parts)
+	}
+	var names []string
+	for i, p := range man.Parts {
+		if !strings.HasSuffix(p.URI, fmt.Sprintf("/names-%05d.parquet", i)) {
+			t.Fatalf("part %d uri %s", i, p.URI)
+		}
+		rows, err := parquet.ReadFile[parquetRow](strings.TrimPrefix(p.URI, "file://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint64(len(rows)) != p.Count || rows[0].Name != p.First || rows[len(rows)-1].Name != p.Last {
+			t.Fatalf("part %d: %d rows for %+v", i, len(rows), p)
+		}
+		for _, r := range rows {
+			if len(r.RRTypes) != 0 {
+				t.Fatalf("row %+v has RR types", r)
+			}
+			names = append(names, r.Name)
+		}
+	}
+	if strings.Join(names, ",") != "a.example,b.example,c.example" {
+		t.Fatalf("names %q", names)
+	}
+}
+
+// TestMergeFailureRemovesOutput checks that a failed merge leaves no
+// truncated output behind for a later unchanged check to trust.
+func TestMergeFailureRemovesOutput(t *testing.T) {
+	env, _ := newActivityEnv(t)
+	dir := t.TempDir()
+	out := filepath.Join(dir, "names.txt")
+	_ = os.WriteFile(out, []byte("previous.example\n"), 0o644)
+	shards := append(sortedShards(t, "a.example\n"), "file://"+filepath.Join(dir, "missing.sorted"))
+	mp := types.MergeParams{
+		SortedShardURIs: shards,
+		OutURI:          "file://" + out,
+		ManifestURI:     "file://" + filepath.Join(dir, "manifest.json"),
+		Params:          types.WorkflowParams{OutputURI: "file://" + out},
+	}
+	if _, err := env.ExecuteActivity("Activities.MergeSortedAndWriteManifest", mp); err == nil {
+		t.Fatal("merge of a missing shard succeeded")
+	}
+	for _, p := range []string{out, filepath.Join(dir, "manifest.json")} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s left behind: %v", filepath.Base(p), err)
+		}
+	}
+}
+
+func TestMergeShards(t *testing.T) {
+	env, _ := newActivityEnv(t)
+	shards := sortedShards(t, "a.example\tA\nc.example\tNS\n", "b.example\tMX\n")
+	out := "file://" + filepath.Join(t.TempDir(), "merge-0-000.sorted")
+	if _, err := env.ExecuteActivity("Activities.MergeShards", types.MergeShardsParams{ShardURIs: shards, OutputURI: out}); err != nil {
+		t.Fatalf("MergeShards: %v", err)
+	}
+	if got := readURI(t, out); got != "a.example\tA\nb.example\tMX\nc.example\tNS\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+// TestMergeHierarchicalMatchesSingle checks that reducing shards in groups
+// with MergeShards and merging the intermediates gives the same bytes as one
+// single-pass merge.
+func TestMergeHierarchicalMatchesSingle(t *testing.T) {
+	names := []string{
+		"a.example\nf.example\n", "b.example\ng.example\n", "c.example\n",
+		"d.example\nh.example\n", "e.example\n",
+	}
+	_, single := merge(t, sortedShards(t, names...), types.WorkflowParams{})
+
+	env, _ := newActivityEnv(t)
+	shards := sortedShards(t, names...)
+	dir := t.TempDir()
+	var level []string
+	for i := 0; i < len(shards); i += 2 {
+		out := "file://" + filepath.Join(dir, "merge-0-"+two(i/2)+".sorted")
+		group := shards[i:min(i+2, len(shards))]
+		if _, err := env.ExecuteActivity("Activities.MergeShards", types.MergeShardsParams{ShardURIs: group, OutputURI: out}); err != nil {
+			t.Fatalf("MergeShards: %v", err)
+		}
+		level = append(level, out)
+	}
+	_, hier := merge(t, level, types.WorkflowParams{MergeStrategy: types.MergeHierarchical})
+
+	if got, want := readURI(t, hier.Output.URI), readURI(t, single.Output.URI); got != want {
+		t.Fatalf("hierarchical %q, single %q", got, want)
+	}
+	if hier.Output.SHA256 != single.Output.SHA256 || hier.Unique != single.Unique {
+		t.Fatalf("hierarchical %+v, single %+v", hier.Output, single.Output)
+	}
+}
+
+func TestMergeUnsupportedStrategy(t *testing.T) {
+	env, _ := newActivityEnv(t)
+	dir := t.TempDir()
+	_, err := env.ExecuteActivity("Activities.MergeSortedAndWriteManifest", types.MergeParams{
+		SortedShardURIs: sortedShards(t, "a.example\n"),
+		OutURI:          "file://" + filepath.Join(dir, "names.txt"),
+		ManifestURI:     "file://" + filepath.Join(dir, "manifest.json"),
+		Params:          types.WorkflowParams{MergeStrategy: "bogus"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "unsupported merge strategy") {
+		t.Fatalf("err %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "names.txt")); !os.IsNotExist(err) {
+		t.Fatalf("partial output left behind: %v", err)
+	}
+}
@@ -0,0 +1,87 @@
+package activities
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// defaultNotifyClient is used when Config.HTTPClient is nil.
+var defaultNotifyClient = &http.Client{Timeout: 30 * time.Second}
+
+// Notify posts a types.Notification for a finished run to p.Notify.URL. Any
+// response other than 2xx is an error; Temporal retries the delivery unless
+// the receiver rejected it with a 4xx (other than 408 and 429).
+func (a *Activities) Notify(ctx context.Context, p types.NotifyParams) error {
+	n := types.Notification{
+		Event:       p.Event,
+		WorkflowID:  p.WorkflowID,
+		RunID:       p.RunID,
+		ZoneURI:     p.ZoneURI,
+		OutputURI:   p.OutputURI,
+		ManifestURI: p.ManifestURI,
+		Error:       p.Error,
+	}
+	if p.Event != types.EventFailed {
+		man, err := readManifest(ctx, p.ManifestURI)
+		if err != nil {
+			return fmt.Errorf("notify: read manifest: %w", err)
+		}
+		n.Summary = &types.ManifestSummary{
+			Input:     man.Input,
+			Output:    man.Output,
+			Parts:     len(man.Parts),
+			TotalSeen: man.TotalSeen,
+			Unique:    man.Unique,
+			CreatedAt: man.CreatedAt,
+		}
+	}
+	n.SentAt = time.Now().UTC()
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Notify.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(types.EventHeader, p.Event)
+	req.Header.Set(types.DeliveryHeader, p.RunID+"/"+p.Event)
+	if p.Notify.Secret != "" {
+		req.Header.Set(types.SignatureHeader, sign(p.Notify.Secret, body))
+	}
+	client := a.cfg.HTTPClient
+	if client == nil {
+		client = defaultNotifyClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		logger(ctx).Warn("webhook rejected", "event", p.Event, "url", p.Notify.URL, "status", resp.Status)
+		return &statusError{url: p.Notify.URL, status: resp.Status, code: resp.StatusCode}
+	}
+	logger(ctx).Info("webhook delivered", "event", p.Event, "url", p.Notify.URL)
+	return nil
+}
+
+// sign returns the SignatureHeader value for body.
+func sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
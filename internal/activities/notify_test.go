@@ -0,0 +1,89 @@
+package activities
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/zone-names/internal/types"
+	"github.com/yourorg/zone-names/internal/webhooktest"
+)
+
+func TestNotifySucceeded(t *testing.T) {
+	hook := webhooktest.NewServer(t, "s3cret")
+	params := types.WorkflowParams{Notify: &types.Notify{URL: hook.URL, Secret: "s3cret"}}
+	_, man := merge(t, sortedShards(t, "a.example\nb.example\n"), params)
+	if man.Params.Notify != nil {
+		t.Fatalf("webhook settings written to the manifest: %+v", man.Params.Notify)
+	}
+
+	env, _ := newActivityEnv(t)
+	np := types.NotifyParams{
+		Notify:      *params.Notify,
+		Event:       types.EventSucceeded,
+		WorkflowID:  "wf",
+		RunID:       "run-1",
+		ZoneURI:     man.Input.URI,
+		OutputURI:   man.Output.URI,
+		ManifestURI: man.ManifestURI,
+	}
+	if _, err := env.ExecuteActivity("Activities.Notify", np); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	ds := hook.Deliveries()
+	if len(ds) != 1 {
+		t.Fatalf("%d deliveries", len(ds))
+	}
+	d := ds[0]
+	if !d.SignatureOK || d.Header.Get(types.EventHeader) != types.EventSucceeded || d.Header.Get(types.DeliveryHeader) != "run-1/succeeded" {
+		t.Fatalf("headers %v", d.Header)
+	}
+	n := d.Notification
+	if n.WorkflowID != "wf" || n.OutputURI != man.Output.URI || n.Summary == nil || n.Summary.Unique != 2 ||
+		n.Summary.Output.SHA256 != man.Output.SHA256 || n.SentAt.IsZero() {
+		t.Fatalf("notification %+v", n)
+	}
+}
+
+func TestNotifyFailed(t *testing.T) {
+	hook := webhooktest.NewServer(t, "")
+	env, _ := newActivityEnv(t)
+	np := types.NotifyParams{
+		Notify:      types.Notify{URL: hook.URL},
+		Event:       types.EventFailed,
+		RunID:       "run-1",
+		ManifestURI: "file:///nonexistent/manifest.json", // not read for failures
+		Error:       "partition: zone not found",
+	}
+	if _, err := env.ExecuteActivity("Activities.Notify", np); err != nil {
+		t.Fatalf("notify: %v", err)
+	}
+	d := hook.Deliveries()[0]
+	if d.Header.Get(types.SignatureHeader) != "" || d.Notification.Error != np.Error || d.Notification.Summary != nil {
+		t.Fatalf("delivery %+v", d)
+	}
+}
+
+func TestNotifyErrors(t *testing.T) {
+	hook := webhooktest.NewServer(t, "")
+	env, _ := newActivityEnv(t)
+	np := types.NotifyParams{Notify: types.Notify{URL: hook.URL}, Event: types.EventFailed}
+
+	hook.FailNext(1, http.StatusServiceUnavailable)
+	if _, err := env.ExecuteActivity("Activities.Notify", np); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Fatalf("want 503 error, got %v", err)
+	}
+	if _, err := env.ExecuteActivity("Activities.Notify", np); err != nil {
+		t.Fatalf("retry: %v", err)
+	}
+
+	// A success event needs the manifest for its summary.
+	np.Event = types.EventSucceeded
+	np.ManifestURI = "file://" + t.TempDir() + "/manifest.json"
+	if _, err := env.ExecuteActivity("Activities.Notify", np); err == nil || !strings.Contains(err.Error(), "read manifest") {
+		t.Fatalf("want manifest error, got %v", err)
+	}
+	if n := len(hook.Deliveries()); n != 2 {
+		t.Fatalf("%d deliveries", n)
+	}
+}
@@ -0,0 +1,32 @@
+package activities
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// sortKey maps a name to a string whose plain byte order matches the
+// requested name order. For canonical order the labels are reversed and
+// joined with NUL, which sorts below every label byte, so a parent sorts
+// before its children and "z.a.example" before "ab.example" as RFC 4034
+// §6.1 requires. Names are already lowercased by StreamPartition.
+func sortKey(order, name string) string {
+	if order != types.OrderCanonical {
+		return name
+	}
+	labels := strings.Split(name, ".")
+	slices.Reverse(labels)
+	return strings.Join(labels, "\x00")
+}
+
+// nameFromKey inverts sortKey.
+func nameFromKey(order, key string) string {
+	if order != types.OrderCanonical {
+		return key
+	}
+	labels := strings.Split(key, "\x00")
+	slices.Reverse(labels)
+	return strings.Join(labels, ".")
+}
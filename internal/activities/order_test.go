@@ -0,0 +1,43 @@
+package activities
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+func TestCanonicalOrder(t *testing.T) {
+	// RFC 4034 §6.1 example, lowercased and without the escaped labels.
+	want := []string{
+		"example",
+		"a.example",
+		"yljkjljk.a.example",
+		"z.a.example",
+		"zabc.a.example",
+		"z.example",
+	}
+	got := slices.Clone(want)
+	slices.Reverse(got)
+	slices.SortFunc(got, func(a, b string) int {
+		return strings.Compare(sortKey(types.OrderCanonical, a), sortKey(types.OrderCanonical, b))
+	})
+	if !slices.Equal(got, want) {
+		t.Fatalf("order:\n got %q\nwant %q", got, want)
+	}
+	for _, n := range want {
+		if back := nameFromKey(types.OrderCanonical, sortKey(types.OrderCanonical, n)); back != n {
+			t.Fatalf("round trip %q -> %q", n, back)
+		}
+	}
+}
+
+func TestBytesOrderIsIdentity(t *testing.T) {
+	if k := sortKey(types.OrderBytes, "a.example"); k != "a.example" {
+		t.Fatalf("key %q", k)
+	}
+	if k := sortKey("", "a.example"); k != "a.example" {
+		t.Fatalf("default key %q", k)
+	}
+}
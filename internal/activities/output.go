@@ -0,0 +1,246 @@
+package activities
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+
+	iopkg "github.com/yourorg/zone-names/internal/iopkg"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// nameRecord is one merged output row.
+type nameRecord struct {
+	Name    string
+	RRTypes []string // nil unless the pipeline carried RR types
+}
+
+// nameWriter receives merged names in output order.
+type nameWriter interface {
+	Write(rec nameRecord) error
+	// Close flushes and uploads everything written and records the output
+	// locations, sizes and checksums in man.
+	Close(man *types.Manifest) error
+	// Abort gives up on a failed output: nothing more is uploaded, and the
+	// files written so far are removed, so no partial output is left.
+	Abort(ctx context.Context) error
+}
+
+// encoder serializes records in one file format onto a stream.
+type encoder interface {
+	Encode(rec nameRecord) error
+	// Close flushes buffered data; it does not close the underlying stream.
+	Close() error
+}
+
+func newEncoder(format string, w io.Writer) (encoder, error) {
+	switch format {
+	case types.FormatText:
+		return &textEncoder{bw: bufio.NewWriterSize(w, 1<<20)}, nil
+	case types.FormatParquet:
+		return newParquetEncoder(w), nil
+	default:
+		return nil, errors.New("unsupported output format: " + format)
+	}
+}
+
+type textEncoder struct{ bw *bufio.Writer }
+
+func (e *textEncoder) Encode(rec nameRecord) error {
+	_, err := e.bw.WriteString(rec.Name + "\n")
+	return err
+}
+
+func (e *textEncoder) Close() error { return e.bw.Flush() }
+
+func newNameWriter(ctx context.Context, outURI, format string, layout types.OutputLayout) (nameWriter, error) {
+	if format != types.FormatText && format != types.FormatParquet {
+		return nil, errors.New("unsupported output format: " + format)
+	}
+	layout = layout.WithDefaults()
+	switch layout.Mode {
+	case types.LayoutSingle:
+		f, err := openSink(ctx, outURI, format, false)
+		if err != nil {
+			return nil, err
+		}
+		return &singleWriter{f: f}, nil
+	case types.LayoutParts:
+		if layout.Compression != "zstd" && layout.Compression != "none" {
+			return nil, errors.New("unsupported part compression: " + layout.Compression)
+		}
+		return &partsWriter{ctx: ctx, outURI: outURI, format: format, layout: layout}, nil
+	default:
+		return nil, errors.New("unsupported output layout: " + layout.Mode)
+	}
+}
+
+// fileSink is one output object: encoder -> [zstd] -> digest -> iopkg writer.
+type fileSink struct {
+	uri    string
+	closer io.Closer
+	dw     *digestWriter
+	zw     *zstd.Encoder
+	enc    encoder
+}
+
+func openSink(ctx context.Context, uri, format string, compress bool) (*fileSink, error) {
+	out, closer, err := iopkg.CreateWriter(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	f := &fileSink{uri: uri, closer: closer, dw: newDigestWriter(out)}
+	var dst io.Writer = f.dw
+	if compress {
+		if f.zw, err = zstd.NewWriter(f.dw); err != nil {
+			_ = closer.Close()
+			return nil, err
+		}
+		dst = f.zw
+	}
+	if f.enc, err = newEncoder(format, dst); err != nil {
+		_ = closer.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// close flushes every layer and reports the stored object's size and digest.
+// For s3:// the upload happens on close, so its error must not be dropped.
+func (f *fileSink) close() (types.FileInfo, error) {
+	err := f.enc.Close()
+	if err == nil && f.zw != nil {
+		err = f.zw.Close()
+	}
+	if cerr := f.closer.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return types.FileInfo{}, fmt.Errorf("%s: %w", f.uri, err)
+	}
+	return types.FileInfo{URI: f.uri, Bytes: f.dw.n, SHA256: f.dw.Sum()}, nil
+}
+
+// abort releases the sink without storing the object.
+func (f *fileSink) abort() error {
+	if f.zw != nil {
+		f.zw.Reset(io.Discard)
+		_ = f.zw.Close()
+	}
+	return iopkg.Abort(f.uri, f.closer)
+}
+
+// singleWriter writes every name to one file at the output URI.
+type singleWriter struct{ f *fileSink }
+
+func (w *singleWriter) Write(rec nameRecord) error { return w.f.enc.Encode(rec) }
+
+func (w *singleWriter) Close(man *types.Manifest) error {
+	fi, err := w.f.close()
+	if err != nil {
+		return err
+	}
+	man.Output = fi
+	return nil
+}
+
+func (w *singleWriter) Abort(context.Context) error { return w.f.abort() }
+
+// partsWriter rolls over to a new part file whenever the current one reaches
+// the configured uncompressed size.
+type partsWriter struct {
+	ctx    context.Context
+	outURI string
+	format string
+	layout types.OutputLayout
+	parts  []types.PartInfo
+
+	// current part; f is nil between parts
+	f   *fileSink
+	cur types.PartInfo
+	raw int64 // uncompressed name bytes in the current part
+}
+
+func (w *partsWriter) Write(rec nameRecord) error {
+	if w.f == nil {
+		compress := w.format == types.FormatText && w.layout.Compression == "zstd"
+		f, err := openSink(w.ctx, partURI(w.outURI, len(w.parts), w.format, compress), w.format, compress)
+		if err != nil {
+			return err
+		}
+		w.f, w.cur, w.raw = f, types.PartInfo{First: rec.Name}, 0
+	}
+	if err := w.f.enc.Encode(rec); err != nil {
+		return err
+	}
+	w.cur.Last = rec.Name
+	w.cur.Count++
+	w.raw += int64(len(rec.Name)) + 1
+	if w.raw >= w.layout.PartMaxBytes {
+		return w.finish()
+	}
+	return nil
+}
+
+// finish closes the current part and records it.
+func (w *partsWriter) finish() error {
+	fi, err := w.f.close()
+	if err != nil {
+		return err
+	}
+	w.cur.FileInfo = fi
+	w.parts = append(w.parts, w.cur)
+	w.f = nil
+	return nil
+}
+
+func (w *partsWriter) Close(man *types.Manifest) error {
+	if w.f != nil {
+		if err := w.finish(); err != nil {
+			return err
+		}
+	}
+	man.Parts = w.parts
+	// There is no single output object; Output summarizes the series.
+	man.Output = types.FileInfo{URI: w.outURI}
+	for _, p := range w.parts {
+		man.Output.Bytes += p.Bytes
+	}
+	return nil
+}
+
+func (w *partsWriter) Abort(ctx context.Context) error {
+	var err error
+	if w.f != nil {
+		err = w.f.abort()
+		w.f = nil
+	}
+	for _, p := range w.parts {
+		if rerr := iopkg.Remove(ctx, p.URI); err == nil {
+			err = rerr
+		}
+	}
+	w.parts = nil
+	return err
+}
+
+// partURI derives the i-th part name from the output URI:
+// ".../names.txt" -> ".../names-00000.txt.zst" (or ".../names-00000.parquet").
+func partURI(outURI string, i int, format string, compress bool) string {
+	dir, file := path.Split(outURI)
+	stem := strings.TrimSuffix(strings.TrimSuffix(file, ".txt"), ".parquet")
+	if format == types.FormatParquet {
+		return fmt.Sprintf("%s%s-%05d.parquet", dir, stem, i)
+	}
+	u := fmt.Sprintf("%s%s-%05d.txt", dir, stem, i)
+	if compress {
+		u += ".zst"
+	}
+	return u
+}
@@ -0,0 +1,89 @@
+package activities
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress/zstd"
+)
+
+// parquetRowGroupRows bounds how many rows are buffered in memory before a
+// row group is flushed to the output stream.
+const parquetRowGroupRows = 1 << 20
+
+// parquetRow is the Parquet schema of the names output.
+type parquetRow struct {
+	Name string `parquet:"name"`
+	TLD  string `parquet:"tld,dict"`
+	// SLD is the label directly under the TLD ("example" for "www.example.com");
+	// empty for the TLD apex itself.
+	SLD         string `parquet:"sld"`
+	LabelLength int32  `parquet:"label_length"` // length of SLD in characters
+	IDN         bool   `parquet:"idn"`          // any label is an A-label or non-ASCII
+	// RRTypes lists the distinct RR types seen for the name, sorted; empty
+	// when the shards didn't carry types.
+	RRTypes []string `parquet:"rr_types,list"`
+}
+
+type parquetEncoder struct {
+	w   *parquet.GenericWriter[parquetRow]
+	buf []parquetRow
+}
+
+func newParquetEncoder(w io.Writer) *parquetEncoder {
+	return &parquetEncoder{
+		w: parquet.NewGenericWriter[parquetRow](w,
+			parquet.MaxRowsPerRowGroup(parquetRowGroupRows),
+			parquet.Compression(&zstd.Codec{}),
+		),
+		buf: make([]parquetRow, 0, 1024),
+	}
+}
+
+func (e *parquetEncoder) Encode(rec nameRecord) error {
+	e.buf = append(e.buf, newParquetRow(rec))
+	if len(e.buf) == cap(e.buf) {
+		return e.flush()
+	}
+	return nil
+}
+
+func (e *parquetEncoder) flush() error {
+	_, err := e.w.Write(e.buf)
+	e.buf = e.buf[:0]
+	return err
+}
+
+func (e *parquetEncoder) Close() error {
+	if err := e.flush(); err != nil {
+		return err
+	}
+	return e.w.Close()
+}
+
+func newParquetRow(rec nameRecord) parquetRow {
+	labels := strings.Split(rec.Name, ".")
+	row := parquetRow{Name: rec.Name, TLD: labels[len(labels)-1], RRTypes: rec.RRTypes}
+	if len(labels) > 1 {
+		row.SLD = labels[len(labels)-2]
+		row.LabelLength = int32(utf8.RuneCountInString(row.SLD))
+	}
+	for _, l := range labels {
+		if strings.HasPrefix(l, "xn--") || !isASCII(l) {
+			row.IDN = true
+			break
+		}
+	}
+	return row
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -4,43 +4,69 @@ import (
 	"bufio"
 	"compress/gzip"
 	"context"
+	"errors"
+	"fmt"
 	"hash/fnv"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
-
-	"go.temporal.io/sdk/activity"
+	"time"
 
 	"github.com/miekg/dns"
+	"go.opentelemetry.io/otel/attribute"
+	tactivity "go.temporal.io/sdk/activity"
 	"golang.org/x/net/idna"
 
 	iopkg "github.com/yourorg/zone-names/internal/iopkg"
 	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/tracing"
 	"github.com/yourorg/zone-names/internal/types"
 )
 
 type Config struct {
 	ScratchDir string
+	// Identity is recorded in manifests as the worker that produced them.
+	// Defaults to "<pid>@<hostname>", matching the Temporal SDK default.
+	Identity string
+	// HTTPClient sends Notify webhooks. Defaults to a client with a 30s timeout.
+	HTTPClient *http.Client
+	// MinFreeBytes is kept free on the scratch file system: StreamPartition
+	// wants it on top of its estimate before starting, and activities writing
+	// to scratch abort once less is left. 0 only checks the estimate.
+	MinFreeBytes uint64
 }
 
 type Activities struct {
 	cfg Config
 }
 
-func New(cfg Config) *Activities { return &Activities{cfg: cfg} }
+func New(cfg Config) *Activities {
+	if cfg.Identity == "" {
+		host, _ := os.Hostname()
+		cfg.Identity = strconv.Itoa(os.Getpid()) + "@" + host
+	}
+	return &Activities{cfg: cfg}
+}
 
 func (a *Activities) StreamPartition(ctx context.Context, p types.WorkflowParams) (types.PartitionResult, error) {
-	rc, size, err := iopkg.Open(p.ZoneURI)
+	started := time.Now().UTC()
+	zone := p.ZoneLabel()
+	defer znmetrics.ObservePhase(zone, znmetrics.PhasePartition, started)
+	rc, info, err := iopkg.OpenObject(ctx, p.ZoneURI)
 	if err != nil {
 		return types.PartitionResult{}, err
 	}
 	defer rc.Close()
 
-	var r io.Reader = rc
+	// Hash the raw object bytes (before decompression) so the digest matches
+	// what is stored at ZoneURI.
+	raw := newDigestReader(rc)
+	var r io.Reader = raw
 	if strings.HasSuffix(strings.ToLower(p.ZoneURI), ".gz") {
-		gr, err := gzip.NewReader(rc)
+		gr, err := gzip.NewReader(raw)
 		if err != nil {
 			return types.PartitionResult{}, err
 		}
@@ -48,19 +74,31 @@ func (a *Activities) StreamPartition(ctx context.Context, p types.WorkflowParams
 		r = gr
 	}
 
-	shards := p.Shards
-	if shards <= 0 {
-		shards = 32
+	shards := p.ShardCount(info.Size)
+
+	// Fail before writing anything if the whole run won't fit in scratch.
+	base := filepath.Join(a.cfg.ScratchDir, p.ScratchSubdir)
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return types.PartitionResult{}, err
+	}
+	if err := a.preflight(base, scratchEstimate(p.ZoneURI, info.Size)); err != nil {
+		return types.PartitionResult{}, err
+	}
+	// Let the janitor find the owning workflow if CleanupScratch never runs.
+	if tactivity.IsActivity(ctx) {
+		id := tactivity.GetInfo(ctx).WorkflowExecution.ID
+		if err := os.WriteFile(filepath.Join(base, types.ScratchOwnerFile), []byte(id+"\n"), 0o644); err != nil {
+			return types.PartitionResult{}, err
+		}
 	}
+	space := a.guard(base)
 
 	paths := make([]string, shards)
+	lines := make([]uint64, shards)
+	sizes := make([]int64, shards)
 	wrs := make([]*bufio.Writer, shards)
 	closers := make([]io.Closer, shards)
 	for i := 0; i < shards; i++ {
-		base := filepath.Join(a.cfg.ScratchDir, p.ScratchSubdir)
-		if err := os.MkdirAll(base, 0o755); err != nil {
-			return types.PartitionResult{}, err
-		}
 		fpath := filepath.Join(base, "shard-"+two(i)+".txt")
 		w, c, err := iopkg.Create(fpath)
 		if err != nil {
@@ -94,16 +132,49 @@ func (a *Activities) StreamPartition(ctx context.Context, p types.WorkflowParams
 		toUnicode = idna.ToUnicode
 	}
 
+	withTypes := p.WantsRRTypes()
 	zp := dns.NewZoneParser(r, "", "")
-	var n uint64
+	var includes *includeGuard
+	if path, ok := strings.CutPrefix(p.ZoneURI, "file://"); ok && p.AllowInclude {
+		// The parser opens included files itself, so each directive is
+		// checked as it streams past, before the parser acts on it. The
+		// digest covers only this file, so note whether there were any.
+		root, err := filepath.EvalSymlinks(filepath.Dir(path))
+		if err != nil {
+			return types.PartitionResult{}, err
+		}
+		includes = &includeGuard{r: r, file: path, root: root}
+		zp = dns.NewZoneParser(includes, "", path)
+		zp.SetIncludeAllowed(true)
+	}
+	var n, read, skippedIDN uint64
 	var lastReported uint64
+	records := znmetrics.RecordsPartitioned.WithLabelValues(zone)
 	const hbEvery = 10000
+	const parseSpanEvery = 1000000
+	// Parsing is traced in chunks of parseSpanEvery records, so a trace shows
+	// where in the zone the time went.
+	_, chunk := tracing.Start(ctx, "partition.parse", attribute.Int64("records.from", 0))
+	defer func() { chunk.End() }()
 	for {
 		rr, ok := zp.Next()
 		if !ok {
 			break
 		}
+		if err := canceled(ctx, read); err != nil {
+			return types.PartitionResult{}, err
+		}
+		if err := space.check(read); err != nil {
+			return types.PartitionResult{}, err
+		}
+		read++
+		if read%parseSpanEvery == 0 {
+			chunk.SetAttributes(attribute.Int64("records.to", int64(read)))
+			chunk.End()
+			_, chunk = tracing.Start(ctx, "partition.parse", attribute.Int64("records.from", int64(read)))
+		}
 		if err := zp.Err(); err != nil {
+			znmetrics.ParseErrors.WithLabelValues(zone).Inc()
 			return types.PartitionResult{}, err
 		}
 		h := rr.Header()
@@ -119,50 +190,199 @@ func (a *Activities) StreamPartition(ctx context.Context, p types.WorkflowParams
 			owner, err = toUnicode(owner)
 		}
 		if err != nil {
+			skippedIDN++
 			continue
 		}
 
+		line := owner + "\n"
+		if withTypes {
+			line = owner + "\t" + dns.Type(h.Rrtype).String() + "\n"
+		}
 		idx := int(fnv32a(owner) % uint32(shards))
-		if _, err := wrs[idx].WriteString(owner + "\n"); err != nil {
+		if _, err := wrs[idx].WriteString(line); err != nil {
 			return types.PartitionResult{}, err
 		}
+		lines[idx]++
+		sizes[idx] += int64(len(line))
 
 		n++
 		if n%hbEvery == 0 {
-			activity.RecordHeartbeat(ctx, map[string]any{"records": n})
-			znmetrics.RecordsPartitioned.Add(float64(n - lastReported))
+			heartbeat(ctx, map[string]any{"records": n})
+			records.Add(float64(n - lastReported))
 			lastReported = n
 		}
 	}
 
+	chunk.SetAttributes(attribute.Int64("records.to", int64(read)))
+	if includes != nil && includes.err != nil {
+		return types.PartitionResult{}, includes.err
+	}
+	// Next reports a parse error by returning false, so check once more here.
+	if err := zp.Err(); err != nil {
+		znmetrics.ParseErrors.WithLabelValues(zone).Inc()
+		return types.PartitionResult{}, err
+	}
 	if n > lastReported {
-		znmetrics.RecordsPartitioned.Add(float64(n - lastReported))
+		records.Add(float64(n - lastReported))
+	}
+	if skippedIDN > 0 {
+		znmetrics.RecordsSkipped.WithLabelValues(zone, "idn").Add(float64(skippedIDN))
 	}
 	for _, bw := range wrs {
-		_ = bw.Flush()
+		if err := bw.Flush(); err != nil {
+			return types.PartitionResult{}, err
+		}
 	}
-	return types.PartitionResult{ShardURIs: paths, Records: n, SizeBytes: size}, nil
+	// The parser may stop before the end of the raw stream (e.g. gzip trailer);
+	// drain it so the digest covers the whole object.
+	if _, err := io.Copy(io.Discard, raw); err != nil {
+		return types.PartitionResult{}, err
+	}
+	var written int64
+	for _, sz := range sizes {
+		written += sz
+	}
+	znmetrics.BytesRead.WithLabelValues(zone, znmetrics.PhasePartition).Add(float64(raw.n))
+	znmetrics.BytesWritten.WithLabelValues(zone, znmetrics.PhasePartition).Add(float64(written))
+	logger(ctx).Info("partitioned zone", "zone", p.ZoneURI, "records", n, "shards", shards, "bytes", raw.n)
+	return types.PartitionResult{
+		ShardURIs:  paths,
+		ShardLines: lines,
+		ShardBytes: sizes,
+		Records:    n,
+		SizeBytes:  raw.n,
+		InputHash:  raw.Sum(),
+		InputETag:  info.ETag,
+		Includes:   includes != nil && includes.found,
+		Timing:     types.PhaseTiming{StartedAt: started, FinishedAt: time.Now().UTC(), Worker: a.cfg.Identity},
+	}, nil
 }
 
-func typeFromString(s string) uint16 {
-	switch s {
-	case "A":
-		return dns.TypeA
-	case "AAAA":
-		return dns.TypeAAAA
-	case "CNAME":
-		return dns.TypeCNAME
-	case "MX":
-		return dns.TypeMX
-	case "TXT":
-		return dns.TypeTXT
-	case "NS":
-		return dns.TypeNS
-	case "SRV":
-		return dns.TypeSRV
-	default:
-		return 0
+// maxIncludeDepth is the parser's own limit on nested $INCLUDEs.
+const maxIncludeDepth = 7
+
+// errBadInclude is wrapped by errors for $INCLUDE directives that are
+// refused: files outside the zone file's directory, or odd file names.
+var errBadInclude = errors.New("refused $INCLUDE")
+
+// includeGuard reads a local zone for the parser and checks its $INCLUDE
+// directives before passing them on: each included file must resolve,
+// symlinks followed, to a path under root, and its own directives are
+// checked the same way. A line that fails the check is never handed to the
+// parser; the read fails with err instead.
+//
+// Directives are looked for at the start of every line, possibly after
+// blanks, in any case. That is a superset of what the parser treats as one,
+// so a false positive only costs the unchanged check a skip or, for an
+// oddly written path, rejects the zone.
+type includeGuard struct {
+	r     io.Reader
+	file  string // path of the file being read, as the parser names it
+	root  string
+	depth int
+	line  []byte // the current line if it may be a directive, '\r' dropped
+	skip  bool   // the current line is not a directive
+	found bool
+	err   error
+}
+
+func (g *includeGuard) Read(p []byte) (int, error) {
+	if g.err != nil {
+		return 0, g.err
+	}
+	n, err := g.r.Read(p)
+	g.scan(p[:n])
+	if err == io.EOF && g.err == nil {
+		g.endLine()
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	return n, err
+}
+
+func (g *includeGuard) scan(p []byte) {
+	const directive = "$INCLUDE"
+	for _, c := range p {
+		switch {
+		case c == '\n':
+			g.endLine()
+		case g.skip, c == '\r':
+			// The parser drops '\r' outside quotes, "$INC\rLUDE" included.
+		case len(g.line) == 0 && (c == ' ' || c == '\t'):
+		case len(g.line) >= 4096:
+			g.err = fmt.Errorf("%w: %s: line longer than 4096 bytes", errBadInclude, g.file)
+		default:
+			g.line = append(g.line, c)
+			if n := len(g.line); n <= len(directive) && !strings.EqualFold(string(g.line), directive[:n]) {
+				g.skip = true
+			}
+		}
+		if g.err != nil {
+			return
+		}
+	}
+}
+
+// endLine checks the line just read if it is a directive.
+func (g *includeGuard) endLine() {
+	line := string(g.line)
+	g.line, g.skip = g.line[:0], false
+	line, _, _ = strings.Cut(line, ";")
+	name, rest, _ := cutAny(line, " \t\"()")
+	if !strings.EqualFold(name, "$INCLUDE") {
+		return
+	}
+	g.found = true
+	if rest = strings.TrimLeft(rest, " \t"); rest == "" {
+		return // the parser rejects a directive without a file name
 	}
+	file, _, _ := cutAny(rest, " \t")
+	g.err = g.check(file)
+}
+
+// check resolves an included file the way the parser does, makes sure it
+// lies under root and checks the file's own directives.
+func (g *includeGuard) check(file string) error {
+	if strings.ContainsAny(file, "\\\"()") || strings.IndexFunc(file, func(r rune) bool { return r < ' ' }) >= 0 {
+		return fmt.Errorf("%w: %s: unsupported file name %q", errBadInclude, g.file, file)
+	}
+	path := file
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(g.file), path)
+	}
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("%s: $INCLUDE %s: %w", g.file, file, err)
+	}
+	if rel, err := filepath.Rel(g.root, resolved); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%w: %s includes %s, outside %s", errBadInclude, g.file, file, g.root)
+	}
+	if g.depth+1 >= maxIncludeDepth {
+		return nil // too deep for the parser, which fails on its next $INCLUDE
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sub := &includeGuard{r: f, file: path, root: g.root, depth: g.depth + 1}
+	_, err = io.Copy(io.Discard, sub)
+	return err
+}
+
+// cutAny is strings.Cut at the first of any of the bytes in chars.
+func cutAny(s, chars string) (before, after string, found bool) {
+	if i := strings.IndexAny(s, chars); i >= 0 {
+		return s[:i], s[i+1:], true
+	}
+	return s, "", false
+}
+
+// typeFromString maps an RR type mnemonic to its code; 0 if unknown
+// (WorkflowParams.Validate rejects unknown filter types up front).
+func typeFromString(s string) uint16 {
+	return dns.StringToType[s]
 }
 
 func fnv32a(s string) uint32 {
@@ -0,0 +1,302 @@
+package activities
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+
+	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+const fixtureZone = "testdata/example.zone"
+
+// fixtureNames are the unique owner names in testdata/example.zone, byte-sorted.
+var fixtureNames = []string{
+	"blog.example",
+	"example",
+	"mail.example",
+	"mx.example",
+	"ns1.example",
+	"ns2.example",
+	"www.example",
+	"xn--bcher-kva.example",
+}
+
+func newActivityEnv(t *testing.T) (*testsuite.TestActivityEnvironment, *Activities) {
+	t.Helper()
+	var s testsuite.WorkflowTestSuite
+	env := s.NewTestActivityEnvironment()
+	a := New(Config{ScratchDir: t.TempDir(), Identity: "test-worker"})
+	a.Register(env)
+	return env, a
+}
+
+func fixtureURI(t *testing.T) string {
+	t.Helper()
+	abs, err := filepath.Abs(fixtureZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + abs
+}
+
+// gzipFixture writes a gzipped copy of the fixture zone and returns its URI.
+func gzipFixture(t *testing.T) (string, []byte) {
+	t.Helper()
+	raw, err := os.ReadFile(fixtureZone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	_, _ = zw.Write(raw)
+	_ = zw.Close()
+	p := filepath.Join(t.TempDir(), "example.zone.gz")
+	if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + p, buf.Bytes()
+}
+
+func partition(t *testing.T, env *testsuite.TestActivityEnvironment, a *Activities, p types.WorkflowParams) types.PartitionResult {
+	t.Helper()
+	v, err := env.ExecuteActivity("Activities.StreamPartition", p)
+	if err != nil {
+		t.Fatalf("StreamPartition: %v", err)
+	}
+	var res types.PartitionResult
+	if err := v.Get(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+// shardLines returns every line of every shard, sorted.
+func shardLines(t *testing.T, uris []string) []string {
+	t.Helper()
+	var lines []string
+	for _, u := range uris {
+		b, err := os.ReadFile(strings.TrimPrefix(u, "file://"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b) > 0 {
+			lines = append(lines, strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")...)
+		}
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+func TestStreamPartition(t *testing.T) {
+	env, a := newActivityEnv(t)
+	records := znmetrics.RecordsPartitioned.WithLabelValues("example")
+	read := znmetrics.BytesRead.WithLabelValues("example", znmetrics.PhasePartition)
+	recordsBefore, readBefore := testutil.ToFloat64(records), testutil.ToFloat64(read)
+	res := partition(t, env, a, types.WorkflowParams{ZoneURI: fixtureURI(t), Shards: 4, ScratchSubdir: "wf"})
+
+	if len(res.ShardURIs) != 4 {
+		t.Fatalf("shards %d", len(res.ShardURIs))
+	}
+	if res.Records != 12 {
+		t.Fatalf("records %d", res.Records)
+	}
+	raw, _ := os.ReadFile(fixtureZone)
+	sum := sha256.Sum256(raw)
+	if res.InputHash != hex.EncodeToString(sum[:]) || res.SizeBytes != int64(len(raw)) {
+		t.Fatalf("hash/size %s/%d", res.InputHash, res.SizeBytes)
+	}
+	if res.Timing.Worker != "test-worker" || res.Timing.FinishedAt.Before(res.Timing.StartedAt) {
+		t.Fatalf("timing %+v", res.Timing)
+	}
+	if testutil.ToFloat64(records)-recordsBefore != 12 || testutil.ToFloat64(read)-readBefore != float64(len(raw)) {
+		t.Fatalf("metrics: %v records, %v bytes read", testutil.ToFloat64(records)-recordsBefore, testutil.ToFloat64(read)-readBefore)
+	}
+	// Every record lands in exactly one shard and owner names are lowercased.
+	lines := shardLines(t, res.ShardURIs)
+	if len(lines) != 12 || !slices.Equal(slices.Compact(lines), fixtureNames) {
+		t.Fatalf("shard contents %q", lines)
+	}
+	for i, u := range res.ShardURIs {
+		if !strings.Contains(u, "/wf/shard-") {
+			t.Fatalf("shard outside scratch subdir: %s", u)
+		}
+		b, _ := os.ReadFile(strings.TrimPrefix(u, "file://"))
+		if res.ShardBytes[i] != int64(len(b)) || res.ShardLines[i] != uint64(strings.Count(string(b), "\n")) {
+			t.Fatalf("shard %d: %d lines/%d bytes reported for %q", i, res.ShardLines[i], res.ShardBytes[i], b)
+		}
+	} // The owner file names the workflow, for the worker's scratch janitor.
+	if b, err := os.ReadFile(filepath.Join(a.cfg.ScratchDir, "wf", types.ScratchOwnerFile)); err != nil || string(b) != "default-test-workflow-id\n" {
+		t.Fatalf("owner file %q: %v", b, err)
+	}
+}
+
+func TestStreamPartitionInclude(t *testing.T) {
+	env, a := newActivityEnv(t)
+	dir := t.TempDir()
+	_ = os.MkdirAll(filepath.Join(dir, "sub"), 0o755)
+	_ = os.WriteFile(filepath.Join(dir, "extra.zone"), []byte("www.example. 300 IN A 192.0.2.1\n$INCLUDE sub/more.zone\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "sub", "more.zone"), []byte("mail.example. 300 IN A 192.0.2.2\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "main.zone"), []byte("example. 300 IN NS ns1.example.\n$include extra.zone\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "plain.zone"), []byte("example. 300 IN NS ns1.example.\n; $INCLUDE in a comment\n"), 0o644)
+
+	p := types.WorkflowParams{ZoneURI: "file://" + filepath.Join(dir, "main.zone"), Shards: 1, ScratchSubdir: "inc", AllowInclude: true}
+	res := partition(t, env, a, p)
+	if res.Records != 3 || !res.Includes {
+		t.Fatalf("main: %d records, includes %v", res.Records, res.Includes)
+	}
+	res = partition(t, env, a, types.WorkflowParams{ZoneURI: "file://" + filepath.Join(dir, "plain.zone"), Shards: 1, ScratchSubdir: "plain", AllowInclude: true})
+	if res.Records != 1 || res.Includes {
+		t.Fatalf("plain: %d records, includes %v", res.Records, res.Includes)
+	}
+	// $INCLUDE is opt-in.
+	p.AllowInclude = false
+	_, err := env.ExecuteActivity("Activities.StreamPartition", p)
+	var ae *temporal.ApplicationError
+	if !errors.As(err, &ae) || ae.Type() != types.ErrTypeInvalidInput {
+		t.Fatalf("include not allowed: got %v", err)
+	}
+}
+
+// TestStreamPartitionIncludeOutside checks that included files must lie
+// under the zone file's directory, and that the parser never reads them.
+func TestStreamPartitionIncludeOutside(t *testing.T) {
+	env, a := newActivityEnv(t)
+	outside := t.TempDir()
+	secret := filepath.Join(outside, "secret.zone")
+	_ = os.WriteFile(secret, []byte("secret.example. 300 IN A 192.0.2.9\n"), 0o644)
+	dir := filepath.Join(t.TempDir(), "zones")
+	_ = os.MkdirAll(dir, 0o755)
+	rel, _ := filepath.Rel(dir, secret)
+	_ = os.Symlink(secret, filepath.Join(dir, "link.zone"))
+	_ = os.WriteFile(filepath.Join(dir, "nested.zone"), []byte("$INCLUDE "+rel+"\n"), 0o644)
+
+	for name, directive := range map[string]string{
+		"absolute":  "$INCLUDE " + secret,
+		"relative":  "$INCLUDE " + rel,
+		"symlink":   "$INCLUDE link.zone",
+		"nested":    "$INCLUDE nested.zone",
+		"cr":        "$INC\rLUDE " + secret,
+		"escaped":   "$INCLUDE x\\ " + rel,
+		"no eol":    "$INCLUDE\t" + secret,
+		"with name": "$INCLUDE " + secret + " example.",
+	} {
+		t.Run(name, func(t *testing.T) {
+			zone := filepath.Join(dir, "main.zone")
+			_ = os.WriteFile(zone, []byte("example. 300 IN NS ns1.example.\n"+directive), 0o644)
+			p := types.WorkflowParams{ZoneURI: "file://" + zone, Shards: 1, ScratchSubdir: "inc", AllowInclude: true}
+			_, err := env.ExecuteActivity("Activities.StreamPartition", p)
+			var ae *temporal.ApplicationError
+			if !errors.As(err, &ae) || ae.Type() != types.ErrTypeInvalidInput {
+				t.Fatalf("got %v", err)
+			}
+			if _, err := a.StreamPartition(context.Background(), p); !errors.Is(err, errBadInclude) {
+				t.Fatalf("direct call: got %v", err)
+			}
+		})
+	}
+}
+
+func TestStreamPartitionAutoShards(t *testing.T) {
+	env, a := newActivityEnv(t)
+	raw, _ := os.ReadFile(fixtureZone)
+	p := types.WorkflowParams{ZoneURI: fixtureURI(t), ShardMode: types.ShardsAuto, ScratchSubdir: "wf"}
+	if res := partition(t, env, a, p); len(res.ShardURIs) != 1 {
+		t.Fatalf("auto: %d shards for a %d byte zone", len(res.ShardURIs), len(raw))
+	}
+	p.TargetShardBytes = int64(len(raw)+2) / 3
+	if res := partition(t, env, a, p); len(res.ShardURIs) != 3 || len(shardLines(t, res.ShardURIs)) != 12 {
+		t.Fatalf("target %d: %d shards", p.TargetShardBytes, len(res.ShardURIs))
+	}
+}
+
+func TestStreamPartitionGzip(t *testing.T) {
+	env, a := newActivityEnv(t)
+	uri, gz := gzipFixture(t)
+	res := partition(t, env, a, types.WorkflowParams{ZoneURI: uri, Shards: 2})
+	if res.Records != 12 {
+		t.Fatalf("records %d", res.Records)
+	}
+	// The digest is over the stored (compressed) bytes.
+	sum := sha256.Sum256(gz)
+	if res.InputHash != hex.EncodeToString(sum[:]) || res.SizeBytes != int64(len(gz)) {
+		t.Fatalf("hash/size %s/%d", res.InputHash, res.SizeBytes)
+	}
+}
+
+func TestStreamPartitionFilters(t *testing.T) {
+	env, a := newActivityEnv(t)
+	res := partition(t, env, a, types.WorkflowParams{ZoneURI: fixtureURI(t), Shards: 2, Filters: []string{"ns"}})
+	want := []string{"example", "example", "xn--bcher-kva.example"}
+	if got := shardLines(t, res.ShardURIs); !slices.Equal(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestStreamPartitionIDN(t *testing.T) {
+	env, a := newActivityEnv(t)
+	res := partition(t, env, a, types.WorkflowParams{ZoneURI: fixtureURI(t), Shards: 1, Filters: []string{"NS"}, IDNMode: "ulabel"})
+	want := []string{"bücher.example", "example", "example"}
+	if got := shardLines(t, res.ShardURIs); !slices.Equal(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func TestStreamPartitionWithTypes(t *testing.T) {
+	env, a := newActivityEnv(t)
+	res := partition(t, env, a, types.WorkflowParams{ZoneURI: fixtureURI(t), Shards: 1, Filters: []string{"A", "AAAA"}, OutputFormat: types.FormatParquet})
+	want := []string{"mx.example\tA", "ns1.example\tA", "ns2.example\tA", "www.example\tA", "www.example\tAAAA"}
+	if got := shardLines(t, res.ShardURIs); !slices.Equal(got, want) {
+		t.Fatalf("got %q want %q", got, want)
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// TestActivitiesStopWhenCanceled calls the methods directly: a cancelled
+// context must stop their loops rather than run to completion.
+func TestActivitiesStopWhenCanceled(t *testing.T) {
+	a := New(Config{ScratchDir: t.TempDir()})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	out := "file://" + filepath.Join(t.TempDir(), "out.txt")
+
+	_, err := a.StreamPartition(ctx, types.WorkflowParams{ZoneURI: fixtureURI(t), ScratchSubdir: "wf", Shards: 1})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("StreamPartition: got %v", err)
+	}
+	_, err = a.ShardDedupeBadger(ctx, types.ShardDedupeParams{ShardURI: writeShard(t, "b.example\na.example\n"), OutputURI: out})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("ShardDedupeBadger: got %v", err)
+	}
+	shards := sortedShards(t, "a.example\n", "b.example\n")
+	_, err = a.MergeShards(ctx, types.MergeShardsParams{ShardURIs: shards, OutputURI: out})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("MergeShards: got %v", err)
+	}
+	for _, strategy := range []string{types.MergeSingle, types.MergeConcat} {
+		_, err = a.MergeSortedAndWriteManifest(ctx, types.MergeParams{
+			SortedShardURIs: shards, OutURI: out, ManifestURI: out + ".manifest.json",
+			Params: types.WorkflowParams{MergeStrategy: strategy},
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("merge %s: got %v", strategy, err)
+		}
+	}
+}
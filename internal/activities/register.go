@@ -0,0 +1,69 @@
+package activities
+
+import (
+	"context"
+
+	tactivity "go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/log"
+	"go.temporal.io/sdk/worker"
+)
+
+// Register registers every activity under the "Activities.<Method>" names the
+// workflow uses in ExecuteActivity, with permanent failures made
+// non-retryable (see classify). Test environments satisfy
+// worker.ActivityRegistry too.
+func (a *Activities) Register(r worker.ActivityRegistry) {
+	r.RegisterActivityWithOptions(classified(a.CheckUnchanged), tactivity.RegisterOptions{Name: "Activities.CheckUnchanged"})
+	r.RegisterActivityWithOptions(classified(a.StreamPartition), tactivity.RegisterOptions{Name: "Activities.StreamPartition"})
+	r.RegisterActivityWithOptions(classified(a.SplitShard), tactivity.RegisterOptions{Name: "Activities.SplitShard"})
+	r.RegisterActivityWithOptions(classified(a.MergeSortedAndWriteManifest), tactivity.RegisterOptions{Name: "Activities.MergeSortedAndWriteManifest"})
+	r.RegisterActivityWithOptions(classified(a.MergeShards), tactivity.RegisterOptions{Name: "Activities.MergeShards"})
+	r.RegisterActivityWithOptions(classifiedErr(a.CleanupScratch), tactivity.RegisterOptions{Name: "Activities.CleanupScratch"})
+	r.RegisterActivityWithOptions(classifiedErr(a.Notify), tactivity.RegisterOptions{Name: "Activities.Notify"})
+	a.RegisterDedupe(r)
+}
+
+// RegisterDedupe registers only ShardDedupeBadger, for a worker polling the
+// workflow's dedupe task queue (see workflow.DedupeTaskQueue).
+func (a *Activities) RegisterDedupe(r worker.ActivityRegistry) {
+	r.RegisterActivityWithOptions(classified(a.ShardDedupeBadger), tactivity.RegisterOptions{Name: "Activities.ShardDedupeBadger"})
+}
+
+// cancelCheckEvery is how many loop iterations activities go between checks
+// for cancellation.
+const cancelCheckEvery = 1024
+
+// canceled returns ctx.Err() on every cancelCheckEvery-th iteration n and nil
+// otherwise, so long loops stop soon after the activity is cancelled (or its
+// worker shuts down) without checking on every record.
+func canceled(ctx context.Context, n uint64) error {
+	if n%cancelCheckEvery != 0 {
+		return nil
+	}
+	return ctx.Err()
+}
+
+// heartbeat records progress when running as a Temporal activity. The methods
+// are also called directly (cmd/zone-names), where there is nothing to report to.
+func heartbeat(ctx context.Context, details ...any) {
+	if tactivity.IsActivity(ctx) {
+		tactivity.RecordHeartbeat(ctx, details...)
+	}
+}
+
+// logger returns the activity logger, whose entries carry the workflow and
+// activity IDs. Called directly (cmd/zone-names), it returns a logger that
+// drops everything; the CLI reports results itself.
+func logger(ctx context.Context) log.Logger {
+	if tactivity.IsActivity(ctx) {
+		return tactivity.GetLogger(ctx)
+	}
+	return nopLogger{}
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Debug(string, ...any) {}
+func (nopLogger) Info(string, ...any)  {}
+func (nopLogger) Warn(string, ...any)  {}
+func (nopLogger) Error(string, ...any) {}
@@ -0,0 +1,76 @@
+package activities
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/yourorg/zone-names/internal/diskspace"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// Scratch usage relative to the uncompressed zone: shards hold owner names
+// only, but the Badger DBs, their value logs and the sorted shard outputs
+// come on top while dedupe runs.
+const scratchFactor = 3
+
+// spaceCheckEvery is how many records or lines an activity processes between
+// free-space checks.
+const spaceCheckEvery = 100000
+
+// errNoSpace is wrapped by errors reporting that scratch is (about to be) full.
+var errNoSpace = errors.New("insufficient scratch space")
+
+// scratchEstimate is the scratch space a run over a zone object of the given
+// size is expected to use.
+func scratchEstimate(zoneURI string, size int64) uint64 {
+	n := uint64(max(size, 0))
+	if strings.HasSuffix(strings.ToLower(zoneURI), ".gz") {
+		n *= types.GzipRatio
+	}
+	return n * scratchFactor
+}
+
+// preflight fails unless dir has room for need bytes plus the configured
+// reserve. Platforms without statfs skip the check.
+func (a *Activities) preflight(dir string, need uint64) error {
+	err := diskspace.Check(dir, need+a.cfg.MinFreeBytes)
+	var short *diskspace.ShortError
+	switch {
+	case errors.Is(err, errors.ErrUnsupported):
+		return nil
+	case errors.As(err, &short):
+		return fmt.Errorf("%w: about %s needed for this zone: %w", errNoSpace, diskspace.Bytes(need), err)
+	}
+	return err
+}
+
+// spaceGuard aborts an activity writing to scratch once less than the
+// configured reserve is left, before the disk fills up under it.
+type spaceGuard struct {
+	dir string
+	min uint64
+}
+
+// guard returns a spaceGuard for dir; with no reserve configured it never
+// fails.
+func (a *Activities) guard(dir string) spaceGuard {
+	return spaceGuard{dir: dir, min: a.cfg.MinFreeBytes}
+}
+
+// check stats the file system every spaceCheckEvery calls, n being the
+// caller's running count.
+func (g spaceGuard) check(n uint64) error {
+	if g.min == 0 || n%spaceCheckEvery != 0 {
+		return nil
+	}
+	err := diskspace.Check(g.dir, g.min)
+	if err == nil || errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	var short *diskspace.ShortError
+	if errors.As(err, &short) {
+		return fmt.Errorf("%w: %w", errNoSpace, err)
+	}
+	return err
+}
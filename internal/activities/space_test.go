@@ -0,0 +1,70 @@
+package activities
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.temporal.io/sdk/temporal"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// tooMuch is more free space than any test machine has.
+const tooMuch = 1 << 62
+
+func wantNoSpace(t *testing.T, err error) {
+	t.Helper()
+	var ae *temporal.ApplicationError
+	if !errors.As(err, &ae) || !ae.NonRetryable() || ae.Type() != types.ErrTypeInsufficientSpace {
+		t.Fatalf("want non-retryable %s, got %v", types.ErrTypeInsufficientSpace, err)
+	}
+}
+
+func TestScratchEstimate(t *testing.T) {
+	if got := scratchEstimate("file:///z/com.zone", 1000); got != 3000 {
+		t.Errorf("plain: %d", got)
+	}
+	if got := scratchEstimate("s3://z/com.zone.GZ", 1000); got != 15000 {
+		t.Errorf("gzip: %d", got)
+	}
+}
+
+func TestPartitionPreflight(t *testing.T) {
+	env, a := newActivityEnv(t)
+	a.cfg.MinFreeBytes = tooMuch
+	_, err := env.ExecuteActivity("Activities.StreamPartition", types.WorkflowParams{ZoneURI: fixtureURI(t), Shards: 2, ScratchSubdir: "wf"})
+	wantNoSpace(t, err)
+	if !strings.Contains(err.Error(), "needed for this zone") {
+		t.Fatalf("error %v", err)
+	}
+	// Nothing was written.
+	if ents, _ := os.ReadDir(filepath.Join(a.cfg.ScratchDir, "wf")); len(ents) != 0 {
+		t.Fatalf("scratch has %d entries", len(ents))
+	}
+}
+
+func TestSpaceGuard(t *testing.T) {
+	dir := t.TempDir()
+	g := spaceGuard{dir: dir, min: tooMuch}
+	if err := g.check(1); err != nil {
+		t.Fatalf("checked between intervals: %v", err)
+	}
+	if err := g.check(spaceCheckEvery); !errors.Is(err, errNoSpace) {
+		t.Fatalf("got %v", err)
+	}
+	if err := (spaceGuard{dir: dir}).check(0); err != nil {
+		t.Fatalf("zero reserve: %v", err)
+	}
+
+	// A dedupe that runs short of space stops with InsufficientSpace.
+	env, a := newActivityEnv(t)
+	a.cfg.MinFreeBytes = tooMuch
+	shard := writeShard(t, "b.example\na.example\n")
+	_, err := env.ExecuteActivity("Activities.ShardDedupeBadger", types.ShardDedupeParams{
+		ShardURI: shard, OutputURI: shard + ".sorted",
+	})
+	wantNoSpace(t, err)
+}
@@ -0,0 +1,113 @@
+package activities
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	iopkg "github.com/yourorg/zone-names/internal/iopkg"
+	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// splitSalt prefixes names when hashing them into sub-shards. All names in a
+// shard share fnv32a(name) modulo the shard count, so the unsalted hash
+// would put them in the same sub-shard whenever the part count shares a
+// factor with the shard count.
+const splitSalt = "split:"
+
+// SplitShard re-hashes a skewed shard into p.Parts sub-shards next to it,
+// "shard-07.txt" becoming "shard-07-00.txt", "shard-07-01.txt", ... All lines
+// of a name land in the same sub-shard, so the sub-shards can be deduped
+// independently. The original shard is left for cleanup.
+func (a *Activities) SplitShard(ctx context.Context, p types.SplitShardParams) (types.SplitShardResult, error) {
+	defer znmetrics.ObservePhase(p.Zone, znmetrics.PhaseSplit, time.Now())
+	if p.Parts < 2 {
+		return types.SplitShardResult{}, invalidParams(fmt.Errorf("split into %d parts", p.Parts))
+	}
+	in, err := iopkg.OpenReader(ctx, p.ShardURI)
+	if err != nil {
+		return types.SplitShardResult{}, err
+	}
+	defer in.Close()
+
+	base := strings.TrimSuffix(strings.TrimPrefix(p.ShardURI, "file://"), ".txt")
+	space := a.guard(filepath.Dir(base))
+	res := types.SplitShardResult{
+		ShardURIs:  make([]string, p.Parts),
+		ShardLines: make([]uint64, p.Parts),
+		ShardBytes: make([]int64, p.Parts),
+	}
+	wrs := make([]*bufio.Writer, p.Parts)
+	closers := make([]io.Closer, p.Parts)
+	defer func() {
+		for _, c := range closers {
+			if c != nil {
+				_ = c.Close()
+			}
+		}
+	}()
+	for i := range wrs {
+		path := base + "-" + two(i) + ".txt"
+		w, c, err := iopkg.Create(path)
+		if err != nil {
+			return types.SplitShardResult{}, err
+		}
+		res.ShardURIs[i] = "file://" + path
+		wrs[i] = bufio.NewWriterSize(w, 1<<20)
+		closers[i] = c
+	}
+
+	r := bufio.NewReaderSize(in, 1<<20)
+	var n uint64
+	var read int64
+	for {
+		line, err := r.ReadSlice('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return types.SplitShardResult{}, err
+		}
+		if err := canceled(ctx, n); err != nil {
+			return types.SplitShardResult{}, err
+		}
+		if err := space.check(n); err != nil {
+			return types.SplitShardResult{}, err
+		}
+		owner := bytes.TrimSuffix(line, []byte{'\n'})
+		if i := bytes.IndexByte(owner, '\t'); i >= 0 {
+			owner = owner[:i]
+		}
+		idx := int(fnv32a(splitSalt+string(owner)) % uint32(p.Parts))
+		if _, err := wrs[idx].Write(line); err != nil {
+			return types.SplitShardResult{}, err
+		}
+		res.ShardLines[idx]++
+		res.ShardBytes[idx] += int64(len(line))
+		read += int64(len(line))
+		n++
+		if n%100000 == 0 {
+			heartbeat(ctx, n)
+		}
+	}
+	for i, w := range wrs {
+		if err := w.Flush(); err != nil {
+			return types.SplitShardResult{}, err
+		}
+		err := closers[i].Close()
+		closers[i] = nil
+		if err != nil {
+			return types.SplitShardResult{}, err
+		}
+	}
+	znmetrics.BytesRead.WithLabelValues(p.Zone, znmetrics.PhaseSplit).Add(float64(read))
+	znmetrics.BytesWritten.WithLabelValues(p.Zone, znmetrics.PhaseSplit).Add(float64(read))
+	logger(ctx).Info("split shard", "shard", p.ShardURI, "parts", p.Parts, "lines", n)
+	return res, nil
+}
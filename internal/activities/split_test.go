@@ -0,0 +1,50 @@
+package activities
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+func TestSplitShard(t *testing.T) {
+	env, _ := newActivityEnv(t)
+	in := writeShard(t, "www.example\tA\na.example\tNS\nwww.example\tAAAA\nb.example\tNS\nc.example\tMX\na.example\tA\nd.example\tNS\n")
+	v, err := env.ExecuteActivity("Activities.SplitShard", types.SplitShardParams{ShardURI: in, Parts: 3})
+	if err != nil {
+		t.Fatalf("SplitShard: %v", err)
+	}
+	var res types.SplitShardResult
+	if err := v.Get(&res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ShardURIs) != 3 || !strings.HasSuffix(res.ShardURIs[2], "/shard-00-02.txt") {
+		t.Fatalf("sub-shards %q", res.ShardURIs)
+	}
+	owners := map[string]int{}
+	for i, u := range res.ShardURIs {
+		b, _ := os.ReadFile(strings.TrimPrefix(u, "file://"))
+		if res.ShardBytes[i] != int64(len(b)) || res.ShardLines[i] != uint64(strings.Count(string(b), "\n")) {
+			t.Fatalf("sub-shard %d: %d lines/%d bytes reported for %q", i, res.ShardLines[i], res.ShardBytes[i], b)
+		}
+		for _, l := range shardLines(t, []string{u}) {
+			owner, _, _ := strings.Cut(l, "\t")
+			if j, ok := owners[owner]; ok && j != i {
+				t.Fatalf("%s in sub-shards %d and %d", owner, j, i)
+			}
+			owners[owner] = i
+		}
+	}
+	orig, _ := os.ReadFile(strings.TrimPrefix(in, "file://"))
+	want := strings.Split(strings.TrimSuffix(string(orig), "\n"), "\n")
+	slices.Sort(want)
+	if got := shardLines(t, res.ShardURIs); !slices.Equal(got, want) {
+		t.Fatalf("lines %q, want %q", got, want)
+	}
+
+	if _, err := env.ExecuteActivity("Activities.SplitShard", types.SplitShardParams{ShardURI: in, Parts: 1}); err == nil {
+		t.Fatal("want error for one part")
+	}
+}
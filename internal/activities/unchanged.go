@@ -0,0 +1,112 @@
+package activities
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	iopkg "github.com/yourorg/zone-names/internal/iopkg"
+	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// CheckUnchanged compares the input at p.ZoneURI against the manifest at
+// p.ManifestURI. The ETag is used as a fast path when both sides have one;
+// otherwise the input is streamed and its SHA-256 compared to the stored hash.
+// A missing or unreadable manifest simply means "changed".
+func (a *Activities) CheckUnchanged(ctx context.Context, p types.UnchangedParams) (types.UnchangedResult, error) {
+	zone := p.Params.ZoneLabel()
+	defer znmetrics.ObservePhase(zone, znmetrics.PhaseCheckUnchanged, time.Now())
+	changed := func(reason string) (types.UnchangedResult, error) {
+		logger(ctx).Debug("input changed", "zone", p.ZoneURI, "reason", reason)
+		return types.UnchangedResult{Reason: reason}, nil
+	}
+
+	man, err := readManifest(ctx, p.ManifestURI)
+	switch {
+	case iopkg.IsNotExist(err):
+		return changed("no previous manifest")
+	case errors.Is(err, iopkg.ErrInvalidJSON):
+		return changed("previous manifest unreadable: " + err.Error())
+	case err != nil:
+		return types.UnchangedResult{}, err
+	}
+	if man.Version != types.ManifestVersion {
+		return changed("previous manifest has a different schema version")
+	}
+	if man.Input.URI != p.ZoneURI || man.Input.SHA256 == "" {
+		return changed("previous manifest was for a different input")
+	}
+	if man.Input.Includes {
+		return changed("input uses $INCLUDE; included files are not covered by its digest")
+	}
+	if !man.Params.SameOutput(p.Params) {
+		return changed("parameters differ from previous run")
+	}
+
+	// The previous output must still be there and intact in size.
+	outputs := []types.FileInfo{man.Output}
+	if len(man.Parts) > 0 {
+		outputs = outputs[:0]
+		for _, part := range man.Parts {
+			outputs = append(outputs, part.FileInfo)
+		}
+	}
+	for _, o := range outputs {
+		st, err := iopkg.Stat(ctx, o.URI)
+		if err != nil {
+			if iopkg.IsNotExist(err) {
+				return changed("previous output missing: " + o.URI)
+			}
+			return types.UnchangedResult{}, err
+		}
+		if st.Size != o.Bytes {
+			return changed("previous output size differs from manifest: " + o.URI)
+		}
+	}
+
+	in, err := iopkg.Stat(ctx, p.ZoneURI)
+	if err != nil {
+		return types.UnchangedResult{}, err
+	}
+	if in.Size != man.Input.Bytes {
+		return changed("input size differs")
+	}
+	unchanged := types.UnchangedResult{Unchanged: true, Previous: types.MergeStats{Emitted: man.Unique, Skipped: true}}
+	if in.ETag != "" && in.ETag == man.Input.ETag {
+		return unchanged, nil
+	}
+
+	// No usable ETag: hash the input. This is a single sequential read, far
+	// cheaper than partition + dedupe + merge.
+	rc, err := iopkg.OpenReader(ctx, p.ZoneURI)
+	if err != nil {
+		return types.UnchangedResult{}, err
+	}
+	defer rc.Close()
+	dr := newDigestReader(rc)
+	buf := make([]byte, 1<<20)
+	lastHB := time.Now()
+	for {
+		if err := ctx.Err(); err != nil {
+			return types.UnchangedResult{}, err
+		}
+		_, err := dr.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return types.UnchangedResult{}, err
+		}
+		if time.Since(lastHB) > 10*time.Second {
+			heartbeat(ctx, map[string]any{"hashed": dr.n})
+			lastHB = time.Now()
+		}
+	}
+	znmetrics.BytesRead.WithLabelValues(zone, znmetrics.PhaseCheckUnchanged).Add(float64(dr.n))
+	if dr.Sum() != man.Input.SHA256 {
+		return changed("input hash differs")
+	}
+	return unchanged, nil
+}
@@ -0,0 +1,179 @@
+package activities
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	iopkg "github.com/yourorg/zone-names/internal/iopkg"
+	"github.com/yourorg/zone-names/internal/s3test"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// prevRun writes an input, an output and a manifest describing them, as a
+// completed run would, and returns the params for checking it again.
+func prevRun(t *testing.T) (types.UnchangedParams, string) {
+	t.Helper()
+	dir := t.TempDir()
+	in := filepath.Join(dir, "zone.txt")
+	out := filepath.Join(dir, "names.txt")
+	_ = os.WriteFile(in, []byte("zone-data"), 0o644)
+	_ = os.WriteFile(out, []byte("a.example\n"), 0o644)
+	params := types.WorkflowParams{ZoneURI: "file://" + in, OutputURI: "file://" + out, Filters: []string{"NS", "a"}}
+	man := types.Manifest{
+		Version: types.ManifestVersion,
+		Input:   types.FileInfo{URI: params.ZoneURI, Bytes: 9, SHA256: sha256Hex("zone-data")},
+		Output:  types.FileInfo{URI: params.OutputURI, Bytes: 10, SHA256: sha256Hex("a.example\n")},
+		Params:  params,
+		Unique:  1,
+	}
+	manURI := "file://" + filepath.Join(dir, "manifest.json")
+	if err := writeManifest(context.Background(), manURI, man); err != nil {
+		t.Fatal(err)
+	}
+	return types.UnchangedParams{ZoneURI: params.ZoneURI, ManifestURI: manURI, Params: params}, in
+}
+
+func checkUnchanged(t *testing.T, p types.UnchangedParams) types.UnchangedResult {
+	t.Helper()
+	env, _ := newActivityEnv(t)
+	v, err := env.ExecuteActivity("Activities.CheckUnchanged", p)
+	if err != nil {
+		t.Fatalf("CheckUnchanged: %v", err)
+	}
+	var res types.UnchangedResult
+	if err := v.Get(&res); err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestCheckUnchanged(t *testing.T) {
+	p, _ := prevRun(t)
+	// Filter order and case don't matter.
+	p.Params.Filters = []string{"A", "ns"}
+	res := checkUnchanged(t, p)
+	if !res.Unchanged || res.Previous.Emitted != 1 || !res.Previous.Skipped {
+		t.Fatalf("result %+v", res)
+	}
+}
+
+// TestCheckUnchangedStaleManifest checks that a manifest that can't describe
+// this run means "changed".
+func TestCheckUnchangedStaleManifest(t *testing.T) {
+	cases := map[string]func(man *types.Manifest){
+		"schema version": func(man *types.Manifest) { man.Version++ },
+		"other input":    func(man *types.Manifest) { man.Input.URI += ".old" },
+		"no input hash":  func(man *types.Manifest) { man.Input.SHA256 = "" },
+		"output size":    func(man *types.Manifest) { man.Output.Bytes++ },
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, _ := prevRun(t)
+			man, err := readManifest(context.Background(), p.ManifestURI)
+			if err != nil {
+				t.Fatal(err)
+			}
+			mutate(&man)
+			if err := writeManifest(context.Background(), p.ManifestURI, man); err != nil {
+				t.Fatal(err)
+			}
+			if res := checkUnchanged(t, p); res.Unchanged || res.Reason == "" {
+				t.Fatalf("result %+v", res)
+			}
+		})
+	}
+	t.Run("unreadable", func(t *testing.T) {
+		p, _ := prevRun(t)
+		_ = os.WriteFile(strings.TrimPrefix(p.ManifestURI, "file://"), []byte("{"), 0o644)
+		if res := checkUnchanged(t, p); res.Unchanged || !strings.Contains(res.Reason, "unreadable") {
+			t.Fatalf("result %+v", res)
+		}
+	})
+}
+
+// TestCheckUnchangedETag checks the S3 fast path: a matching ETag settles it
+// without hashing the input, so a stale digest goes unnoticed.
+func TestCheckUnchangedETag(t *testing.T) {
+	srv := s3test.NewServer(t)
+	srv.SetEnv(t)
+	if err := srv.CreateBucket("zones"); err != nil {
+		t.Fatal(err)
+	}
+	if err := srv.PutObject("zones", "example.zone", []byte("zone-data")); err != nil {
+		t.Fatal(err)
+	}
+	p, _ := prevRun(t)
+	p.ZoneURI, p.Params.ZoneURI = "s3://zones/example.zone", "s3://zones/example.zone"
+	in, err := iopkg.Stat(context.Background(), p.ZoneURI)
+	if err != nil || in.ETag == "" {
+		t.Fatalf("stat: %+v, %v", in, err)
+	}
+	man, err := readManifest(context.Background(), p.ManifestURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	man.Input = types.FileInfo{URI: p.ZoneURI, Bytes: in.Size, SHA256: "not-the-digest", ETag: in.ETag}
+	man.Params = p.Params
+	if err := writeManifest(context.Background(), p.ManifestURI, man); err != nil {
+		t.Fatal(err)
+	}
+	if res := checkUnchanged(t, p); !res.Unchanged {
+		t.Fatalf("matching ETag: %+v", res)
+	}
+	man.Input.ETag = "other"
+	if err := writeManifest(context.Background(), p.ManifestURI, man); err != nil {
+		t.Fatal(err)
+	}
+	if res := checkUnchanged(t, p); res.Unchanged || res.Reason != "input hash differs" {
+		t.Fatalf("other ETag: %+v", res)
+	}
+}
+
+// TestCheckUnchangedIncludes checks that a run whose zone used $INCLUDE is
+// never skipped: the input digest doesn't cover the included files.
+func TestCheckUnchangedIncludes(t *testing.T) {
+	p, _ := prevRun(t)
+	man := types.Manifest{
+		Version: types.ManifestVersion,
+		Input:   types.FileInfo{URI: p.ZoneURI, Bytes: 9, SHA256: sha256Hex("zone-data"), Includes: true},
+		Params:  p.Params,
+	}
+	if err := writeManifest(context.Background(), p.ManifestURI, man); err != nil {
+		t.Fatal(err)
+	}
+	if res := checkUnchanged(t, p); res.Unchanged || !strings.Contains(res.Reason, "$INCLUDE") {
+		t.Fatalf("result %+v", res)
+	}
+}
+
+func TestCheckUnchangedDetectsChanges(t *testing.T) {
+	cases := map[string]func(p *types.UnchangedParams, in string){
+		"no manifest": func(p *types.UnchangedParams, _ string) {
+			p.ManifestURI += ".missing"
+		},
+		"input content": func(_ *types.UnchangedParams, in string) {
+			_ = os.WriteFile(in, []byte("zone-DATA"), 0o644) // same size, different hash
+		},
+		"input size": func(_ *types.UnchangedParams, in string) {
+			_ = os.WriteFile(in, []byte("zone-data-2"), 0o644)
+		},
+		"params": func(p *types.UnchangedParams, _ string) {
+			p.Params.IDNMode = "alabel"
+		},
+		"output missing": func(p *types.UnchangedParams, _ string) {
+			_ = os.Remove(p.Params.OutputURI[len("file://"):])
+		},
+	}
+	for name, mutate := range cases {
+		t.Run(name, func(t *testing.T) {
+			p, in := prevRun(t)
+			mutate(&p, in)
+			if res := checkUnchanged(t, p); res.Unchanged || res.Reason == "" {
+				t.Fatalf("result %+v", res)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Package api serves an HTTP interface for submitting and tracking zone
+// extraction jobs. Each job is one Zone2NamesWorkflow execution; the job ID
+// is the workflow ID.
+//
+//	POST   /jobs        start a job; body is a types.WorkflowParams JSON object
+//	GET    /jobs/{id}   status, progress, result and, once done, the manifest
+//	DELETE /jobs/{id}   request cancellation
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.temporal.io/api/serviceerror"
+
+	znclient "github.com/yourorg/zone-names/internal/client"
+	iopkg "github.com/yourorg/zone-names/internal/iopkg"
+	"github.com/yourorg/zone-names/internal/types"
+	"github.com/yourorg/zone-names/internal/workflow"
+)
+
+// maxBodyBytes bounds POST /jobs request bodies.
+const maxBodyBytes = 1 << 20
+
+// Options configures the handler.
+type Options struct {
+	// Token, if set, must be presented as "Authorization: Bearer <token>".
+	// The worker refuses to serve the API without one.
+	Token string
+	// AllowedPrefixes lists the URI prefixes jobs may read zones from and
+	// write output to, e.g. "s3://zones/". Empty allows any s3:// URI and
+	// nothing else, so callers can't reach the worker's local files.
+	AllowedPrefixes []string
+	// NotifyPrefixes lists the webhook URL prefixes jobs may post to, e.g.
+	// "https://hooks.example.com/". Empty rejects jobs with Notify, so callers
+	// can't make the worker send requests to internal hosts.
+	NotifyPrefixes []string
+}
+
+// Job is the JSON representation of a job.
+type Job struct {
+	ID        string                `json:"id"`
+	RunID     string                `json:"run_id"`
+	Status    string                `json:"status"` // Temporal status: Running, Completed, Failed, ...
+	StartedAt *time.Time            `json:"started_at,omitempty"`
+	ClosedAt  *time.Time            `json:"closed_at,omitempty"`
+	Params    *types.WorkflowParams `json:"params,omitempty"`
+	Progress  *types.Progress       `json:"progress,omitempty"`
+	Result    *types.MergeStats     `json:"result,omitempty"`
+	Error     string                `json:"error,omitempty"` // why the job failed
+	Manifest  *types.Manifest       `json:"manifest,omitempty"`
+	Links     Links                 `json:"links"`
+}
+
+// Links point at the job itself and, once known, its output.
+type Links struct {
+	Self     string   `json:"self"`
+	Output   string   `json:"output,omitempty"`
+	Parts    []string `json:"parts,omitempty"`
+	Manifest string   `json:"manifest,omitempty"`
+}
+
+type handler struct {
+	c    *znclient.Client
+	opts Options
+}
+
+// New returns the jobs API handler backed by c.
+func New(c *znclient.Client, opts Options) http.Handler {
+	h := &handler{c: c, opts: opts}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", h.create)
+	mux.HandleFunc("GET /jobs/{id}", h.get)
+	mux.HandleFunc("DELETE /jobs/{id}", h.cancel)
+	return h.auth(mux)
+}
+
+func (h *handler) auth(next http.Handler) http.Handler {
+	if h.opts.Token == "" {
+		return next
+	}
+	want := []byte("Bearer " + h.opts.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), want) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or invalid bearer token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// create starts a job. The optional "id" query parameter sets the job ID;
+// otherwise one is derived from the zone name and time.
+func (h *handler) create(w http.ResponseWriter, r *http.Request) {
+	var p types.WorkflowParams
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid body: %w", err))
+		return
+	}
+	// Render templates here rather than in the workflow, so the allowlist
+	// checks the URIs the job will actually use.
+	p, err := p.Render(time.Now())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := p.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := h.allow(p); err != nil {
+		writeError(w, http.StatusForbidden, err)
+		return
+	}
+	run, err := h.c.Start(r.Context(), r.URL.Query().Get("id"), p)
+	if err != nil {
+		var started *serviceerror.WorkflowExecutionAlreadyStarted
+		if errors.As(err, &started) {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		writeError(w, http.StatusBadGateway, err)
+		return
+	}
+	self := "/jobs/" + run.ID
+	w.Header().Set("Location", self)
+	params := znclient.Redacted(p)
+	writeJSON(w, http.StatusCreated, Job{ID: run.ID, RunID: run.RunID, Status: "Running", Params: &params, Links: Links{Self: self}})
+}
+
+// describe looks up the job named in the path. Workflows of other types
+// in the namespace are reported as not found, so they can't be read or
+// canceled through the API.
+func (h *handler) describe(w http.ResponseWriter, r *http.Request) (znclient.Execution, bool) {
+	e, err := h.c.Describe(r.Context(), r.PathValue("id"), "")
+	if err == nil && e.Type != znclient.WorkflowType {
+		err = serviceerror.NewNotFound("not a " + znclient.WorkflowType + " execution")
+	}
+	if err != nil {
+		writeTemporalError(w, err)
+		return e, false
+	}
+	return e, true
+}
+
+func (h *handler) get(w http.ResponseWriter, r *http.Request) {
+	e, ok := h.describe(w, r)
+	if !ok {
+		return
+	}
+	job := Job{ID: e.ID, RunID: e.RunID, Status: e.Status, StartedAt: timePtr(e.StartTime), ClosedAt: timePtr(e.CloseTime), Links: Links{Self: "/jobs/" + e.ID}}
+	if e.Params.OutputURI != "" {
+		// Memos of runs started before the client redacted them still hold
+		// the secret.
+		params := znclient.Redacted(e.Params)
+		job.Params = &params
+	}
+	if p, err := h.c.Progress(r.Context(), e.ID, e.RunID); err == nil {
+		job.Progress = &p
+	}
+	if !e.Running() {
+		ms, err := h.c.Wait(r.Context(), e.ID, e.RunID)
+		if err != nil {
+			job.Error = err.Error()
+		} else {
+			job.Result = &ms
+		}
+	}
+	if job.Result != nil && job.Params != nil {
+		job.Links.Manifest = workflow.ManifestPath(job.Params.OutputURI)
+		var man types.Manifest
+		if err := iopkg.ReadJSON(r.Context(), job.Links.Manifest, &man); err == nil {
+			job.Manifest = &man
+			job.Links.Output = man.Output.URI
+			for _, p := range man.Parts {
+				job.Links.Parts = append(job.Links.Parts, p.URI)
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+func (h *handler) cancel(w http.ResponseWriter, r *http.Request) {
+	e, ok := h.describe(w, r)
+	if !ok {
+		return
+	}
+	if !e.Running() {
+		writeError(w, http.StatusConflict, fmt.Errorf("job %s is already %s", e.ID, strings.ToLower(e.Status)))
+		return
+	}
+	if err := h.c.Cancel(r.Context(), e.ID, e.RunID); err != nil {
+		writeTemporalError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, Job{ID: e.ID, RunID: e.RunID, Status: e.Status, Links: Links{Self: "/jobs/" + e.ID}})
+}
+
+// allow checks a job's locations against the allowlists in Options. The
+// manifest is written next to OutputURI, so it is covered by the same check.
+// Where scratch files go and whether they stay is up to the worker.
+func (h *handler) allow(p types.WorkflowParams) error {
+	if p.ScratchSubdir != "" || p.KeepScratch {
+		return errors.New("ScratchSubdir and KeepScratch can't be set through the API")
+	}
+	prefixes := h.opts.AllowedPrefixes
+	if len(prefixes) == 0 {
+		prefixes = []string{"s3://"}
+	}
+	for _, u := range []string{p.ZoneURI, p.OutputURI} {
+		if !allowed(u, prefixes) {
+			return fmt.Errorf("%s is not under an allowed prefix (%s)", u, strings.Join(prefixes, ", "))
+		}
+	}
+	if p.Notify != nil && !allowed(p.Notify.URL, h.opts.NotifyPrefixes) {
+		return fmt.Errorf("notify URL %s is not under an allowed prefix", p.Notify.URL)
+	}
+	return nil
+}
+
+// allowed reports whether uri starts with one of prefixes. URIs with "." or
+// ".." path segments are refused, so they can't climb out of a prefix.
+func allowed(uri string, prefixes []string) bool {
+	for _, seg := range strings.Split(uri, "/") {
+		if seg == "." || seg == ".." {
+			return false
+		}
+	}
+	for _, p := range prefixes {
+		if strings.HasPrefix(uri, p) {
+			return true
+		}
+	}
+	return false
+}
+
+func timePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func writeTemporalError(w http.ResponseWriter, err error) {
+	var nf *serviceerror.NotFound
+	if errors.As(err, &nf) {
+		writeError(w, http.StatusNotFound, errors.New("job not found"))
+		return
+	}
+	writeError(w, http.StatusBadGateway, err)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	_ = enc.Encode(v)
+}
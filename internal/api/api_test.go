@@ -0,0 +1,301 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	tclient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	znclient "github.com/yourorg/zone-names/internal/client"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+func serve(t *testing.T, tc *mocks.Client, opts Options) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(New(znclient.New(tc, "q"), opts))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func do(t *testing.T, method, url, body string, hdr ...string) (*http.Response, map[string]any) {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i+1 < len(hdr); i += 2 {
+		req.Header.Set(hdr[i], hdr[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var m map[string]any
+	if err := json.NewDecoder(resp.Body).Decode(&m); err != nil {
+		t.Fatalf("%s %s: decode: %v", method, url, err)
+	}
+	return resp, m
+}
+
+func describe(tc *mocks.Client, id string, status enumspb.WorkflowExecutionStatus, p types.WorkflowParams) {
+	describeType(tc, id, znclient.WorkflowType, status, p)
+}
+
+func describeType(tc *mocks.Client, id, typ string, status enumspb.WorkflowExecutionStatus, p types.WorkflowParams) {
+	pl, _ := converter.GetDefaultDataConverter().ToPayload(p)
+	info := &workflowpb.WorkflowExecutionInfo{
+		Execution: &commonpb.WorkflowExecution{WorkflowId: id, RunId: "run-" + id},
+		Type:      &commonpb.WorkflowType{Name: typ},
+		Status:    status,
+		StartTime: timestamppb.Now(),
+		Memo:      &commonpb.Memo{Fields: map[string]*commonpb.Payload{"params": pl}},
+	}
+	if status != enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING {
+		info.CloseTime = timestamppb.Now()
+	}
+	tc.On("DescribeWorkflowExecution", mock.Anything, id, "").
+		Return(&workflowservice.DescribeWorkflowExecutionResponse{WorkflowExecutionInfo: info}, nil)
+}
+
+func TestCreate(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{})
+	want := types.WorkflowParams{ZoneURI: "s3://zones/com.zone.gz", OutputURI: "s3://out/com/names.txt", Filters: []string{"NS"}}
+	wr := &mocks.WorkflowRun{}
+	wr.On("GetID").Return("job-1")
+	wr.On("GetRunID").Return("run-1")
+	tc.On("ExecuteWorkflow", mock.Anything, tclient.StartWorkflowOptions{ID: "job-1", TaskQueue: "q", Memo: map[string]any{"params": want}}, znclient.WorkflowType, want).
+		Return(wr, nil).Once()
+
+	resp, body := do(t, "POST", srv.URL+"/jobs?id=job-1", `{"ZoneURI":"s3://zones/com.zone.gz","OutputURI":"s3://out/com/names.txt","Filters":["NS"]}`)
+	if resp.StatusCode != http.StatusCreated || resp.Header.Get("Location") != "/jobs/job-1" || body["run_id"] != "run-1" {
+		t.Fatalf("create: %d %v", resp.StatusCode, body)
+	}
+
+	tc.On("ExecuteWorkflow", mock.Anything, mock.Anything, znclient.WorkflowType, want).
+		Return(nil, serviceerror.NewWorkflowExecutionAlreadyStarted("already started", "", "run-1")).Once()
+	if resp, body := do(t, "POST", srv.URL+"/jobs?id=job-1", `{"ZoneURI":"s3://zones/com.zone.gz","OutputURI":"s3://out/com/names.txt","Filters":["NS"]}`); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("duplicate: %d %v", resp.StatusCode, body)
+	}
+	tc.AssertExpectations(t)
+}
+
+func TestCreateInvalid(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{})
+	for body, want := range map[string]string{
+		`{"ZoneURI":"http://x/zone","OutputURI":"s3://o/names.txt"}`:           "ZoneURI",
+		`{"ZoneURI":"s3://z/a.zone","OutputURI":"s3://o/names.txt","Shard":3}`: "unknown field",
+		`not json`: "invalid body",
+		`{"ZoneURI":"s3://z/a.zone","OutputURI":"s3://o/n.txt","IDNMode":"puny"}`: "IDNMode",
+	} {
+		resp, m := do(t, "POST", srv.URL+"/jobs", body)
+		if resp.StatusCode != http.StatusBadRequest || !strings.Contains(m["error"].(string), want) {
+			t.Errorf("%s: %d %v", body, resp.StatusCode, m)
+		}
+	}
+	tc.AssertNotCalled(t, "ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCreateForbidden(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{AllowedPrefixes: []string{"s3://zones/", "s3://out/"}, NotifyPrefixes: []string{"https://hooks.example.com/"}})
+	for body, want := range map[string]string{
+		`{"ZoneURI":"file:///etc/passwd","OutputURI":"s3://out/names.txt"}`:                                           "file:///etc/passwd",
+		`{"ZoneURI":"s3://zones/a.zone","OutputURI":"file:///var/zone-names/names.txt"}`:                              "file:///var/zone-names/names.txt",
+		`{"ZoneURI":"s3://other/a.zone","OutputURI":"s3://out/names.txt"}`:                                            "s3://other/a.zone",
+		`{"ZoneURI":"s3://zones/../other/a.zone","OutputURI":"s3://out/names.txt"}`:                                   "s3://zones/../other/a.zone",
+		`{"ZoneURI":"s3://zones/a.zone","OutputURI":"s3://out/names.txt","Notify":{"URL":"http://169.254.169.254/"}}`: "notify URL",
+	} {
+		resp, m := do(t, "POST", srv.URL+"/jobs", body)
+		if resp.StatusCode != http.StatusForbidden || !strings.Contains(m["error"].(string), want) {
+			t.Errorf("%s: %d %v", body, resp.StatusCode, m)
+		}
+	}
+	// Without an allowlist, only s3:// is accepted and Notify is refused.
+	// Scratch options are never accepted.
+	srv = serve(t, tc, Options{})
+	for _, body := range []string{
+		`{"ZoneURI":"file:///etc/passwd","OutputURI":"s3://out/names.txt"}`,
+		`{"ZoneURI":"s3://zones/a.zone","OutputURI":"s3://out/names.txt","Notify":{"URL":"https://hooks.example.com/x"}}`,
+		`{"ZoneURI":"s3://zones/a.zone","OutputURI":"s3://out/names.txt","ScratchSubdir":"other-job"}`,
+		`{"ZoneURI":"s3://zones/a.zone","OutputURI":"s3://out/names.txt","KeepScratch":true}`,
+	} {
+		if resp, m := do(t, "POST", srv.URL+"/jobs", body); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("%s: %d %v", body, resp.StatusCode, m)
+		}
+	}
+	tc.AssertNotCalled(t, "ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+// TestCreateRendersTemplates checks that templates are rendered before the
+// allowlist check, and that the job starts with the rendered URIs.
+func TestCreateRendersTemplates(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{AllowedPrefixes: []string{"s3://zones/", "s3://out/"}})
+	body := `{"ZoneURI":"s3://zones/{{printf \"%c%c\" 46 46}}/other/a.zone","OutputURI":"s3://out/names.txt"}`
+	if resp, m := do(t, "POST", srv.URL+"/jobs", body); resp.StatusCode != http.StatusForbidden || !strings.Contains(m["error"].(string), "s3://zones/../other/a.zone") {
+		t.Fatalf("dot-dot template: %d %v", resp.StatusCode, m)
+	}
+	tc.AssertNotCalled(t, "ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	wr := &mocks.WorkflowRun{}
+	wr.On("GetID").Return("job-1")
+	wr.On("GetRunID").Return("run-1")
+	var got types.WorkflowParams
+	tc.On("ExecuteWorkflow", mock.Anything, mock.Anything, znclient.WorkflowType, mock.Anything).
+		Run(func(args mock.Arguments) { got = args.Get(3).(types.WorkflowParams) }).Return(wr, nil).Once()
+	body = `{"ZoneURI":"s3://zones/{{.Date}}/a.zone","OutputURI":"s3://out/{{.Date}}/names.txt"}`
+	if resp, m := do(t, "POST", srv.URL+"/jobs?id=job-1", body); resp.StatusCode != http.StatusCreated {
+		t.Fatalf("create: %d %v", resp.StatusCode, m)
+	}
+	if got.Templated() || !strings.HasPrefix(got.ZoneURI, "s3://zones/20") || !strings.HasPrefix(got.OutputURI, "s3://out/20") {
+		t.Fatalf("started with %+v", got)
+	}
+}
+
+func TestGetRunning(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{})
+	describe(tc, "job-1", enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING, types.WorkflowParams{
+		ZoneURI:   "s3://z/a.zone",
+		OutputURI: "s3://o/names.txt",
+		Notify:    &types.Notify{URL: "https://h/x", Secret: "s3cret"},
+	})
+	val := &mocks.Value{}
+	val.On("Get", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*types.Progress) = types.Progress{Phase: types.PhaseDeduping, Shards: 4, ShardsDeduped: 1}
+	}).Return(nil)
+	tc.On("QueryWorkflow", mock.Anything, "job-1", "run-job-1", types.QueryProgress).Return(val, nil)
+
+	resp, body := do(t, "GET", srv.URL+"/jobs/job-1", "")
+	if resp.StatusCode != http.StatusOK || body["status"] != "Running" || body["result"] != nil || body["closed_at"] != nil {
+		t.Fatalf("get: %d %v", resp.StatusCode, body)
+	}
+	if p := body["progress"].(map[string]any); p["Phase"] != types.PhaseDeduping || p["ShardsDeduped"] != 1.0 {
+		t.Fatalf("progress %v", p)
+	}
+	if n := body["params"].(map[string]any)["Notify"].(map[string]any); n["URL"] != "https://h/x" || n["Secret"] != "REDACTED" {
+		t.Fatalf("notify %v", n)
+	}
+	tc.AssertNotCalled(t, "GetWorkflow", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGetCompleted(t *testing.T) {
+	dir := t.TempDir()
+	out := "file://" + filepath.Join(dir, "names.txt")
+	man := types.Manifest{Version: 1, Output: types.FileInfo{URI: out, Bytes: 12}, Unique: 2}
+	b, _ := json.Marshal(man)
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{})
+	describe(tc, "job-2", enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED, types.WorkflowParams{ZoneURI: "s3://z/a.zone", OutputURI: out})
+	tc.On("QueryWorkflow", mock.Anything, "job-2", "run-job-2", types.QueryProgress).Return(nil, errors.New("closed"))
+	wr := &mocks.WorkflowRun{}
+	wr.On("Get", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { *args.Get(1).(*types.MergeStats) = types.MergeStats{Emitted: 2} }).Return(nil)
+	tc.On("GetWorkflow", mock.Anything, "job-2", "run-job-2").Return(wr)
+
+	resp, body := do(t, "GET", srv.URL+"/jobs/job-2", "")
+	if resp.StatusCode != http.StatusOK || body["status"] != "Completed" || body["closed_at"] == nil {
+		t.Fatalf("get: %d %v", resp.StatusCode, body)
+	}
+	links := body["links"].(map[string]any)
+	if body["result"].(map[string]any)["Emitted"] != 2.0 || body["manifest"].(map[string]any)["unique"] != 2.0 ||
+		links["output"] != out || links["manifest"] != "file://"+filepath.Join(dir, "manifest.json") {
+		t.Fatalf("body %v", body)
+	}
+}
+
+func TestGetFailed(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{})
+	describe(tc, "job-3", enumspb.WORKFLOW_EXECUTION_STATUS_FAILED, types.WorkflowParams{ZoneURI: "s3://z/a.zone", OutputURI: "s3://o/names.txt"})
+	tc.On("QueryWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("closed"))
+	wr := &mocks.WorkflowRun{}
+	wr.On("Get", mock.Anything, mock.Anything).Return(errors.New("partition: zone not found"))
+	tc.On("GetWorkflow", mock.Anything, "job-3", "run-job-3").Return(wr)
+
+	resp, body := do(t, "GET", srv.URL+"/jobs/job-3", "")
+	if resp.StatusCode != http.StatusOK || body["status"] != "Failed" || !strings.Contains(body["error"].(string), "zone not found") || body["manifest"] != nil {
+		t.Fatalf("get: %d %v", resp.StatusCode, body)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{})
+	tc.On("DescribeWorkflowExecution", mock.Anything, "nope", "").Return(nil, serviceerror.NewNotFound("workflow not found"))
+	for _, method := range []string{"GET", "DELETE"} {
+		if resp, body := do(t, method, srv.URL+"/jobs/nope", ""); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: %d %v", method, resp.StatusCode, body)
+		}
+	}
+}
+
+// TestOtherWorkflowType checks that the API only exposes and cancels
+// Zone2NamesWorkflow executions.
+func TestOtherWorkflowType(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{})
+	describeType(tc, "other", "BillingWorkflow", enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING, types.WorkflowParams{})
+	for _, method := range []string{"GET", "DELETE"} {
+		if resp, body := do(t, method, srv.URL+"/jobs/other", ""); resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: %d %v", method, resp.StatusCode, body)
+		}
+	}
+	tc.AssertNotCalled(t, "CancelWorkflow", mock.Anything, mock.Anything, mock.Anything)
+	tc.AssertNotCalled(t, "QueryWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestCancel(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{})
+	describe(tc, "job-1", enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING, types.WorkflowParams{})
+	describe(tc, "job-2", enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED, types.WorkflowParams{})
+	tc.On("CancelWorkflow", mock.Anything, "job-1", "run-job-1").Return(nil).Once()
+
+	if resp, body := do(t, "DELETE", srv.URL+"/jobs/job-1", ""); resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("cancel: %d %v", resp.StatusCode, body)
+	}
+	if resp, body := do(t, "DELETE", srv.URL+"/jobs/job-2", ""); resp.StatusCode != http.StatusConflict || !strings.Contains(body["error"].(string), "completed") {
+		t.Fatalf("cancel closed: %d %v", resp.StatusCode, body)
+	}
+	tc.AssertExpectations(t)
+}
+
+func TestToken(t *testing.T) {
+	tc := &mocks.Client{}
+	srv := serve(t, tc, Options{Token: "s3cret"})
+	describe(tc, "job-1", enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING, types.WorkflowParams{})
+	tc.On("QueryWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(nil, errors.New("no"))
+
+	if resp, _ := do(t, "GET", srv.URL+"/jobs/job-1", ""); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("no token: %d", resp.StatusCode)
+	}
+	if resp, _ := do(t, "GET", srv.URL+"/jobs/job-1", "", "Authorization", "Bearer wrong"); resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("wrong token: %d", resp.StatusCode)
+	}
+	if resp, _ := do(t, "GET", srv.URL+"/jobs/job-1", "", "Authorization", "Bearer s3cret"); resp.StatusCode != http.StatusOK {
+		t.Fatalf("token: %d", resp.StatusCode)
+	}
+}
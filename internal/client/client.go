@@ -0,0 +1,234 @@
+// Package client starts and tracks Zone2NamesWorkflow executions. It wraps a
+// Temporal client with the workflow's type, task queue, ID scheme and
+// progress query so callers (cmd/znctl, other services) don't repeat them.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	tclient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// WorkflowType is the registered name of Zone2NamesWorkflow.
+const WorkflowType = "Zone2NamesWorkflow"
+
+// DefaultTaskQueue is the task queue the worker polls unless configured otherwise.
+const DefaultTaskQueue = "zone-names"
+
+// Client starts and inspects Zone2NamesWorkflow executions.
+type Client struct {
+	tc        tclient.Client
+	taskQueue string
+}
+
+// New wraps tc. An empty taskQueue means DefaultTaskQueue.
+func New(tc tclient.Client, taskQueue string) *Client {
+	if taskQueue == "" {
+		taskQueue = DefaultTaskQueue
+	}
+	return &Client{tc: tc, taskQueue: taskQueue}
+}
+
+// Run identifies one workflow execution.
+type Run struct {
+	ID    string
+	RunID string
+}
+
+// Execution summarizes a workflow execution for status and list output.
+type Execution struct {
+	Run
+	Type      string // workflow type; WorkflowType for runs of this package
+	Status    string // Temporal status: Running, Completed, Failed, Canceled, ...
+	StartTime time.Time
+	CloseTime time.Time // zero while running
+	// Params are the parameters the run was started with, from its memo;
+	// zero for runs not started through this package.
+	Params types.WorkflowParams
+}
+
+// memoParams is the memo key under which Start records the parameters.
+const memoParams = "params"
+
+// Running reports whether the execution has not closed yet.
+func (e Execution) Running() bool {
+	return e.Status == enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING.String()
+}
+
+// Start validates p and starts a workflow. An empty id is derived from the
+// zone and the current time with WorkflowID. Templated fields are left for
+// the workflow to render.
+func (c *Client) Start(ctx context.Context, id string, p types.WorkflowParams) (Run, error) {
+	if err := p.Validate(); err != nil {
+		return Run{}, err
+	}
+	if id == "" {
+		now := time.Now()
+		zone := p.ZoneURI
+		if r, err := p.Render(now); err == nil {
+			zone = r.ZoneURI
+		}
+		id = WorkflowID(zone, now)
+	}
+	opts := tclient.StartWorkflowOptions{ID: id, TaskQueue: c.taskQueue, Memo: map[string]any{memoParams: Redacted(p)}}
+	wr, err := c.tc.ExecuteWorkflow(ctx, opts, WorkflowType, p)
+	if err != nil {
+		return Run{}, err
+	}
+	return Run{ID: wr.GetID(), RunID: wr.GetRunID()}, nil
+}
+
+// Redacted returns p with the webhook secret masked. The memo is returned by
+// every list and describe call and shown in the Temporal UI, so it only ever
+// holds redacted params.
+func Redacted(p types.WorkflowParams) types.WorkflowParams {
+	if p.Notify != nil && p.Notify.Secret != "" {
+		n := *p.Notify
+		n.Secret = "REDACTED"
+		p.Notify = &n
+	}
+	return p
+}
+
+// Wait blocks until the execution closes and returns its result. An empty
+// runID means the latest run of id.
+func (c *Client) Wait(ctx context.Context, id, runID string) (types.MergeStats, error) {
+	var ms types.MergeStats
+	err := c.tc.GetWorkflow(ctx, id, runID).Get(ctx, &ms)
+	return ms, err
+}
+
+// Progress queries a running (or recently closed) execution for its progress.
+func (c *Client) Progress(ctx context.Context, id, runID string) (types.Progress, error) {
+	v, err := c.tc.QueryWorkflow(ctx, id, runID, types.QueryProgress)
+	if err != nil {
+		return types.Progress{}, err
+	}
+	var p types.Progress
+	err = v.Get(&p)
+	return p, err
+}
+
+// Follow waits like Wait, calling fn with the execution's progress every
+// interval whenever it changed. Failed queries are skipped; the workflow may
+// not have started on a worker yet.
+func (c *Client) Follow(ctx context.Context, id, runID string, interval time.Duration, fn func(types.Progress)) (types.MergeStats, error) {
+	type result struct {
+		ms  types.MergeStats
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		ms, err := c.Wait(ctx, id, runID)
+		done <- result{ms, err}
+	}()
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	var last types.Progress
+	for {
+		select {
+		case r := <-done:
+			return r.ms, r.err
+		case <-t.C:
+			if p, err := c.Progress(ctx, id, runID); err == nil && p != last {
+				last = p
+				fn(p)
+			}
+		}
+	}
+}
+
+// Describe returns the execution's status.
+func (c *Client) Describe(ctx context.Context, id, runID string) (Execution, error) {
+	resp, err := c.tc.DescribeWorkflowExecution(ctx, id, runID)
+	if err != nil {
+		return Execution{}, err
+	}
+	info := resp.GetWorkflowExecutionInfo()
+	if info == nil {
+		return Execution{}, errors.New("describe: no execution info for " + id)
+	}
+	return execution(info), nil
+}
+
+// Cancel requests cancellation of the execution.
+func (c *Client) Cancel(ctx context.Context, id, runID string) error {
+	return c.tc.CancelWorkflow(ctx, id, runID)
+}
+
+// List returns up to limit of the most recent executions, newest first.
+// filter is an optional visibility query ANDed with the workflow type, e.g.
+// "ExecutionStatus = 'Running'".
+func (c *Client) List(ctx context.Context, filter string, limit int) ([]Execution, error) {
+	query := fmt.Sprintf("WorkflowType = '%s'", WorkflowType)
+	if filter != "" {
+		query += " AND (" + filter + ")"
+	}
+	var out []Execution
+	var token []byte
+	for len(out) < limit {
+		resp, err := c.tc.ListWorkflow(ctx, &workflowservice.ListWorkflowExecutionsRequest{
+			Query:         query,
+			PageSize:      int32(min(limit-len(out), 1000)),
+			NextPageToken: token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range resp.GetExecutions() {
+			if len(out) == limit {
+				break
+			}
+			out = append(out, execution(info))
+		}
+		if token = resp.GetNextPageToken(); len(token) == 0 {
+			break
+		}
+	}
+	return out, nil
+}
+
+func execution(info *workflowpb.WorkflowExecutionInfo) Execution {
+	e := Execution{
+		Run:       Run{ID: info.GetExecution().GetWorkflowId(), RunID: info.GetExecution().GetRunId()},
+		Type:      info.GetType().GetName(),
+		Status:    info.GetStatus().String(),
+		StartTime: info.GetStartTime().AsTime(),
+	}
+	if info.GetCloseTime() != nil {
+		e.CloseTime = info.GetCloseTime().AsTime()
+	}
+	if pl := info.GetMemo().GetFields()[memoParams]; pl != nil {
+		_ = converter.GetDefaultDataConverter().FromPayload(pl, &e.Params)
+	}
+	return e
+}
+
+var unsafeID = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// WorkflowID derives a readable ID from the zone file name and a start time,
+// e.g. "zone-names-com-20240501T060000Z" for s3://zones/com.zone.gz. The ID
+// doubles as the default scratch subdirectory, so it only uses [a-z0-9.-].
+func WorkflowID(zoneURI string, t time.Time) string {
+	stem := strings.ToLower(path.Base(zoneURI))
+	for _, ext := range []string{".gz", ".zone", ".txt"} {
+		stem = strings.TrimSuffix(stem, ext)
+	}
+	stem = strings.Trim(unsafeID.ReplaceAllString(stem, "-"), "-.")
+	if stem == "" {
+		stem = "zone"
+	}
+	return "zone-names-" + stem + "-" + t.UTC().Format("20060102T150405Z")
+}
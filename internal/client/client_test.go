@@ -0,0 +1,223 @@
+package client
+
+import (
+	"context"
+	"flag"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	tclient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/mocks"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+func validParams() types.WorkflowParams {
+	return types.WorkflowParams{ZoneURI: "s3://zones/com.zone.gz", OutputURI: "s3://out/com/names.txt", Shards: 8}
+}
+
+func TestStart(t *testing.T) {
+	tc := &mocks.Client{}
+	run := &mocks.WorkflowRun{}
+	run.On("GetID").Return("my-id")
+	run.On("GetRunID").Return("run-1")
+	tc.On("ExecuteWorkflow", mock.Anything,
+		tclient.StartWorkflowOptions{ID: "my-id", TaskQueue: "q", Memo: map[string]any{"params": validParams()}}, WorkflowType, validParams()).Return(run, nil).Once()
+
+	got, err := New(tc, "q").Start(context.Background(), "my-id", validParams())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != (Run{ID: "my-id", RunID: "run-1"}) {
+		t.Fatalf("run %+v", got)
+	}
+	tc.AssertExpectations(t)
+}
+
+// TestStartRedactsMemo checks that the webhook secret reaches the workflow
+// input but not the memo, which list views and the UI show.
+func TestStartRedactsMemo(t *testing.T) {
+	tc := &mocks.Client{}
+	run := &mocks.WorkflowRun{}
+	run.On("GetID").Return("my-id")
+	run.On("GetRunID").Return("run-1")
+	p := validParams()
+	p.Notify = &types.Notify{URL: "https://h/x", Secret: "k"}
+	memo := validParams()
+	memo.Notify = &types.Notify{URL: "https://h/x", Secret: "REDACTED"}
+	tc.On("ExecuteWorkflow", mock.Anything,
+		tclient.StartWorkflowOptions{ID: "my-id", TaskQueue: "q", Memo: map[string]any{"params": memo}}, WorkflowType, p).Return(run, nil).Once()
+
+	if _, err := New(tc, "q").Start(context.Background(), "my-id", p); err != nil {
+		t.Fatal(err)
+	}
+	tc.AssertExpectations(t)
+	if p.Notify.Secret != "k" {
+		t.Fatal("Redacted modified the caller's params")
+	}
+}
+
+func TestStartDefaultID(t *testing.T) {
+	tc := &mocks.Client{}
+	run := &mocks.WorkflowRun{}
+	run.On("GetID").Return("x")
+	run.On("GetRunID").Return("y")
+	var opts tclient.StartWorkflowOptions
+	tc.On("ExecuteWorkflow", mock.Anything, mock.Anything, WorkflowType, mock.Anything).
+		Run(func(args mock.Arguments) { opts = args.Get(1).(tclient.StartWorkflowOptions) }).Return(run, nil)
+
+	if _, err := New(tc, "").Start(context.Background(), "", validParams()); err != nil {
+		t.Fatal(err)
+	}
+	if opts.TaskQueue != DefaultTaskQueue || len(opts.ID) != len("zone-names-com-20060102T150405Z") {
+		t.Fatalf("options %+v", opts)
+	}
+}
+
+func TestStartRejectsInvalidParams(t *testing.T) {
+	tc := &mocks.Client{}
+	p := validParams()
+	p.IDNMode = "punycode"
+	if _, err := New(tc, "").Start(context.Background(), "", p); err == nil {
+		t.Fatal("expected validation error")
+	}
+	tc.AssertNotCalled(t, "ExecuteWorkflow", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestProgressAndFollow(t *testing.T) {
+	tc := &mocks.Client{}
+	steps := []types.Progress{
+		{Phase: types.PhasePartitioning},
+		{Phase: types.PhasePartitioning},
+		{Phase: types.PhaseDeduping, Shards: 2, ShardsDeduped: 1},
+	}
+	calls := 0
+	val := &mocks.Value{}
+	val.On("Get", mock.Anything).Run(func(args mock.Arguments) {
+		*args.Get(0).(*types.Progress) = steps[min(calls, len(steps)-1)]
+		calls++
+	}).Return(nil)
+	tc.On("QueryWorkflow", mock.Anything, "wf", "", types.QueryProgress).Return(val, nil)
+
+	run := &mocks.WorkflowRun{}
+	run.On("Get", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		time.Sleep(100 * time.Millisecond)
+		*args.Get(1).(*types.MergeStats) = types.MergeStats{Emitted: 42}
+	}).Return(nil)
+	tc.On("GetWorkflow", mock.Anything, "wf", "").Return(run)
+
+	c := New(tc, "")
+	p, err := c.Progress(context.Background(), "wf", "")
+	if err != nil || p.Phase != types.PhasePartitioning {
+		t.Fatalf("progress %+v %v", p, err)
+	}
+
+	var seen []types.Progress
+	ms, err := c.Follow(context.Background(), "wf", "", 10*time.Millisecond, func(p types.Progress) { seen = append(seen, p) })
+	if err != nil || ms.Emitted != 42 {
+		t.Fatalf("follow %+v %v", ms, err)
+	}
+	// Unchanged progress is reported once.
+	if len(seen) != 2 || seen[0].Phase != types.PhasePartitioning || seen[1].ShardsDeduped != 1 {
+		t.Fatalf("seen %+v", seen)
+	}
+}
+
+func TestList(t *testing.T) {
+	tc := &mocks.Client{}
+	info := func(id string, closed bool) *workflowpb.WorkflowExecutionInfo {
+		i := &workflowpb.WorkflowExecutionInfo{
+			Execution: &commonpb.WorkflowExecution{WorkflowId: id, RunId: "r-" + id},
+			Status:    enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING,
+			StartTime: timestamppb.New(time.Unix(1000, 0)),
+		}
+		if closed {
+			i.Status = enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED
+			i.CloseTime = timestamppb.New(time.Unix(2000, 0))
+		}
+		return i
+	}
+	const query = "WorkflowType = 'Zone2NamesWorkflow' AND (ExecutionStatus = 'Running')"
+	tc.On("ListWorkflow", mock.Anything, mock.MatchedBy(func(r *workflowservice.ListWorkflowExecutionsRequest) bool {
+		return r.Query == query && len(r.NextPageToken) == 0
+	})).Return(&workflowservice.ListWorkflowExecutionsResponse{
+		Executions:    []*workflowpb.WorkflowExecutionInfo{info("a", false), info("b", true)},
+		NextPageToken: []byte("next"),
+	}, nil).Once()
+	tc.On("ListWorkflow", mock.Anything, mock.MatchedBy(func(r *workflowservice.ListWorkflowExecutionsRequest) bool {
+		return string(r.NextPageToken) == "next" && r.PageSize == 1
+	})).Return(&workflowservice.ListWorkflowExecutionsResponse{
+		Executions: []*workflowpb.WorkflowExecutionInfo{info("c", false), info("d", false)},
+	}, nil).Once()
+
+	got, err := New(tc, "").List(context.Background(), "ExecutionStatus = 'Running'", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 || got[0].ID != "a" || !got[0].Running() || !got[0].CloseTime.IsZero() ||
+		got[1].Status != "Completed" || got[1].CloseTime.Unix() != 2000 || got[2].RunID != "r-c" {
+		t.Fatalf("list %+v", got)
+	}
+	tc.AssertExpectations(t)
+}
+
+func TestWorkflowID(t *testing.T) {
+	ts := time.Date(2024, 5, 1, 6, 0, 0, 0, time.FixedZone("x", 3600))
+	for in, want := range map[string]string{
+		"s3://zones/com.zone.gz":         "zone-names-com-20240501T050000Z",
+		"file:///data/Org.TXT.gz":        "zone-names-org-20240501T050000Z",
+		"s3://zones/net.txt":             "zone-names-net-20240501T050000Z",
+		"s3://zones/xn--p1ai zone.gz":    "zone-names-xn--p1ai-zone-20240501T050000Z",
+		"s3://zones/../":                 "zone-names-zone-20240501T050000Z",
+		"s3://zones/dotted.name.zone.gz": "zone-names-dotted.name-20240501T050000Z",
+	} {
+		if got := WorkflowID(in, ts); got != want {
+			t.Errorf("WorkflowID(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestBindParamFlags(t *testing.T) {
+	var p types.WorkflowParams
+	fs := flag.NewFlagSet("x", flag.ContinueOnError)
+	BindParamFlags(fs, &p)
+	err := fs.Parse([]string{"--zone", "s3://z/com.zone.gz", "--out", "s3://o/names.txt", "--filter", "a, ns", "--filter", "AAAA", "--layout", "parts", "--force", "--max-parallel-dedupe", "8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Shards != 32 || len(p.Filters) != 3 || p.Filters[1] != "NS" || p.OutputLayout.Mode != types.LayoutParts || !p.Force || p.MaxParallelDedupe != 8 || p.IDNMode != "" || p.Notify != nil {
+		t.Fatalf("params %+v", p)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	fs = flag.NewFlagSet("x", flag.ContinueOnError)
+	BindParamFlags(fs, &p)
+	if err := fs.Parse([]string{"--notify-url", "https://h/x", "--notify-secret", "k", "--notify-event", "Failed, skipped"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := p.Notify; n == nil || n.URL != "https://h/x" || n.Secret != "k" || len(n.Events) != 2 || n.Events[0] != types.EventFailed {
+		t.Fatalf("notify %+v", p.Notify)
+	}
+
+	fs = flag.NewFlagSet("x", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	BindParamFlags(fs, &p)
+	if err := fs.Parse([]string{"--shards", "auto", "--target-shard-bytes", "1048576"}); err != nil {
+		t.Fatal(err)
+	}
+	if p.ShardMode != types.ShardsAuto || p.Shards != 0 || p.TargetShardBytes != 1<<20 {
+		t.Fatalf("auto shards %+v", p)
+	}
+	if err := fs.Parse([]string{"--shards", "many"}); err == nil {
+		t.Fatal("want error for --shards many")
+	}
+}
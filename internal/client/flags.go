@@ -0,0 +1,87 @@
+package client
+
+import (
+	"errors"
+	"flag"
+	"strconv"
+	"strings"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// BindParamFlags registers flags for the WorkflowParams fields that describe
+// the extraction on fs, writing into p. Defaults are left empty so that the
+// workflow applies them (and manifests record only what was asked for);
+// --shards defaults to 32.
+func BindParamFlags(fs *flag.FlagSet, p *types.WorkflowParams) {
+	fs.StringVar(&p.ZoneURI, "zone", "", "zone file URI, file:// or s3:// (.gz is decompressed)")
+	fs.StringVar(&p.OutputURI, "out", "", "output URI, file:// or s3://")
+	p.Shards = types.DefaultShards
+	fs.Func("shards", "number of shards, or auto to pick it from the input size (default 32)", func(v string) error {
+		if v == types.ShardsAuto {
+			p.Shards, p.ShardMode = 0, types.ShardsAuto
+			return nil
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New("want a number or auto")
+		}
+		p.Shards, p.ShardMode = n, ""
+		return nil
+	})
+	fs.Int64Var(&p.TargetShardBytes, "target-shard-bytes", 0, "uncompressed zone bytes per shard with --shards auto (default 256 MiB)")
+	fs.Var((*listFlag)(&p.Filters), "filter", "RR type to include; repeat or comma-separate (default: all types)")
+	fs.StringVar(&p.IDNMode, "idn", "", "IDN conversion: alabel, ulabel or none (default none)")
+	fs.StringVar(&p.OutputFormat, "format", "", "output format: text or parquet (default text)")
+	fs.StringVar(&p.SortOrder, "sort", "", "sort order: bytes or canonical (default bytes)")
+	fs.StringVar(&p.MergeStrategy, "merge", "", "merge strategy: single, hierarchical or concat (default single)")
+	fs.IntVar(&p.MergeFanIn, "fan-in", 0, "shards per hierarchical merge step (default 32)")
+	fs.Int64Var(&p.SplitShardBytes, "split-shard-bytes", 0, "split shards above this size before dedupe; -1 disables (default: 4x the mean shard size, at least 64 MiB)")
+	fs.IntVar(&p.MaxParallelDedupe, "max-parallel-dedupe", 0, "most shard dedupes running at once (default: all shards)")
+	fs.StringVar(&p.OutputLayout.Mode, "layout", "", "output layout: single or parts (default single)")
+	fs.Int64Var(&p.OutputLayout.PartMaxBytes, "part-max-bytes", 0, "uncompressed bytes per part, parts layout (default 256 MiB)")
+	fs.StringVar(&p.OutputLayout.Compression, "compression", "", "part compression, parts layout: zstd or none (default zstd)")
+	fs.StringVar(&p.TimeZone, "time-zone", "", "IANA time zone template dates are rendered in (default UTC)")
+	fs.StringVar(&p.MetricsZone, "metrics-zone", "", "zone label on metrics (default: the zone file's name if it looks like a TLD, else other)")
+	fs.BoolVar(&p.AllowInclude, "allow-include", false, "let a local zone $INCLUDE files under its own directory")
+	fs.BoolVar(&p.Force, "force", false, "run even if the input is unchanged since the previous run")
+	fs.BoolVar(&p.KeepScratch, "keep-scratch", false, "keep shard files after the run")
+
+	// The Notify block is only allocated when one of its flags is given.
+	notify := func() *types.Notify {
+		if p.Notify == nil {
+			p.Notify = &types.Notify{}
+		}
+		return p.Notify
+	}
+	fs.Func("notify-url", "webhook `URL` called when the run finishes", func(v string) error {
+		notify().URL = v
+		return nil
+	})
+	fs.Func("notify-secret", "HMAC-SHA256 key for signing webhook requests", func(v string) error {
+		notify().Secret = v
+		return nil
+	})
+	fs.Func("notify-event", "webhook event: succeeded, skipped or failed; repeat or comma-separate (default: all)", func(v string) error {
+		for _, e := range strings.Split(v, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				notify().Events = append(notify().Events, strings.ToLower(e))
+			}
+		}
+		return nil
+	})
+}
+
+// listFlag collects repeated and comma-separated RR types, upper-cased.
+type listFlag []string
+
+func (l *listFlag) String() string { return strings.Join(*l, ",") }
+
+func (l *listFlag) Set(v string) error {
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, strings.ToUpper(s))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	tclient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/temporal"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// ScheduleConfig describes a recurring extraction: a Temporal Schedule that
+// starts Zone2NamesWorkflow with Params. Params may use {{.Date}} and the
+// other types.TemplateData fields; each run renders them for its schedule
+// time, in TimeZone unless Params sets its own.
+type ScheduleConfig struct {
+	// ID names the schedule. Runs get workflow IDs "<ID>-<schedule time>".
+	ID string `json:"id"`
+	// Cron holds cron expressions ("0 6 * * *"); a run is due whenever any matches.
+	Cron []string `json:"cron"`
+	// TimeZone is the IANA zone the cron expressions are read in (default UTC).
+	TimeZone string `json:"time_zone,omitempty"`
+	// Overlap says what happens when a run is due while the previous one is
+	// still running; see OverlapPolicies. Default "skip".
+	Overlap string `json:"overlap,omitempty"`
+	// CatchupWindow is how late a missed run (e.g. after a server outage) may
+	// still be started, as a Go duration. Default: the server's (one year).
+	// Older misses need Backfill.
+	CatchupWindow string `json:"catchup_window,omitempty"`
+	// Paused creates the schedule paused. Applying a config never changes the
+	// paused state of an existing schedule.
+	Paused bool                 `json:"paused,omitempty"`
+	Note   string               `json:"note,omitempty"`
+	Params types.WorkflowParams `json:"params"`
+}
+
+// OverlapPolicies maps the overlap names used in configs and flags to
+// Temporal's policies.
+var OverlapPolicies = map[string]enumspb.ScheduleOverlapPolicy{
+	"skip":            enumspb.SCHEDULE_OVERLAP_POLICY_SKIP,
+	"buffer-one":      enumspb.SCHEDULE_OVERLAP_POLICY_BUFFER_ONE,
+	"buffer-all":      enumspb.SCHEDULE_OVERLAP_POLICY_BUFFER_ALL,
+	"cancel-other":    enumspb.SCHEDULE_OVERLAP_POLICY_CANCEL_OTHER,
+	"terminate-other": enumspb.SCHEDULE_OVERLAP_POLICY_TERMINATE_OTHER,
+	"allow-all":       enumspb.SCHEDULE_OVERLAP_POLICY_ALLOW_ALL,
+}
+
+func overlapPolicy(name, def string) (enumspb.ScheduleOverlapPolicy, error) {
+	if name == "" {
+		name = def
+	}
+	if o, ok := OverlapPolicies[name]; ok {
+		return o, nil
+	}
+	names := make([]string, 0, len(OverlapPolicies))
+	for n := range OverlapPolicies {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return 0, fmt.Errorf("unknown overlap policy %q (want one of %s)", name, strings.Join(names, ", "))
+}
+
+// Validate reports the first problem with s, or nil.
+func (s ScheduleConfig) Validate() error {
+	if s.ID == "" {
+		return errors.New("schedule: id is required")
+	}
+	if len(s.Cron) == 0 {
+		return fmt.Errorf("schedule %s: at least one cron expression is required", s.ID)
+	}
+	if s.TimeZone != "" {
+		if _, err := time.LoadLocation(s.TimeZone); err != nil {
+			return fmt.Errorf("schedule %s: time_zone: %w", s.ID, err)
+		}
+	}
+	if _, err := overlapPolicy(s.Overlap, "skip"); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.ID, err)
+	}
+	if s.CatchupWindow != "" {
+		if d, err := time.ParseDuration(s.CatchupWindow); err != nil || d < time.Minute {
+			return fmt.Errorf("schedule %s: catchup_window must be a duration of at least 1m, got %q", s.ID, s.CatchupWindow)
+		}
+	}
+	if err := s.Params.Validate(); err != nil {
+		return fmt.Errorf("schedule %s: %w", s.ID, err)
+	}
+	return nil
+}
+
+func (c *Client) scheduleAction(s ScheduleConfig) *tclient.ScheduleWorkflowAction {
+	p := s.Params
+	if p.TimeZone == "" {
+		p.TimeZone = s.TimeZone
+	}
+	return &tclient.ScheduleWorkflowAction{
+		ID:        s.ID,
+		Workflow:  WorkflowType,
+		Args:      []any{p},
+		TaskQueue: c.taskQueue,
+		Memo:      map[string]any{memoParams: Redacted(p)},
+	}
+}
+
+// ApplySchedule creates the schedule, or updates its spec, action and
+// policies if it already exists. It reports whether it was created.
+func (c *Client) ApplySchedule(ctx context.Context, s ScheduleConfig) (bool, error) {
+	if err := s.Validate(); err != nil {
+		return false, err
+	}
+	spec := tclient.ScheduleSpec{CronExpressions: s.Cron, TimeZoneName: s.TimeZone}
+	overlap, _ := overlapPolicy(s.Overlap, "skip")
+	var catchup time.Duration
+	if s.CatchupWindow != "" {
+		catchup, _ = time.ParseDuration(s.CatchupWindow)
+	}
+
+	_, err := c.tc.ScheduleClient().Create(ctx, tclient.ScheduleOptions{
+		ID:            s.ID,
+		Spec:          spec,
+		Action:        c.scheduleAction(s),
+		Overlap:       overlap,
+		CatchupWindow: catchup,
+		Paused:        s.Paused,
+		Note:          s.Note,
+	})
+	if err == nil {
+		return true, nil
+	}
+	if !errors.Is(err, temporal.ErrScheduleAlreadyRunning) {
+		return false, err
+	}
+	err = c.tc.ScheduleClient().GetHandle(ctx, s.ID).Update(ctx, tclient.ScheduleUpdateOptions{
+		DoUpdate: func(in tclient.ScheduleUpdateInput) (*tclient.ScheduleUpdate, error) {
+			sched := in.Description.Schedule
+			sched.Spec = &spec
+			sched.Action = c.scheduleAction(s)
+			sched.Policy = &tclient.SchedulePolicies{Overlap: overlap, CatchupWindow: catchup}
+			return &tclient.ScheduleUpdate{Schedule: &sched}, nil
+		},
+	})
+	return false, err
+}
+
+// Schedule summarizes a schedule for list and describe output.
+type Schedule struct {
+	ID      string
+	Cron    []string
+	Paused  bool
+	Note    string
+	Recent  []time.Time // schedule times of the most recent runs, oldest first
+	Next    []time.Time
+	Running []Run // only filled by DescribeSchedule
+	Params  types.WorkflowParams
+}
+
+// ListSchedules returns the schedules that start Zone2NamesWorkflow.
+func (c *Client) ListSchedules(ctx context.Context) ([]Schedule, error) {
+	it, err := c.tc.ScheduleClient().List(ctx, tclient.ScheduleListOptions{PageSize: 100})
+	if err != nil {
+		return nil, err
+	}
+	var out []Schedule
+	for it.HasNext() {
+		e, err := it.Next()
+		if err != nil {
+			return nil, err
+		}
+		if e.WorkflowType.Name != WorkflowType {
+			continue
+		}
+		s := Schedule{ID: e.ID, Paused: e.Paused, Note: e.Note, Next: e.NextActionTimes}
+		if e.Spec != nil {
+			s.Cron = e.Spec.CronExpressions
+		}
+		for _, a := range e.RecentActions {
+			s.Recent = append(s.Recent, a.ScheduleTime)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// DescribeSchedule returns one schedule's state, including its running workflows.
+func (c *Client) DescribeSchedule(ctx context.Context, id string) (Schedule, error) {
+	d, err := c.tc.ScheduleClient().GetHandle(ctx, id).Describe(ctx)
+	if err != nil {
+		return Schedule{}, err
+	}
+	s := Schedule{ID: id, Next: d.Info.NextActionTimes}
+	if sp := d.Schedule.Spec; sp != nil {
+		s.Cron = sp.CronExpressions
+	}
+	if st := d.Schedule.State; st != nil {
+		s.Paused, s.Note = st.Paused, st.Note
+	}
+	for _, a := range d.Info.RecentActions {
+		s.Recent = append(s.Recent, a.ScheduleTime)
+	}
+	for _, r := range d.Info.RunningWorkflows {
+		s.Running = append(s.Running, Run{ID: r.WorkflowID, RunID: r.FirstExecutionRunID})
+	}
+	if a, ok := d.Schedule.Action.(*tclient.ScheduleWorkflowAction); ok && len(a.Args) == 1 {
+		// Described arguments come back as undecoded payloads.
+		if pl, ok := a.Args[0].(*commonpb.Payload); ok {
+			_ = converter.GetDefaultDataConverter().FromPayload(pl, &s.Params)
+		}
+	}
+	return s, nil
+}
+
+// Backfill starts the runs the schedule would have started between from and
+// to, each rendering its templates for its own schedule time. overlap
+// defaults to "buffer-all", which runs them one after another.
+func (c *Client) Backfill(ctx context.Context, id string, from, to time.Time, overlap string) error {
+	if !from.Before(to) {
+		return fmt.Errorf("backfill: empty range %s..%s", from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	o, err := overlapPolicy(overlap, "buffer-all")
+	if err != nil {
+		return err
+	}
+	return c.tc.ScheduleClient().GetHandle(ctx, id).Backfill(ctx, tclient.ScheduleBackfillOptions{
+		Backfill: []tclient.ScheduleBackfill{{Start: from, End: to, Overlap: o}},
+	})
+}
+
+// TriggerSchedule starts a run now, as if the schedule were due.
+func (c *Client) TriggerSchedule(ctx context.Context, id string) error {
+	return c.tc.ScheduleClient().GetHandle(ctx, id).Trigger(ctx, tclient.ScheduleTriggerOptions{})
+}
+
+// PauseSchedule stops the schedule from starting runs until UnpauseSchedule.
+func (c *Client) PauseSchedule(ctx context.Context, id, note string) error {
+	return c.tc.ScheduleClient().GetHandle(ctx, id).Pause(ctx, tclient.SchedulePauseOptions{Note: note})
+}
+
+// UnpauseSchedule resumes a paused schedule.
+func (c *Client) UnpauseSchedule(ctx context.Context, id, note string) error {
+	return c.tc.ScheduleClient().GetHandle(ctx, id).Unpause(ctx, tclient.ScheduleUnpauseOptions{Note: note})
+}
+
+// DeleteSchedule deletes the schedule; runs it already started are not affected.
+func (c *Client) DeleteSchedule(ctx context.Context, id string) error {
+	return c.tc.ScheduleClient().GetHandle(ctx, id).Delete(ctx)
+}
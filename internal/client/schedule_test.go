@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	commonpb "go.temporal.io/api/common/v1"
+	enumspb "go.temporal.io/api/enums/v1"
+	tclient "go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/converter"
+	"go.temporal.io/sdk/mocks"
+	"go.temporal.io/sdk/temporal"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+func dailyCom() ScheduleConfig {
+	return ScheduleConfig{
+		ID:            "com-daily",
+		Cron:          []string{"0 6 * * *"},
+		CatchupWindow: "48h",
+		Params: types.WorkflowParams{
+			ZoneURI:   "s3://zones/{{.Date}}/com.zone.gz",
+			OutputURI: "s3://out/com/{{.Date}}/names.txt",
+			Filters:   []string{"NS"},
+		},
+	}
+}
+
+func scheduleMocks() (*mocks.Client, *mocks.ScheduleClient, *mocks.ScheduleHandle) {
+	tc, sc, h := &mocks.Client{}, &mocks.ScheduleClient{}, &mocks.ScheduleHandle{}
+	tc.On("ScheduleClient").Return(sc)
+	sc.On("GetHandle", mock.Anything, "com-daily").Return(h)
+	return tc, sc, h
+}
+
+func TestApplyScheduleCreates(t *testing.T) {
+	tc, sc, _ := scheduleMocks()
+	var opts tclient.ScheduleOptions
+	sc.On("Create", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { opts = args.Get(1).(tclient.ScheduleOptions) }).Return(&mocks.ScheduleHandle{}, nil).Once()
+
+	cfg := dailyCom()
+	cfg.TimeZone = "Europe/Berlin"
+	cfg.Params.Notify = &types.Notify{URL: "https://h/x", Secret: "k"}
+	created, err := New(tc, "q").ApplySchedule(context.Background(), cfg)
+	if err != nil || !created {
+		t.Fatalf("apply: %v %v", created, err)
+	}
+	// Runs render their templates in the schedule's time zone.
+	want := cfg.Params
+	want.TimeZone = "Europe/Berlin"
+	a, ok := opts.Action.(*tclient.ScheduleWorkflowAction)
+	if !ok || a.ID != "com-daily" || a.Workflow != WorkflowType || a.TaskQueue != "q" || !reflect.DeepEqual(a.Args, []any{want}) {
+		t.Fatalf("action %+v", opts.Action)
+	}
+	// The secret goes to the workflow input only; the memo is redacted.
+	if m := a.Memo[memoParams].(types.WorkflowParams); m.Notify.Secret != "REDACTED" || m.TimeZone != "Europe/Berlin" {
+		t.Fatalf("memo %+v", m)
+	}
+	if opts.ID != "com-daily" || opts.Spec.CronExpressions[0] != "0 6 * * *" || opts.Spec.TimeZoneName != "Europe/Berlin" ||
+		opts.Overlap != enumspb.SCHEDULE_OVERLAP_POLICY_SKIP || opts.CatchupWindow != 48*time.Hour {
+		t.Fatalf("options %+v", opts)
+	}
+}
+
+func TestApplyScheduleUpdates(t *testing.T) {
+	tc, sc, h := scheduleMocks()
+	sc.On("Create", mock.Anything, mock.Anything).Return(nil, temporal.ErrScheduleAlreadyRunning)
+	var update tclient.ScheduleUpdateOptions
+	h.On("Update", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { update = args.Get(1).(tclient.ScheduleUpdateOptions) }).Return(nil).Once()
+
+	s := dailyCom()
+	s.Overlap = "buffer-one"
+	created, err := New(tc, "q").ApplySchedule(context.Background(), s)
+	if err != nil || created {
+		t.Fatalf("apply: %v %v", created, err)
+	}
+	// The existing state (paused, note) is kept; spec, action and policy are replaced.
+	in := tclient.ScheduleUpdateInput{Description: tclient.ScheduleDescription{Schedule: tclient.Schedule{
+		Spec:  &tclient.ScheduleSpec{CronExpressions: []string{"0 0 * * *"}},
+		State: &tclient.ScheduleState{Paused: true, Note: "maintenance"},
+	}}}
+	u, err := update.DoUpdate(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !u.Schedule.State.Paused || u.Schedule.Spec.CronExpressions[0] != "0 6 * * *" ||
+		u.Schedule.Policy.Overlap != enumspb.SCHEDULE_OVERLAP_POLICY_BUFFER_ONE || u.Schedule.Action.(*tclient.ScheduleWorkflowAction).ID != "com-daily" {
+		t.Fatalf("update %+v", u.Schedule)
+	}
+	h.AssertExpectations(t)
+}
+
+func TestScheduleConfigValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		mut  func(*ScheduleConfig)
+		want string
+	}{
+		"no id":       {func(s *ScheduleConfig) { s.ID = "" }, "id is required"},
+		"no cron":     {func(s *ScheduleConfig) { s.Cron = nil }, "cron"},
+		"bad zone":    {func(s *ScheduleConfig) { s.TimeZone = "Mars/Olympus" }, "time_zone"},
+		"bad overlap": {func(s *ScheduleConfig) { s.Overlap = "queue" }, "overlap"},
+		"bad catchup": {func(s *ScheduleConfig) { s.CatchupWindow = "2d" }, "catchup_window"},
+		"bad params":  {func(s *ScheduleConfig) { s.Params.ZoneURI = "s3://zones/{{.Day}}/com.zone.gz" }, "ZoneURI"},
+	} {
+		s := dailyCom()
+		tc.mut(&s)
+		if err := s.Validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want error containing %q", name, err, tc.want)
+		}
+	}
+}
+
+func TestBackfillAndDescribe(t *testing.T) {
+	tc, _, h := scheduleMocks()
+	c := New(tc, "q")
+	from, to := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 4, 0, 0, 0, 0, time.UTC)
+	h.On("Backfill", mock.Anything, tclient.ScheduleBackfillOptions{
+		Backfill: []tclient.ScheduleBackfill{{Start: from, End: to, Overlap: enumspb.SCHEDULE_OVERLAP_POLICY_BUFFER_ALL}},
+	}).Return(nil).Once()
+	if err := c.Backfill(context.Background(), "com-daily", from, to, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Backfill(context.Background(), "com-daily", to, from, ""); err == nil {
+		t.Fatal("want error for reversed range")
+	}
+
+	pl, _ := converter.GetDefaultDataConverter().ToPayload(dailyCom().Params)
+	h.On("Describe", mock.Anything).Return(&tclient.ScheduleDescription{
+		Schedule: tclient.Schedule{
+			Action: &tclient.ScheduleWorkflowAction{Args: []any{(*commonpb.Payload)(pl)}},
+			Spec:   &tclient.ScheduleSpec{CronExpressions: []string{"0 6 * * *"}},
+			State:  &tclient.ScheduleState{Paused: true},
+		},
+		Info: tclient.ScheduleInfo{
+			RunningWorkflows: []tclient.ScheduleWorkflowExecution{{WorkflowID: "com-daily-2024-05-03T06:00:00Z", FirstExecutionRunID: "r1"}},
+			RecentActions:    []tclient.ScheduleActionResult{{ScheduleTime: from}},
+		},
+	}, nil)
+	s, err := c.DescribeSchedule(context.Background(), "com-daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !s.Paused || s.Params.ZoneURI != dailyCom().Params.ZoneURI || len(s.Running) != 1 || s.Running[0].RunID != "r1" || !s.Recent[0].Equal(from) {
+		t.Fatalf("schedule %+v", s)
+	}
+	h.AssertExpectations(t)
+}
@@ -0,0 +1,54 @@
+// Package diskspace reports free space on the file system holding a path.
+package diskspace
+
+import (
+	"fmt"
+	"io/fs"
+)
+
+// Usage describes the file system holding a path.
+type Usage struct {
+	Total uint64 // size in bytes
+	Free  uint64 // bytes available to unprivileged users
+}
+
+// ShortError is returned by Check when there is less free space than wanted.
+type ShortError struct {
+	Path       string
+	Free, Want uint64
+}
+
+func (e *ShortError) Error() string {
+	return fmt.Sprintf("%s: %s free, want at least %s", e.Path, Bytes(e.Free), Bytes(e.Want))
+}
+
+// Check returns a *ShortError if the file system holding path has less than
+// min bytes free.
+func Check(path string, min uint64) error {
+	u, err := Stat(path)
+	if err != nil {
+		return err
+	}
+	if u.Free < min {
+		return &ShortError{Path: path, Free: u.Free, Want: min}
+	}
+	return nil
+}
+
+// Bytes formats n in binary units ("1.5 GiB").
+func Bytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func newPathError(path string, err error) error {
+	return &fs.PathError{Op: "statfs", Path: path, Err: err}
+}
@@ -0,0 +1,40 @@
+package diskspace
+
+import (
+	"errors"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStat(t *testing.T) {
+	dir := t.TempDir()
+	u, err := Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Free == 0 || u.Total < u.Free {
+		t.Fatalf("usage %+v", u)
+	}
+	if err := Check(dir, 1); err != nil {
+		t.Fatal(err)
+	}
+	err = Check(dir, math.MaxUint64)
+	var short *ShortError
+	if !errors.As(err, &short) || short.Want != math.MaxUint64 || !strings.Contains(err.Error(), "want at least 16.0 EiB") {
+		t.Fatalf("got %v", err)
+	}
+	if _, err := Stat(filepath.Join(dir, "missing")); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("missing dir: %v", err)
+	}
+}
+
+func TestBytes(t *testing.T) {
+	for n, want := range map[uint64]string{0: "0 B", 1023: "1023 B", 1024: "1.0 KiB", 3 << 29: "1.5 GiB"} {
+		if got := Bytes(n); got != want {
+			t.Errorf("Bytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build linux || darwin
+
+package diskspace
+
+import "syscall"
+
+// Stat returns the size and free space of the file system holding path.
+func Stat(path string) (Usage, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return Usage{}, newPathError(path, err)
+	}
+	bs := uint64(st.Bsize)
+	return Usage{Total: st.Blocks * bs, Free: st.Bavail * bs}, nil
+}
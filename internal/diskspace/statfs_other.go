@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package diskspace
+
+import "errors"
+
+// Stat is not implemented on this platform.
+func Stat(path string) (Usage, error) {
+	return Usage{}, newPathError(path, errors.ErrUnsupported)
+}
@@ -0,0 +1,121 @@
+// Package health serves the worker's operational endpoints on their own mux:
+//
+//	/metrics        Prometheus metrics (pipeline and Temporal SDK)
+//	/healthz        the process is up (liveness)
+//	/readyz         every readiness check passes and the worker isn't stopping
+//	/debug/pprof/   Go profiles, when enabled
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.temporal.io/sdk/client"
+
+	"github.com/yourorg/zone-names/internal/diskspace"
+)
+
+// Check is one readiness condition; Run returns why it fails, or nil.
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+type Options struct {
+	// Ready lists the readiness checks, run in order on every /readyz.
+	Ready []Check
+	// Timeout bounds each readiness check. Defaults to 5s.
+	Timeout time.Duration
+	// Pprof serves net/http/pprof under /debug/pprof/.
+	Pprof bool
+}
+
+// Handler serves the endpoints. Call Drain when the worker starts shutting
+// down so load balancers and Kubernetes stop counting on it.
+type Handler struct {
+	mux      *http.ServeMux
+	opts     Options
+	draining atomic.Bool
+}
+
+func New(opts Options) *Handler {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	h := &Handler{mux: http.NewServeMux(), opts: opts}
+	h.mux.Handle("GET /metrics", promhttp.Handler())
+	h.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, _ *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	h.mux.HandleFunc("GET /readyz", h.readyz)
+	if opts.Pprof {
+		h.mux.HandleFunc("/debug/pprof/", pprof.Index)
+		h.mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		h.mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		h.mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		h.mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { h.mux.ServeHTTP(w, r) }
+
+// Drain makes /readyz fail from now on.
+func (h *Handler) Drain() { h.draining.Store(true) }
+
+// readyz runs every check, even after one fails, and lists the results one
+// per line ("temporal: ok").
+func (h *Handler) readyz(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+	ready := !h.draining.Load()
+	if !ready {
+		b.WriteString("shutting down\n")
+	}
+	for _, c := range h.opts.Ready {
+		ctx, cancel := context.WithTimeout(r.Context(), h.opts.Timeout)
+		err := c.Run(ctx)
+		cancel()
+		if err != nil {
+			ready = false
+			fmt.Fprintf(&b, "%s: %v\n", c.Name, err)
+			continue
+		}
+		fmt.Fprintf(&b, "%s: ok\n", c.Name)
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write([]byte(b.String()))
+}
+
+// Temporal checks that the frontend answers health checks.
+func Temporal(c client.Client) Check {
+	return Check{Name: "temporal", Run: func(ctx context.Context) error {
+		_, err := c.CheckHealth(ctx, &client.CheckHealthRequest{})
+		return err
+	}}
+}
+
+// Scratch checks that files can be created in dir and that its file system
+// has at least minFree bytes free.
+func Scratch(dir string, minFree uint64) Check {
+	return Check{Name: "scratch", Run: func(context.Context) error {
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		_ = f.Close()
+		if err := os.Remove(f.Name()); err != nil {
+			return err
+		}
+		return diskspace.Check(dir, minFree)
+	}}
+}
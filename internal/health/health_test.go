@@ -0,0 +1,70 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func get(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestEndpoints(t *testing.T) {
+	h := New(Options{})
+	if code, body := get(t, h, "/healthz"); code != http.StatusOK || body != "ok\n" {
+		t.Fatalf("/healthz %d %q", code, body)
+	}
+	if code, body := get(t, h, "/metrics"); code != http.StatusOK || !strings.Contains(body, "go_goroutines") {
+		t.Fatalf("/metrics %d", code)
+	}
+	if code, _ := get(t, h, "/debug/pprof/"); code != http.StatusNotFound {
+		t.Fatalf("pprof served without Pprof: %d", code)
+	}
+	if code, _ := get(t, New(Options{Pprof: true}), "/debug/pprof/"); code != http.StatusOK {
+		t.Fatalf("/debug/pprof/ %d", code)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	var down error
+	h := New(Options{Ready: []Check{
+		{Name: "temporal", Run: func(context.Context) error { return down }},
+		Scratch(t.TempDir(), 0),
+	}})
+	if code, body := get(t, h, "/readyz"); code != http.StatusOK || body != "temporal: ok\nscratch: ok\n" {
+		t.Fatalf("ready: %d %q", code, body)
+	}
+
+	down = errors.New("connection refused")
+	if code, body := get(t, h, "/readyz"); code != http.StatusServiceUnavailable ||
+		body != "temporal: connection refused\nscratch: ok\n" {
+		t.Fatalf("temporal down: %d %q", code, body)
+	}
+
+	down = nil
+	h.Drain()
+	if code, body := get(t, h, "/readyz"); code != http.StatusServiceUnavailable || !strings.HasPrefix(body, "shutting down\n") {
+		t.Fatalf("draining: %d %q", code, body)
+	}
+	if code, _ := get(t, h, "/healthz"); code != http.StatusOK {
+		t.Fatalf("/healthz while draining: %d", code)
+	}
+}
+
+func TestScratch(t *testing.T) {
+	ctx := context.Background()
+	if err := Scratch(t.TempDir()+"/missing", 0).Run(ctx); err == nil {
+		t.Fatal("missing dir reported ready")
+	}
+	if err := Scratch(t.TempDir(), math.MaxUint64).Run(ctx); err == nil || !strings.Contains(err.Error(), "free") {
+		t.Fatalf("want free-space error, got %v", err)
+	}
+}
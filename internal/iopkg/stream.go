@@ -3,22 +3,58 @@ package iopkg
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/tracing"
 )
 
+// ErrUnsupportedScheme is wrapped by the errors for URIs that are neither
+// file:// nor s3://.
+var ErrUnsupportedScheme = errors.New("unsupported scheme")
+
+// ErrInvalidJSON is wrapped by ReadJSON's errors for content that doesn't
+// decode, as opposed to a URI that can't be opened.
+var ErrInvalidJSON = errors.New("invalid JSON")
+
+func unsupportedScheme(scheme string) error {
+	return fmt.Errorf("%w: %s", ErrUnsupportedScheme, scheme)
+}
+
 // s3iface is the minimal subset of s3 client methods we use; allows test fakes.
 type s3iface interface {
 	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
 	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// ObjectInfo is what we know about an object without reading it.
+type ObjectInfo struct {
+	Size    int64
+	ETag    string // S3 only; unquoted
+	ModTime time.Time
 }
 
 // newS3Client constructs an s3 client; overridden in tests.
@@ -37,54 +73,170 @@ var newS3Client = func(ctx context.Context) (s3iface, error) {
 }
 
 // Open returns a ReadCloser and (if known) size for file:// or s3:// URIs.
-func Open(uri string) (io.ReadCloser, int64, error) {
+// For S3, ctx governs the whole download and carries the parent of its span.
+func Open(ctx context.Context, uri string) (io.ReadCloser, int64, error) {
+	rc, info, err := OpenObject(ctx, uri)
+	return rc, info.Size, err
+}
+
+// OpenObject is like Open but also returns the object's metadata.
+func OpenObject(ctx context.Context, uri string) (io.ReadCloser, ObjectInfo, error) {
 	u, err := url.Parse(uri)
 	if err != nil {
-		return nil, 0, err
+		return nil, ObjectInfo{}, err
 	}
 	switch u.Scheme {
 	case "file", "":
 		p := strings.TrimPrefix(uri, "file://")
 		f, err := os.Open(p)
 		if err != nil {
-			return nil, 0, err
+			return nil, ObjectInfo{}, err
 		}
-		st, _ := f.Stat()
-		var sz int64
-		if st != nil {
-			sz = st.Size()
+		var info ObjectInfo
+		if st, _ := f.Stat(); st != nil {
+			info = ObjectInfo{Size: st.Size(), ModTime: st.ModTime()}
 		}
-		return f, sz, nil
+		return f, info, nil
 	case "s3":
-		ctx := context.Background()
 		cl, err := newS3Client(ctx)
 		if err != nil {
-			return nil, 0, err
+			return nil, ObjectInfo{}, err
 		}
 		bkt := u.Host
 		key := strings.TrimPrefix(u.Path, "/")
+		// The span lasts until the body is closed, so it covers the download.
+		ctx, span := tracing.Start(ctx, "s3.GetObject", s3Attrs(bkt, key)...)
 		// Use GetObject streaming
+		started := time.Now()
 		resp, err := cl.GetObject(ctx, &s3.GetObjectInput{
 			Bucket: aws.String(bkt), Key: aws.String(key),
 		})
+		znmetrics.ObserveS3("GetObject", started, s3Code(err))
+		if err != nil {
+			tracing.End(span, err)
+			return nil, ObjectInfo{}, err
+		}
+		info := ObjectInfo{ETag: strings.Trim(aws.ToString(resp.ETag), `"`)}
+		if resp.ContentLength != nil {
+			info.Size = *resp.ContentLength
+		}
+		if resp.LastModified != nil {
+			info.ModTime = *resp.LastModified
+		}
+		return &tracedBody{ReadCloser: resp.Body, span: span}, info, nil
+	default:
+		return nil, ObjectInfo{}, unsupportedScheme(u.Scheme)
+	}
+}
+
+// Stat returns metadata for a file:// or s3:// URI without reading it.
+// Use IsNotExist to tell a missing object from other failures.
+func Stat(ctx context.Context, uri string) (ObjectInfo, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	switch u.Scheme {
+	case "file", "":
+		st, err := os.Stat(strings.TrimPrefix(uri, "file://"))
+		if err != nil {
+			return ObjectInfo{}, err
+		}
+		return ObjectInfo{Size: st.Size(), ModTime: st.ModTime()}, nil
+	case "s3":
+		cl, err := newS3Client(ctx)
+		if err != nil {
+			return ObjectInfo{}, err
+		}
+		key := strings.TrimPrefix(u.Path, "/")
+		ctx, span := tracing.Start(ctx, "s3.HeadObject", s3Attrs(u.Host, key)...)
+		started := time.Now()
+		resp, err := cl.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket: aws.String(u.Host), Key: aws.String(key),
+		})
+		znmetrics.ObserveS3("HeadObject", started, s3Code(err))
+		tracing.End(span, err)
 		if err != nil {
-			return nil, 0, err
+			return ObjectInfo{}, err
 		}
-		var sz int64 = 0
+		info := ObjectInfo{ETag: strings.Trim(aws.ToString(resp.ETag), `"`)}
 		if resp.ContentLength != nil {
-			sz = *resp.ContentLength
+			info.Size = *resp.ContentLength
+		}
+		if resp.LastModified != nil {
+			info.ModTime = *resp.LastModified
 		}
-		return resp.Body, sz, nil
+		return info, nil
 	default:
-		return nil, 0, errors.New("unsupported scheme: " + u.Scheme)
+		return ObjectInfo{}, unsupportedScheme(u.Scheme)
+	}
+}
+
+// IsNotExist reports whether err means the file, S3 object or bucket does not exist.
+func IsNotExist(err error) bool {
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		switch ae.ErrorCode() {
+		case "NoSuchKey", "NoSuchBucket", "NotFound":
+			return true
+		}
+	}
+	return false
+}
+
+// IsPermission reports whether err means access was refused: file
+// permissions, or S3 rejecting the credentials or the request.
+func IsPermission(err error) bool {
+	if errors.Is(err, os.ErrPermission) {
+		return true
+	}
+	var ae smithy.APIError
+	if errors.As(err, &ae) {
+		switch ae.ErrorCode() {
+		// HEAD responses have no body, so a refused Stat only says "Forbidden".
+		case "AccessDenied", "AllAccessDisabled", "Forbidden", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+			return true
+		}
+	}
+	return false
+}
+
+// s3Code is the error label for an S3 request's metrics: "" on success, the
+// S3 error code, or "other" for errors without one (network, timeouts).
+func s3Code(err error) string {
+	if err == nil {
+		return ""
 	}
+	var ae smithy.APIError
+	if errors.As(err, &ae) && ae.ErrorCode() != "" {
+		return ae.ErrorCode()
+	}
+	return "other"
 }
 
-func OpenReader(uri string) (io.ReadCloser, error) {
-	rc, _, err := Open(uri)
+func OpenReader(ctx context.Context, uri string) (io.ReadCloser, error) {
+	rc, _, err := Open(ctx, uri)
 	return rc, err
 }
 
+// ReadJSON decodes the JSON document at uri into v, e.g. a manifest. Errors
+// opening uri are returned as they are (see IsNotExist); errors reading or
+// decoding it wrap ErrInvalidJSON.
+func ReadJSON(ctx context.Context, uri string, v any) error {
+	rc, err := OpenReader(ctx, uri)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	if err := json.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("%w in %s: %w", ErrInvalidJSON, uri, err)
+	}
+	return nil
+}
+
 // Create creates a local file (file scheme). For S3 use CreateWriter with s3://.
 func Create(path string) (io.Writer, io.Closer, error) {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
@@ -97,8 +249,9 @@ func Create(path string) (io.Writer, io.Closer, error) {
 	return f, f, nil
 }
 
-// CreateWriter supports file:// and s3://
-func CreateWriter(uri string) (io.Writer, io.Closer, error) {
+// CreateWriter supports file:// and s3://. S3 objects are uploaded in parts
+// as they are written and completed on Close, all under ctx.
+func CreateWriter(ctx context.Context, uri string) (io.Writer, io.Closer, error) {
 	if strings.HasPrefix(uri, "file://") || !strings.Contains(uri, "://") {
 		p := strings.TrimPrefix(uri, "file://")
 		return Create(p)
@@ -109,41 +262,236 @@ func CreateWriter(uri string) (io.Writer, io.Closer, error) {
 	}
 	switch u.Scheme {
 	case "s3":
-		// buffer in memory and upload on Close (simple & safe)
-		var buf bytes.Buffer
-		type s3closer struct {
-			io.Writer
-			done   bool
-			upload func([]byte) error
-		}
-		sc := &s3closer{
-			Writer: &buf,
-			upload: func(b []byte) error {
-				ctx := context.Background()
-				cl, err := newS3Client(ctx)
-				if err != nil {
-					return err
-				}
-				_, err = cl.PutObject(ctx, &s3.PutObjectInput{
-					Bucket: aws.String(u.Host),
-					Key:    aws.String(strings.TrimPrefix(u.Path, "/")),
-					Body:   bytes.NewReader(b),
-				})
-				return err
-			},
-		}
-		return sc, closerFunc(func() error {
-			if sc.done {
-				return nil
-			}
-			sc.done = true
-			return sc.upload(buf.Bytes())
-		}), nil
+		sw := &s3Writer{ctx: ctx, bucket: u.Host, key: strings.TrimPrefix(u.Path, "/")}
+		return sw, sw, nil
 	default:
-		return nil, nil, errors.New("unsupported scheme for CreateWriter: " + u.Scheme)
+		return nil, nil, fmt.Errorf("CreateWriter: %w", unsupportedScheme(u.Scheme))
 	}
 }
 
-type closerFunc func() error
+// s3PartSize is the part size of multipart uploads; a var for tests. S3
+// requires at least 5 MiB for every part but the last.
+var s3PartSize = 16 << 20
+
+// s3Writer streams an object to S3. Every s3PartSize bytes written go up as
+// one part of a multipart upload, so memory use stays at one part however
+// large the object; an object smaller than that is sent with a single
+// PutObject on Close. A failed upload is aborted.
+type s3Writer struct {
+	ctx         context.Context
+	bucket, key string
+	cl          s3iface
+	buf         bytes.Buffer
+	uploadID    string
+	parts       []s3types.CompletedPart
+	done        bool
+	err         error // first upload error; later writes fail with it
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errors.New("write after close")
+	}
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, _ := w.buf.Write(p)
+	for w.buf.Len() >= s3PartSize {
+		if w.err = w.uploadPart(w.buf.Next(s3PartSize)); w.err != nil {
+			return n, w.err
+		}
+	}
+	return n, nil
+}
 
-func (f closerFunc) Close() error { return f() }
+// Close uploads what is left and completes the object. For s3:// the upload
+// happens here, so its error must not be dropped.
+func (w *s3Writer) Close() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	err := w.err
+	switch {
+	case err != nil:
+	case w.uploadID == "":
+		return w.put(w.buf.Bytes())
+	case w.buf.Len() > 0:
+		err = w.uploadPart(w.buf.Bytes())
+	}
+	if err == nil {
+		err = w.complete()
+	}
+	if err != nil {
+		_ = w.abortUpload()
+	}
+	return err
+}
+
+// abort drops the buffered data and any multipart upload in progress.
+func (w *s3Writer) abort() error {
+	w.done = true
+	w.buf = bytes.Buffer{}
+	return w.abortUpload()
+}
+
+func (w *s3Writer) client() (s3iface, error) {
+	if w.cl == nil {
+		cl, err := newS3Client(w.ctx)
+		if err != nil {
+			return nil, err
+		}
+		w.cl = cl
+	}
+	return w.cl, nil
+}
+
+// call runs one S3 request under a span and records its metrics.
+func (w *s3Writer) call(op string, attrs []attribute.KeyValue, f func(context.Context, s3iface) error) error {
+	cl, err := w.client()
+	if err != nil {
+		return err
+	}
+	ctx, span := tracing.Start(w.ctx, "s3."+op, append(s3Attrs(w.bucket, w.key), attrs...)...)
+	started := time.Now()
+	err = f(ctx, cl)
+	znmetrics.ObserveS3(op, started, s3Code(err))
+	tracing.End(span, err)
+	return err
+}
+
+func (w *s3Writer) put(b []byte) error {
+	return w.call("PutObject", []attribute.KeyValue{attribute.Int("s3.bytes", len(b))}, func(ctx context.Context, cl s3iface) error {
+		_, err := cl.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String(w.bucket), Key: aws.String(w.key), Body: bytes.NewReader(b)})
+		return err
+	})
+}
+
+func (w *s3Writer) uploadPart(b []byte) error {
+	if w.uploadID == "" {
+		err := w.call("CreateMultipartUpload", nil, func(ctx context.Context, cl s3iface) error {
+			out, err := cl.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String(w.bucket), Key: aws.String(w.key)})
+			if err == nil {
+				w.uploadID = aws.ToString(out.UploadId)
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	num := aws.Int32(int32(len(w.parts) + 1))
+	return w.call("UploadPart", []attribute.KeyValue{attribute.Int("s3.part", int(*num)), attribute.Int("s3.bytes", len(b))}, func(ctx context.Context, cl s3iface) error {
+		out, err := cl.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(w.bucket),
+			Key:        aws.String(w.key),
+			UploadId:   aws.String(w.uploadID),
+			PartNumber: num,
+			Body:       bytes.NewReader(b),
+		})
+		if err == nil {
+			w.parts = append(w.parts, s3types.CompletedPart{ETag: out.ETag, PartNumber: num})
+		}
+		return err
+	})
+}
+
+func (w *s3Writer) complete() error {
+	return w.call("CompleteMultipartUpload", []attribute.KeyValue{attribute.Int("s3.parts", len(w.parts))}, func(ctx context.Context, cl s3iface) error {
+		_, err := cl.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(w.bucket),
+			Key:             aws.String(w.key),
+			UploadId:        aws.String(w.uploadID),
+			MultipartUpload: &s3types.CompletedMultipartUpload{Parts: w.parts},
+		})
+		return err
+	})
+}
+
+// abortUpload discards the parts of an unfinished multipart upload, which S3
+// would otherwise keep (and bill) until a lifecycle rule removes them.
+func (w *s3Writer) abortUpload() error {
+	if w.uploadID == "" {
+		return nil
+	}
+	id := w.uploadID
+	w.uploadID = ""
+	return w.call("AbortMultipartUpload", nil, func(ctx context.Context, cl s3iface) error {
+		_, err := cl.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: aws.String(w.bucket), Key: aws.String(w.key), UploadId: aws.String(id)})
+		return err
+	})
+}
+
+// Abort releases a writer from CreateWriter without storing the object: an
+// S3 object is never uploaded, and a local file is closed and removed.
+func Abort(uri string, c io.Closer) error {
+	if sw, ok := c.(*s3Writer); ok {
+		return sw.abort()
+	}
+	err := c.Close()
+	if rerr := os.Remove(strings.TrimPrefix(uri, "file://")); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) && err == nil {
+		err = rerr
+	}
+	return err
+}
+
+// Remove deletes the file or S3 object at uri. A missing one is not an error.
+func Remove(ctx context.Context, uri string) error {
+	if strings.HasPrefix(uri, "file://") || !strings.Contains(uri, "://") {
+		err := os.Remove(strings.TrimPrefix(uri, "file://"))
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "s3" {
+		return fmt.Errorf("Remove: %w", unsupportedScheme(u.Scheme))
+	}
+	cl, err := newS3Client(ctx)
+	if err != nil {
+		return err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	ctx, span := tracing.Start(ctx, "s3.DeleteObject", s3Attrs(u.Host, key)...)
+	started := time.Now()
+	_, err = cl.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(u.Host), Key: aws.String(key)})
+	znmetrics.ObserveS3("DeleteObject", started, s3Code(err))
+	tracing.End(span, err)
+	return err
+}
+
+func s3Attrs(bucket, key string) []attribute.KeyValue {
+	return []attribute.KeyValue{attribute.String("s3.bucket", bucket), attribute.String("s3.key", key)}
+}
+
+// tracedBody ends a GetObject span when the body is closed, recording how
+// many bytes were read and the first read error.
+type tracedBody struct {
+	io.ReadCloser
+	span trace.Span
+	n    int64
+	err  error
+}
+
+func (b *tracedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n += int64(n)
+	if err != nil && err != io.EOF && b.err == nil {
+		b.err = err
+	}
+	return n, err
+}
+
+func (b *tracedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.span != nil {
+		b.span.SetAttributes(attribute.Int64("s3.bytes", b.n))
+		tracing.End(b.span, b.err)
+		b.span = nil
+	}
+	return err
+}
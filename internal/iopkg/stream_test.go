@@ -3,22 +3,39 @@ package iopkg
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/s3test"
+	"github.com/yourorg/zone-names/internal/tracing"
 )
 
 type fakeS3 struct {
 	getBody       []byte
 	getErr        error
+	etag          string
+	headErr       error
 	putLastBucket string
 	putLastKey    string
 	putLastBody   []byte
 	putErr        error
+	deleted       []string
 }
 
 func (f *fakeS3) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
@@ -27,7 +44,14 @@ func (f *fakeS3) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func
 	}
 	rc := io.NopCloser(bytes.NewReader(f.getBody))
 	cl := int64(len(f.getBody))
-	return &s3.GetObjectOutput{Body: rc, ContentLength: &cl}, nil
+	return &s3.GetObjectOutput{Body: rc, ContentLength: &cl, ETag: aws.String(`"` + f.etag + `"`)}, nil
+}
+func (f *fakeS3) HeadObject(ctx context.Context, in *s3.HeadObjectInput, _ ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if f.headErr != nil {
+		return nil, f.headErr
+	}
+	cl := int64(len(f.getBody))
+	return &s3.HeadObjectOutput{ContentLength: &cl, ETag: aws.String(`"` + f.etag + `"`)}, nil
 }
 func (f *fakeS3) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
 	if f.putErr != nil {
@@ -42,6 +66,26 @@ func (f *fakeS3) PutObject(ctx context.Context, in *s3.PutObjectInput, _ ...func
 	return &s3.PutObjectOutput{}, nil
 }
 
+func (f *fakeS3) DeleteObject(ctx context.Context, in *s3.DeleteObjectInput, _ ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	f.deleted = append(f.deleted, aws.ToString(in.Bucket)+"/"+aws.ToString(in.Key))
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// The fake doesn't support multipart uploads; tests that need them use
+// s3test.
+func (f *fakeS3) CreateMultipartUpload(ctx context.Context, in *s3.CreateMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	return nil, errors.New("multipart upload not supported by fake")
+}
+func (f *fakeS3) UploadPart(ctx context.Context, in *s3.UploadPartInput, _ ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	return nil, errors.New("multipart upload not supported by fake")
+}
+func (f *fakeS3) CompleteMultipartUpload(ctx context.Context, in *s3.CompleteMultipartUploadInput, _ ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	return nil, errors.New("multipart upload not supported by fake")
+}
+func (f *fakeS3) AbortMultipartUpload(ctx context.Context, in *s3.AbortMultipartUploadInput, _ ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	return nil, errors.New("multipart upload not supported by fake")
+}
+
 func withFakeS3(t *testing.T, f *fakeS3) func() {
 	old := newS3Client
 	newS3Client = func(ctx context.Context) (s3iface, error) { return f, nil }
@@ -55,7 +99,7 @@ func TestOpenFile(t *testing.T) {
 	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
 		t.Fatal(err)
 	}
-	rc, sz, err := Open("file://" + p)
+	rc, sz, err := Open(context.Background(), "file://"+p)
 	if err != nil {
 		t.Fatalf("Open err: %v", err)
 	}
@@ -72,7 +116,7 @@ func TestOpenFile(t *testing.T) {
 func TestCreateWriterFile(t *testing.T) {
 	dir := t.TempDir()
 	p := filepath.Join(dir, "out.txt")
-	w, c, err := CreateWriter("file://" + p)
+	w, c, err := CreateWriter(context.Background(), "file://"+p)
 	if err != nil {
 		t.Fatalf("CreateWriter err: %v", err)
 	}
@@ -89,7 +133,7 @@ func TestCreateWriterFile(t *testing.T) {
 func TestOpenS3Mock(t *testing.T) {
 	f := &fakeS3{getBody: []byte("data-from-s3")}
 	defer withFakeS3(t, f)()
-	rc, sz, err := Open("s3://bucket/key/path.txt")
+	rc, sz, err := Open(context.Background(), "s3://bucket/key/path.txt")
 	if err != nil {
 		t.Fatalf("Open s3 err: %v", err)
 	}
@@ -103,10 +147,44 @@ func TestOpenS3Mock(t *testing.T) {
 	}
 }
 
+func TestS3Spans(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Install(sdktrace.NewSimpleSpanProcessor(exp), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+	f := &fakeS3{getBody: []byte("data-from-s3")}
+	defer withFakeS3(t, f)()
+
+	ctx := context.Background()
+	rc, err := OpenReader(ctx, "s3://bucket/key/path.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.ReadAll(rc)
+	if n := len(exp.GetSpans()); n != 0 {
+		t.Fatalf("GetObject span ended before the body was closed (%d spans)", n)
+	}
+	_ = rc.Close()
+	w, c, _ := CreateWriter(ctx, "s3://bucket/out.txt")
+	_, _ = w.Write([]byte("hello"))
+	_ = c.Close()
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "s3.GetObject" || spans[1].Name != "s3.PutObject" {
+		t.Fatalf("spans %+v", spans.Snapshots())
+	}
+	if !slices.Contains(spans[0].Attributes, attribute.Int64("s3.bytes", 12)) ||
+		!slices.Contains(spans[1].Attributes, attribute.String("s3.key", "out.txt")) {
+		t.Fatalf("attributes %v / %v", spans[0].Attributes, spans[1].Attributes)
+	}
+}
+
 func TestCreateWriterS3Mock(t *testing.T) {
 	f := &fakeS3{}
 	defer withFakeS3(t, f)()
-	w, c, err := CreateWriter("s3://mybucket/dir/name.txt")
+	w, c, err := CreateWriter(context.Background(), "s3://mybucket/dir/name.txt")
 	if err != nil {
 		t.Fatalf("CreateWriter s3 err: %v", err)
 	}
@@ -124,3 +202,219 @@ func TestCreateWriterS3Mock(t *testing.T) {
 		t.Fatalf("body %q", string(f.putLastBody))
 	}
 }
+
+func TestAbort(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "out.txt")
+	_, c, err := CreateWriter(context.Background(), "file://"+p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Abort("file://"+p, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(p); !os.IsNotExist(err) {
+		t.Fatalf("aborted file still there: %v", err)
+	}
+
+	f := &fakeS3{}
+	defer withFakeS3(t, f)()
+	w, c, err := CreateWriter(context.Background(), "s3://mybucket/name.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("partial"))
+	if err := Abort("s3://mybucket/name.txt", c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil || f.putLastKey != "" {
+		t.Fatalf("aborted object uploaded to %q: %v", f.putLastKey, err)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "out.txt")
+	_ = os.WriteFile(p, []byte("x"), 0o644)
+	if err := Remove(context.Background(), "file://"+p); err != nil {
+		t.Fatal(err)
+	}
+	if err := Remove(context.Background(), "file://"+p); err != nil {
+		t.Fatalf("missing file: %v", err)
+	}
+	f := &fakeS3{}
+	defer withFakeS3(t, f)()
+	if err := Remove(context.Background(), "s3://mybucket/dir/part-00000.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(f.deleted, []string{"mybucket/dir/part-00000.txt"}) {
+		t.Fatalf("deleted %q", f.deleted)
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	dir := t.TempDir()
+	_ = os.WriteFile(filepath.Join(dir, "ok.json"), []byte(`{"unique": 2}`), 0o644)
+	_ = os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`{"unique": `), 0o644)
+	var v struct{ Unique int }
+	if err := ReadJSON(context.Background(), "file://"+filepath.Join(dir, "ok.json"), &v); err != nil || v.Unique != 2 {
+		t.Fatalf("ok: %+v, %v", v, err)
+	}
+	if err := ReadJSON(context.Background(), "file://"+filepath.Join(dir, "bad.json"), &v); !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("bad: %v", err)
+	}
+	if err := ReadJSON(context.Background(), "file://"+filepath.Join(dir, "missing.json"), &v); !IsNotExist(err) || errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("missing: %v", err)
+	}
+}
+
+func TestStatS3Mock(t *testing.T) {
+	f := &fakeS3{getBody: []byte("abc"), etag: "d41d8cd9"}
+	defer withFakeS3(t, f)()
+	info, err := Stat(context.Background(), "s3://bucket/key")
+	if err != nil {
+		t.Fatalf("Stat err: %v", err)
+	}
+	if info.Size != 3 || info.ETag != "d41d8cd9" {
+		t.Fatalf("info %+v", info)
+	}
+}
+
+func TestIsNotExist(t *testing.T) {
+	_, err := Stat(context.Background(), "file://"+filepath.Join(t.TempDir(), "missing"))
+	if !IsNotExist(err) {
+		t.Fatalf("file: want not-exist, got %v", err)
+	}
+	f := &fakeS3{headErr: &s3types.NotFound{}}
+	defer withFakeS3(t, f)()
+	_, err = Stat(context.Background(), "s3://bucket/missing")
+	if !IsNotExist(err) {
+		t.Fatalf("s3: want not-exist, got %v", err)
+	}
+	if IsNotExist(io.ErrUnexpectedEOF) {
+		t.Fatal("unrelated error reported as not-exist")
+	}
+}
+
+func TestIsPermission(t *testing.T) {
+	f := &fakeS3{headErr: &smithy.GenericAPIError{Code: "Forbidden"}}
+	defer withFakeS3(t, f)()
+	if _, err := Stat(context.Background(), "s3://bucket/secret"); !IsPermission(err) || IsNotExist(err) {
+		t.Fatalf("s3: want permission error, got %v", err)
+	}
+	if !IsPermission(&fs.PathError{Op: "open", Path: "/x", Err: fs.ErrPermission}) {
+		t.Fatal("file: want permission error")
+	}
+	if IsPermission(io.ErrUnexpectedEOF) {
+		t.Fatal("unrelated error reported as permission error")
+	}
+}
+
+func TestS3Metrics(t *testing.T) {
+	forbidden := testutil.ToFloat64(znmetrics.S3RequestErrors.WithLabelValues("HeadObject", "Forbidden"))
+	f := &fakeS3{headErr: &smithy.GenericAPIError{Code: "Forbidden"}}
+	defer withFakeS3(t, f)()
+	_, _ = Stat(context.Background(), "s3://bucket/secret")
+	if got := testutil.ToFloat64(znmetrics.S3RequestErrors.WithLabelValues("HeadObject", "Forbidden")); got != forbidden+1 {
+		t.Fatalf("HeadObject Forbidden errors %v, want %v", got, forbidden+1)
+	}
+	if s3Code(io.ErrUnexpectedEOF) != "other" || s3Code(nil) != "" {
+		t.Fatal("s3Code")
+	}
+}
+
+func TestUnsupportedScheme(t *testing.T) {
+	for _, err := range []error{
+		func() error { _, err := Stat(context.Background(), "gs://b/k"); return err }(),
+		func() error { _, err := OpenReader(context.Background(), "gs://b/k"); return err }(),
+		func() error { _, _, err := CreateWriter(context.Background(), "gs://b/k"); return err }(),
+	} {
+		if !errors.Is(err, ErrUnsupportedScheme) || !strings.Contains(err.Error(), "gs") {
+			t.Errorf("got %v, want ErrUnsupportedScheme", err)
+		}
+	}
+}
+
+// TestS3Server goes through the real SDK client against the in-process server.
+func TestS3Server(t *testing.T) {
+	srv := s3test.NewServer(t)
+	srv.SetEnv(t)
+	if err := srv.CreateBucket("b"); err != nil {
+		t.Fatal(err)
+	}
+	w, c, err := CreateWriter(context.Background(), "s3://b/dir/obj.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(w, "hello\n")
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rc, info, err := OpenObject(context.Background(), "s3://b/dir/obj.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(b) != "hello\n" || info.Size != 6 || info.ETag == "" {
+		t.Fatalf("read %q info %+v", b, info)
+	}
+	st, err := Stat(context.Background(), "s3://b/dir/obj.txt")
+	if err != nil || st != (ObjectInfo{Size: 6, ETag: info.ETag, ModTime: st.ModTime}) {
+		t.Fatalf("stat %+v %v", st, err)
+	}
+	if _, err := Stat(context.Background(), "s3://b/missing"); !IsNotExist(err) {
+		t.Fatalf("stat missing: %v", err)
+	}
+	if _, err := OpenReader(context.Background(), "s3://b/missing"); !IsNotExist(err) {
+		t.Fatalf("open missing: %v", err)
+	}
+}
+
+// TestS3ServerMultipart checks that large objects are streamed up in parts,
+// and that an aborted writer leaves no object behind.
+func TestS3ServerMultipart(t *testing.T) {
+	srv := s3test.NewServer(t)
+	srv.SetEnv(t)
+	if err := srv.CreateBucket("b"); err != nil {
+		t.Fatal(err)
+	}
+	old := s3PartSize
+	s3PartSize = 8
+	defer func() { s3PartSize = old }()
+
+	w, c, err := CreateWriter(context.Background(), "s3://b/big.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Repeat("0123456", 3) // 21 bytes: parts of 8, 8 and 5
+	for i := 0; i < len(want); i += 3 {
+		if _, err := io.WriteString(w, want[i:i+3]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := srv.Object("b", "big.txt")
+	if err != nil || string(b) != want {
+		t.Fatalf("object %q: %v", b, err)
+	}
+	if st, err := Stat(context.Background(), "s3://b/big.txt"); err != nil || !strings.HasSuffix(st.ETag, "-3") {
+		t.Fatalf("stat %+v %v, want a 3-part ETag", st, err)
+	}
+
+	w, c, err = CreateWriter(context.Background(), "s3://b/aborted.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = io.WriteString(w, want) // two parts uploaded
+	if err := Abort("s3://b/aborted.txt", c); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Stat(context.Background(), "s3://b/aborted.txt"); !IsNotExist(err) {
+		t.Fatalf("aborted object: %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+// Package janitor removes scratch directories that their workflows left
+// behind. CleanupScratch never runs when a worker crashes mid-run or a
+// workflow is terminated, so without it ZN_TMP_DIR/<workflow-id>/ directories
+// accumulate forever.
+package janitor
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/log"
+
+	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// Janitor sweeps the subdirectories of a scratch root. A directory holding a
+// types.ScratchOwnerFile is one run's scratch and belongs to the workflow
+// named in it. A top-level directory holding files but no owner file is taken
+// to belong to the workflow of its name (the default ScratchSubdir, from
+// before owner files). Any other directory only groups nested ScratchSubdirs
+// ("com/{{.Date}}"); the janitor descends into it and never removes it whole.
+type Janitor struct {
+	Client client.Client
+	Dir    string // scratch root
+	// TTL is how long a directory is kept after its workflow closed. If the
+	// server doesn't know the workflow (a top-level custom ScratchSubdir from
+	// before owner files, or a run past the namespace's retention), it counts
+	// from the directory's last modification.
+	TTL    time.Duration
+	Logger log.Logger
+}
+
+// Result sums up one sweep.
+type Result struct {
+	Removed int   // directories removed
+	Bytes   int64 // size of the files in them
+}
+
+// Run sweeps now and then every interval until ctx is done.
+func (j *Janitor) Run(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if _, err := j.Sweep(ctx); err != nil && ctx.Err() == nil {
+			j.Logger.Warn("scratch sweep failed", "dir", j.Dir, "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Sweep removes the directories of workflows that closed more than TTL ago.
+// Directories of running workflows, and any it can't get a status for, are
+// left alone.
+func (j *Janitor) Sweep(ctx context.Context) (Result, error) {
+	var res Result
+	err := j.sweep(ctx, j.Dir, true, &res)
+	return res, err
+}
+
+// sweep goes through the subdirectories of dir; top is set for the scratch
+// root itself.
+func (j *Janitor) sweep(ctx context.Context, dir string, top bool, res *Result) error {
+	ents, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range ents {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !e.IsDir() {
+			continue
+		}
+		sub := filepath.Join(dir, e.Name())
+		id, ok := owner(sub)
+		if !ok && top && hasFiles(sub) {
+			id, ok = e.Name(), true
+		}
+		if !ok {
+			if err := j.sweep(ctx, sub, false, res); err != nil && ctx.Err() == nil {
+				j.Logger.Warn("scratch sweep failed", "dir", sub, "error", err)
+			}
+			continue
+		}
+		j.collect(ctx, sub, id, e, res)
+	}
+	return ctx.Err()
+}
+
+// collect removes dir, the scratch of workflow id, if the workflow closed
+// more than TTL ago.
+func (j *Janitor) collect(ctx context.Context, dir, id string, e fs.DirEntry, res *Result) {
+	fi, err := e.Info()
+	if err != nil {
+		return
+	}
+	closed, err := j.closedAt(ctx, id, fi.ModTime())
+	if err != nil {
+		j.Logger.Warn("scratch sweep: workflow status unknown", "dir", dir, "workflowID", id, "error", err)
+		return
+	}
+	if closed.IsZero() || time.Since(closed) < j.TTL {
+		return
+	}
+	n := size(dir)
+	if err := os.RemoveAll(dir); err != nil {
+		j.Logger.Warn("scratch sweep: remove failed", "dir", dir, "error", err)
+		return
+	}
+	res.Removed++
+	res.Bytes += n
+	znmetrics.ScratchDirsRemoved.Inc()
+	znmetrics.ScratchReclaimedBytes.Add(float64(n))
+	j.Logger.Info("removed orphaned scratch directory", "dir", dir, "workflowID", id, "bytes", n)
+}
+
+// closedAt returns when workflow id closed, zero if it is still running, or
+// modTime if the server doesn't know it.
+func (j *Janitor) closedAt(ctx context.Context, id string, modTime time.Time) (time.Time, error) {
+	resp, err := j.Client.DescribeWorkflowExecution(ctx, id, "")
+	var nf *serviceerror.NotFound
+	if errors.As(err, &nf) {
+		return modTime, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	info := resp.GetWorkflowExecutionInfo()
+	if info.GetStatus() == enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING {
+		return time.Time{}, nil
+	}
+	if ct := info.GetCloseTime(); ct != nil {
+		return ct.AsTime(), nil
+	}
+	return modTime, nil
+}
+
+// owner reads the workflow ID from dir's owner file.
+func owner(dir string) (string, bool) {
+	b, err := os.ReadFile(filepath.Join(dir, types.ScratchOwnerFile))
+	id := strings.TrimSpace(string(b))
+	return id, err == nil && id != ""
+}
+
+// hasFiles reports whether dir directly holds anything but directories.
+func hasFiles(dir string) bool {
+	ents, _ := os.ReadDir(dir)
+	for _, e := range ents {
+		if !e.IsDir() {
+			return true
+		}
+	}
+	return false
+}
+
+// size adds up the sizes of the regular files under dir.
+func size(dir string) int64 {
+	var n int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if fi, err := d.Info(); err == nil {
+			n += fi.Size()
+		}
+		return nil
+	})
+	return n
+}
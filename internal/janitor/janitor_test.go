@@ -0,0 +1,129 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/mock"
+	enumspb "go.temporal.io/api/enums/v1"
+	"go.temporal.io/api/serviceerror"
+	workflowpb "go.temporal.io/api/workflow/v1"
+	"go.temporal.io/api/workflowservice/v1"
+	"go.temporal.io/sdk/mocks"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/yourorg/zone-names/internal/logging"
+	znmetrics "github.com/yourorg/zone-names/internal/metrics"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+func describe(tc *mocks.Client, id string, status enumspb.WorkflowExecutionStatus, closed time.Time) {
+	info := &workflowpb.WorkflowExecutionInfo{Status: status}
+	if !closed.IsZero() {
+		info.CloseTime = timestamppb.New(closed)
+	}
+	tc.On("DescribeWorkflowExecution", mock.Anything, id, "").
+		Return(&workflowservice.DescribeWorkflowExecutionResponse{WorkflowExecutionInfo: info}, nil)
+}
+
+// scratch creates root/name holding a 100-byte file, last modified at mtime.
+func scratch(t *testing.T, root, name string, mtime time.Time) string {
+	t.Helper()
+	dir := filepath.Join(root, name)
+	if err := os.MkdirAll(filepath.Join(dir, "shard-00.txt.badger"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "shard-00.txt"), make([]byte, 100), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(dir, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSweep(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	tc := &mocks.Client{}
+	dirs := map[string]string{
+		"running":   scratch(t, root, "running", old),
+		"completed": scratch(t, root, "completed", old),
+		"recent":    scratch(t, root, "recent", old),
+		"unknown":   scratch(t, root, "unknown", old),
+		"fresh":     scratch(t, root, "fresh", time.Now()),
+		"custom":    scratch(t, root, "custom", old),
+		"error":     scratch(t, root, "error", old),
+	}
+	// A custom ScratchSubdir names its workflow in the owner file.
+	_ = os.WriteFile(filepath.Join(dirs["custom"], types.ScratchOwnerFile), []byte("wf-custom\n"), 0o644)
+	describe(tc, "running", enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING, time.Time{})
+	describe(tc, "completed", enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED, old)
+	describe(tc, "recent", enumspb.WORKFLOW_EXECUTION_STATUS_TERMINATED, time.Now().Add(-time.Hour))
+	describe(tc, "wf-custom", enumspb.WORKFLOW_EXECUTION_STATUS_FAILED, old)
+	tc.On("DescribeWorkflowExecution", mock.Anything, "unknown", "").Return(nil, serviceerror.NewNotFound("workflow not found"))
+	tc.On("DescribeWorkflowExecution", mock.Anything, "fresh", "").Return(nil, serviceerror.NewNotFound("workflow not found"))
+	tc.On("DescribeWorkflowExecution", mock.Anything, "error", "").Return(nil, errors.New("unavailable"))
+	// Files at the root, like /readyz probes, are not scratch directories.
+	_ = os.WriteFile(filepath.Join(root, ".readyz-1"), nil, 0o644)
+
+	before := testutil.ToFloat64(znmetrics.ScratchReclaimedBytes)
+	j := &Janitor{Client: tc, Dir: root, TTL: 24 * time.Hour, Logger: logging.NewZapAdapter(zaptest.NewLogger(t))}
+	res, err := j.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (Result{Removed: 3, Bytes: 310}) {
+		t.Fatalf("result %+v", res)
+	}
+	for name, dir := range dirs {
+		_, err := os.Stat(dir)
+		removed := os.IsNotExist(err)
+		if want := name == "completed" || name == "unknown" || name == "custom"; removed != want {
+			t.Errorf("%s: removed %v, want %v", name, removed, want)
+		}
+	}
+	if got := testutil.ToFloat64(znmetrics.ScratchReclaimedBytes); got != before+310 {
+		t.Fatalf("reclaimed bytes %v, want %v", got, before+310)
+	}
+}
+
+// TestSweepNested checks that nested ScratchSubdirs ("com/{{.Date}}") are
+// decided per run by their owner files, and that the directory grouping them
+// is never looked up or removed as a whole.
+func TestSweepNested(t *testing.T) {
+	root := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	running := scratch(t, root, "com/2024-05-02", old)
+	closed := scratch(t, root, "com/2024-05-01", old)
+	legacy := scratch(t, root, "com/2024-04-30", old) // no owner file: unknown workflow
+	_ = os.WriteFile(filepath.Join(running, types.ScratchOwnerFile), []byte("com-2024-05-02\n"), 0o644)
+	_ = os.WriteFile(filepath.Join(closed, types.ScratchOwnerFile), []byte("com-2024-05-01\n"), 0o644)
+	_ = os.Chtimes(filepath.Join(root, "com"), old, old)
+	tc := &mocks.Client{}
+	describe(tc, "com-2024-05-02", enumspb.WORKFLOW_EXECUTION_STATUS_RUNNING, time.Time{})
+	describe(tc, "com-2024-05-01", enumspb.WORKFLOW_EXECUTION_STATUS_COMPLETED, old)
+
+	j := &Janitor{Client: tc, Dir: root, TTL: 24 * time.Hour, Logger: logging.NewZapAdapter(zaptest.NewLogger(t))}
+	res, err := j.Sweep(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Removed != 1 {
+		t.Fatalf("result %+v", res)
+	}
+	for dir, want := range map[string]bool{running: false, closed: true, legacy: false} {
+		_, err := os.Stat(dir)
+		if removed := os.IsNotExist(err); removed != want {
+			t.Errorf("%s: removed %v, want %v", dir, removed, want)
+		}
+	}
+	// The mock fails the test on any lookup it wasn't told about, e.g. "com".
+	tc.AssertExpectations(t)
+}
@@ -0,0 +1,66 @@
+// Package logging adapts the worker's zap logger to the Temporal SDK.
+package logging
+
+import (
+	"fmt"
+
+	"go.temporal.io/sdk/log"
+	"go.uber.org/zap"
+)
+
+// ZapAdapter implements the Temporal SDK's log.Logger on a zap.Logger, so the
+// SDK's own logs and workflow.GetLogger / activity.GetLogger entries (which
+// carry the workflow and activity IDs) end up in the worker's JSON log.
+type ZapAdapter struct {
+	zl *zap.Logger
+}
+
+var (
+	_ log.Logger          = (*ZapAdapter)(nil)
+	_ log.WithLogger      = (*ZapAdapter)(nil)
+	_ log.WithSkipCallers = (*ZapAdapter)(nil)
+)
+
+// NewZapAdapter wraps zl. Caller information points at the code that logged,
+// not at the adapter.
+func NewZapAdapter(zl *zap.Logger) *ZapAdapter {
+	return &ZapAdapter{zl: zl.WithOptions(zap.AddCallerSkip(1))}
+}
+
+// fields turns the SDK's alternating keys and values into zap fields. A
+// dangling key is logged with a nil value rather than dropped.
+func fields(keyvals []any) []zap.Field {
+	fs := make([]zap.Field, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		key, ok := keyvals[i].(string)
+		if !ok {
+			key = fmt.Sprint(keyvals[i])
+		}
+		var v any
+		if i+1 < len(keyvals) {
+			v = keyvals[i+1]
+		}
+		if err, ok := v.(error); ok {
+			fs = append(fs, zap.NamedError(key, err))
+			continue
+		}
+		fs = append(fs, zap.Any(key, v))
+	}
+	return fs
+}
+
+func (l *ZapAdapter) Debug(msg string, keyvals ...any) { l.zl.Debug(msg, fields(keyvals)...) }
+func (l *ZapAdapter) Info(msg string, keyvals ...any)  { l.zl.Info(msg, fields(keyvals)...) }
+func (l *ZapAdapter) Warn(msg string, keyvals ...any)  { l.zl.Warn(msg, fields(keyvals)...) }
+func (l *ZapAdapter) Error(msg string, keyvals ...any) { l.zl.Error(msg, fields(keyvals)...) }
+
+// With returns a logger that adds keyvals to every entry.
+func (l *ZapAdapter) With(keyvals ...any) log.Logger {
+	return &ZapAdapter{zl: l.zl.With(fields(keyvals)...)}
+}
+
+// WithCallerSkip returns a logger that skips depth more stack frames when
+// reporting the caller.
+func (l *ZapAdapter) WithCallerSkip(depth int) log.Logger {
+	return &ZapAdapter{zl: l.zl.WithOptions(zap.AddCallerSkip(depth))}
+}
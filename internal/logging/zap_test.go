@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"errors"
+	"testing"
+
+	"go.temporal.io/sdk/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestZapAdapter(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+	var l log.Logger = NewZapAdapter(zap.New(core))
+	l = log.With(l, "WorkflowID", "wf-1")
+	l.Debug("dropped")
+	l.Info("deduped shard", "shard", "file:///s/shard-00.txt", "unique", uint64(3))
+	l.Error("failed", "error", errors.New("boom"), "dangling")
+
+	entries := logs.All()
+	if len(entries) != 2 {
+		t.Fatalf("entries %+v", entries)
+	}
+	got := entries[0].ContextMap()
+	if entries[0].Message != "deduped shard" || got["WorkflowID"] != "wf-1" || got["shard"] != "file:///s/shard-00.txt" || got["unique"] != uint64(3) {
+		t.Fatalf("info entry %+v", entries[0])
+	}
+	got = entries[1].ContextMap()
+	if entries[1].Level != zapcore.ErrorLevel || got["error"] != "boom" || got["WorkflowID"] != "wf-1" {
+		t.Fatalf("error entry %+v %v", entries[1], got)
+	}
+	if _, ok := got["dangling"]; !ok {
+		t.Fatalf("dangling key dropped: %v", got)
+	}
+}
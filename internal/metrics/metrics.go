@@ -1,45 +1,160 @@
 package metrics
 
 import (
-	"net/http"
+	"io"
 	"os"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/uber-go/tally/v4"
+	tallyprom "github.com/uber-go/tally/v4/prometheus"
+	"go.temporal.io/sdk/client"
+	sdktally "go.temporal.io/sdk/contrib/tally"
+)
+
+// Labels. zone is types.WorkflowParams.ZoneLabel: MetricsZone, a TLD-like
+// zone file name or "other", so a few hundred values at most. phase is one of the Phase* constants.
+const (
+	labelZone  = "zone"
+	labelPhase = "phase"
+)
+
+// Phases, as used in the phase label.
+const (
+	PhaseCheckUnchanged = "check_unchanged"
+	PhasePartition      = "partition"
+	PhaseSplit          = "split"
+	PhaseDedupe         = "dedupe"
+	PhaseMergeShards    = "merge_shards"
+	PhaseMerge          = "merge"
 )
 
 var (
-	RecordsPartitioned = prometheus.NewCounter(prometheus.CounterOpts{
+	RecordsPartitioned = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "zone_names",
 		Name:      "records_partitioned_total",
 		Help:      "Total DNS records seen during partitioning.",
-	})
-	DedupeInput = prometheus.NewCounter(prometheus.CounterOpts{
+	}, []string{labelZone})
+	DedupeInput = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "zone_names",
 		Name:      "dedupe_input_total",
 		Help:      "Total names processed in dedupe.",
-	})
-	DedupeUnique = prometheus.NewCounter(prometheus.CounterOpts{
+	}, []string{labelZone})
+	DedupeUnique = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "zone_names",
 		Name:      "dedupe_unique_total",
 		Help:      "Total unique names emitted by dedupe.",
-	})
-	MergedEmitted = prometheus.NewCounter(prometheus.CounterOpts{
+	}, []string{labelZone})
+	MergedEmitted = prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: "zone_names",
 		Name:      "merged_emitted_total",
 		Help:      "Total unique names emitted by merge.",
+	}, []string{labelZone})
+
+	PhaseDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zone_names",
+		Name:      "phase_duration_seconds",
+		Help:      "Duration of one activity run of a pipeline phase (one shard for split and dedupe).",
+		Buckets:   prometheus.ExponentialBuckets(0.5, 2, 16), // 0.5s to about 4.5h
+	}, []string{labelZone, labelPhase})
+	BytesRead = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zone_names",
+		Name:      "bytes_read_total",
+		Help:      "Bytes read, by phase. The partition phase counts raw (compressed) input bytes.",
+	}, []string{labelZone, labelPhase})
+	BytesWritten = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zone_names",
+		Name:      "bytes_written_total",
+		Help:      "Bytes written, by phase. The merge phase counts the stored output, parts included.",
+	}, []string{labelZone, labelPhase})
+	ParseErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zone_names",
+		Name:      "parse_errors_total",
+		Help:      "Zone files that failed to parse (each fails its partition attempt).",
+	}, []string{labelZone})
+	RecordsSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zone_names",
+		Name:      "records_skipped_total",
+		Help:      "Records dropped during partitioning because their owner name could not be converted (reason idn).",
+	}, []string{labelZone, "reason"})
+	DedupeRatio = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zone_names",
+		Name:      "dedupe_ratio",
+		Help:      "Unique names over records seen in the zone's most recent merged output.",
+	}, []string{labelZone})
+	ActiveShards = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "zone_names",
+		Name:      "active_shards",
+		Help:      "Shard dedupe activities running on this worker.",
+	}, []string{labelZone})
+	ActivityErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zone_names",
+		Name:      "activity_errors_total",
+		Help:      "Failed activity attempts, by activity and error type (retryable, canceled, or a types.ErrType* value).",
+	}, []string{"activity", "type"})
+
+	S3RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "zone_names",
+		Name:      "s3_request_duration_seconds",
+		Help:      "Latency of S3 requests (GetObject until the response headers, HeadObject, PutObject).",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 14), // 5ms to about 40s
+	}, []string{"operation"})
+	S3RequestErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "zone_names",
+		Name:      "s3_request_errors_total",
+		Help:      "Failed S3 requests, by operation and S3 error code (\"other\" for errors without one).",
+	}, []string{"operation", "code"})
+	ScratchDirsRemoved = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "zone_names",
+		Name:      "scratch_dirs_removed_total",
+		Help:      "Scratch directories of closed workflows removed by the worker's janitor.",
+	})
+	ScratchReclaimedBytes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "zone_names",
+		Name:      "scratch_reclaimed_bytes_total",
+		Help:      "Bytes freed by the worker's janitor removing orphaned scratch directories.",
 	})
 )
 
 // Init registers collectors; call once from main.
 func Init() {
-	prometheus.MustRegister(RecordsPartitioned, DedupeInput, DedupeUnique, MergedEmitted)
+	prometheus.MustRegister(RecordsPartitioned, DedupeInput, DedupeUnique, MergedEmitted,
+		PhaseDuration, BytesRead, BytesWritten, ParseErrors, RecordsSkipped, DedupeRatio, ActiveShards, ActivityErrors,
+		S3RequestDuration, S3RequestErrors, ScratchDirsRemoved, ScratchReclaimedBytes)
+}
+
+// ObservePhase records the time since started as one run of phase for zone;
+// call it as defer metrics.ObservePhase(zone, phase, time.Now()).
+func ObservePhase(zone, phase string, started time.Time) {
+	PhaseDuration.WithLabelValues(zone, phase).Observe(time.Since(started).Seconds())
 }
 
-// Serve starts a /metrics server on the given addr (e.g., ":9090"). Non-blocking when run in goroutine.
-func Serve(addr string) error {
-	http.Handle("/metrics", promhttp.Handler())
-	return http.ListenAndServe(addr, nil)
+// ObserveS3 records one S3 request of operation that started at started and
+// failed with code, or succeeded if code is "".
+func ObserveS3(operation string, started time.Time, code string) {
+	S3RequestDuration.WithLabelValues(operation).Observe(time.Since(started).Seconds())
+	if code != "" {
+		S3RequestErrors.WithLabelValues(operation, code).Inc()
+	}
+}
+
+// TemporalHandler returns a Temporal SDK metrics handler (poll counts, task
+// and activity latencies, failures; all named temporal_*) that reports to the
+// default registry, so they are served on /metrics next to the collectors
+// above. onError is called for metrics that fail to register. Close the
+// returned Closer on shutdown to flush the last report.
+func TemporalHandler(onError func(error)) (client.MetricsHandler, io.Closer) {
+	reporter := tallyprom.NewReporter(tallyprom.Options{
+		Registerer:       prometheus.DefaultRegisterer,
+		DefaultTimerType: tallyprom.HistogramTimerType,
+		OnRegisterError:  onError,
+	})
+	scope, closer := tally.NewRootScope(tally.ScopeOptions{
+		CachedReporter:  reporter,
+		Separator:       tallyprom.DefaultSeparator,
+		SanitizeOptions: &sdktally.PrometheusSanitizeOptions,
+	}, time.Second)
+	return sdktally.NewMetricsHandler(sdktally.NewPrometheusNamingScope(scope)), closer
 }
 
 // AddrFromEnv returns listen address from METRICS_ADDR or default ":9090".
@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestTemporalHandler(t *testing.T) {
+	h, closer := TemporalHandler(func(err error) { t.Errorf("register: %v", err) })
+	h.WithTags(map[string]string{"task_queue": "zone-names"}).Counter("temporal_request").Inc(2)
+	// Closing flushes the pending report to the registry.
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	mfs, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "temporal_request_total" {
+			// Label values are sanitized like names.
+			m := mf.GetMetric()[0]
+			if m.GetCounter().GetValue() != 2 || m.GetLabel()[0].GetValue() != "zone_names" {
+				t.Fatalf("temporal_request_total %v", m)
+			}
+			return
+		}
+	}
+	t.Fatal("temporal_request_total not registered")
+}
@@ -0,0 +1,501 @@
+// Package s3test runs an in-process, S3-compatible HTTP server for tests.
+//
+// It implements the path-style subset of the S3 REST API the pipeline and
+// its tests use: bucket create, object Put/Get (with Range)/Head/Delete,
+// ListObjects (v1 and v2) and multipart uploads. Objects live in a temp
+// directory; request signatures are accepted without verification.
+//
+// Point iopkg (or any AWS SDK client using the default config chain) at it
+// with Server.SetEnv.
+package s3test
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Server is a running S3 stand-in.
+type Server struct {
+	URL string // base endpoint, e.g. http://127.0.0.1:PORT
+
+	srv  *httptest.Server
+	root string
+
+	mu      sync.Mutex
+	meta    map[string]objectMeta // "bucket/key" -> metadata
+	uploads map[string]*upload    // uploadId -> in-progress multipart upload
+	nextID  int
+}
+
+type objectMeta struct {
+	etag    string // quoted
+	modTime time.Time
+}
+
+type upload struct {
+	bucket, key string
+	parts       map[int]string // part number -> file path
+}
+
+// NewServer starts a server storing objects under a temp dir and stops it
+// when the test ends. Buckets must be created with CreateBucket (or a PUT on
+// the bucket path) before use.
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	s := &Server{root: t.TempDir(), meta: map[string]objectMeta{}, uploads: map[string]*upload{}}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.srv.URL
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+// SetEnv points the default AWS config chain at the server for the rest of
+// the test: endpoint, static credentials, region and path-style addressing.
+// Shared config files are disabled so a developer profile can't interfere.
+func (s *Server) SetEnv(t testing.TB) {
+	t.Helper()
+	t.Setenv("AWS_ENDPOINT_URL_S3", s.URL)
+	t.Setenv("AWS_S3_FORCE_PATH_STYLE", "true")
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_PROFILE", "")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(s.root, ".aws-config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(s.root, ".aws-credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+}
+
+// CreateBucket creates a bucket directly.
+func (s *Server) CreateBucket(name string) error {
+	return os.MkdirAll(filepath.Join(s.root, "buckets", name), 0o755)
+}
+
+// PutObject stores an object directly, bypassing HTTP.
+func (s *Server) PutObject(bucket, key string, body []byte) error {
+	if err := s.CreateBucket(bucket); err != nil {
+		return err
+	}
+	p := s.objectPath(bucket, key)
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(p, body, 0o644); err != nil {
+		return err
+	}
+	sum := md5.Sum(body)
+	s.setMeta(bucket, key, `"`+hex.EncodeToString(sum[:])+`"`)
+	return nil
+}
+
+// Object returns an object's content directly, bypassing HTTP.
+func (s *Server) Object(bucket, key string) ([]byte, error) {
+	return os.ReadFile(s.objectPath(bucket, key))
+}
+
+func (s *Server) bucketPath(bucket string) string {
+	return filepath.Join(s.root, "buckets", bucket)
+}
+
+// objectPath maps a key to a file. Keys are stored as nested paths with a
+// suffix so "a" and "a/b" can coexist.
+func (s *Server) objectPath(bucket, key string) string {
+	return filepath.Join(s.bucketPath(bucket), filepath.FromSlash(key)+".obj")
+}
+
+func (s *Server) setMeta(bucket, key, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.meta[bucket+"/"+key] = objectMeta{etag: etag, modTime: time.Now().UTC().Truncate(time.Second)}
+}
+
+func (s *Server) getMeta(bucket, key string) (objectMeta, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.meta[bucket+"/"+key]
+	return m, ok
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	q := r.URL.Query()
+	if bucket == "" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "ListBuckets is not supported")
+		return
+	}
+	if key == "" {
+		s.serveBucket(w, r, bucket)
+		return
+	}
+	if _, err := os.Stat(s.bucketPath(bucket)); err != nil {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		s.createMultipart(w, bucket, key)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		s.uploadPart(w, r, q.Get("uploadId"), q.Get("partNumber"))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		s.completeMultipart(w, r, bucket, key, q.Get("uploadId"))
+	case r.Method == http.MethodDelete && q.Has("uploadId"):
+		s.mu.Lock()
+		delete(s.uploads, q.Get("uploadId"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut:
+		s.putObject(w, r, bucket, key)
+	case r.Method == http.MethodGet, r.Method == http.MethodHead:
+		s.getObject(w, r, bucket, key)
+	case r.Method == http.MethodDelete:
+		_ = os.Remove(s.objectPath(bucket, key))
+		s.mu.Lock()
+		delete(s.meta, bucket+"/"+key)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", r.Method+" is not supported")
+	}
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	switch r.Method {
+	case http.MethodPut:
+		if err := s.CreateBucket(bucket); err != nil {
+			writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodHead:
+		if _, err := os.Stat(s.bucketPath(bucket)); err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		s.listObjects(w, r, bucket)
+	default:
+		writeError(w, http.StatusNotImplemented, "NotImplemented", r.Method+" on bucket is not supported")
+	}
+}
+
+func (s *Server) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	if r.Header.Get("x-amz-copy-source") != "" {
+		writeError(w, http.StatusNotImplemented, "NotImplemented", "CopyObject is not supported")
+		return
+	}
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	if err := s.PutObject(bucket, key, body); err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	m, _ := s.getMeta(bucket, key)
+	w.Header().Set("ETag", m.etag)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	f, err := os.Open(s.objectPath(bucket, key))
+	if err != nil {
+		if r.Method == http.MethodHead {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writeError(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	defer f.Close()
+	m, ok := s.getMeta(bucket, key)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "InternalError", "object without metadata")
+		return
+	}
+	w.Header().Set("ETag", m.etag)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	// ServeContent handles HEAD, Range and conditional requests.
+	http.ServeContent(w, r, "", m.modTime, f)
+}
+
+type listEntry struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int64  `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type commonPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listResult struct {
+	XMLName               xml.Name       `xml:"http://s3.amazonaws.com/doc/2006-03-01/ ListBucketResult"`
+	Name                  string         `xml:"Name"`
+	Prefix                string         `xml:"Prefix"`
+	Delimiter             string         `xml:"Delimiter,omitempty"`
+	MaxKeys               int            `xml:"MaxKeys"`
+	KeyCount              int            `xml:"KeyCount,omitempty"`
+	IsTruncated           bool           `xml:"IsTruncated"`
+	ContinuationToken     string         `xml:"ContinuationToken,omitempty"`
+	NextContinuationToken string         `xml:"NextContinuationToken,omitempty"`
+	Marker                string         `xml:"Marker,omitempty"`
+	NextMarker            string         `xml:"NextMarker,omitempty"`
+	Contents              []listEntry    `xml:"Contents"`
+	CommonPrefixes        []commonPrefix `xml:"CommonPrefixes"`
+}
+
+// listObjects serves ListObjects v1 and v2. Continuation tokens are simply
+// the last key returned.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	root := s.bucketPath(bucket)
+	if _, err := os.Stat(root); err != nil {
+		writeError(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	q := r.URL.Query()
+	v2 := q.Get("list-type") == "2"
+	prefix, delim := q.Get("prefix"), q.Get("delimiter")
+	after := q.Get("marker")
+	if v2 {
+		after = q.Get("continuation-token")
+		if after == "" {
+			after = q.Get("start-after")
+		}
+	}
+	maxKeys := 1000
+	if v, err := strconv.Atoi(q.Get("max-keys")); err == nil && v >= 0 && v < maxKeys {
+		maxKeys = v
+	}
+
+	var keys []string
+	_ = filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(p, ".obj") {
+			return nil
+		}
+		rel, _ := filepath.Rel(root, strings.TrimSuffix(p, ".obj"))
+		keys = append(keys, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(keys)
+
+	res := listResult{Name: bucket, Prefix: prefix, Delimiter: delim, MaxKeys: maxKeys, ContinuationToken: q.Get("continuation-token"), Marker: q.Get("marker")}
+	var last string
+	for _, k := range keys {
+		if !strings.HasPrefix(k, prefix) || k <= after {
+			continue
+		}
+		if delim != "" {
+			if i := strings.Index(k[len(prefix):], delim); i >= 0 {
+				cp := k[:len(prefix)+i+len(delim)]
+				if cp <= after {
+					continue
+				}
+				if len(res.CommonPrefixes) == 0 || res.CommonPrefixes[len(res.CommonPrefixes)-1].Prefix != cp {
+					if len(res.Contents)+len(res.CommonPrefixes) == maxKeys {
+						res.IsTruncated = true
+						break
+					}
+					res.CommonPrefixes = append(res.CommonPrefixes, commonPrefix{Prefix: cp})
+				}
+				last = k
+				continue
+			}
+		}
+		if len(res.Contents)+len(res.CommonPrefixes) == maxKeys {
+			res.IsTruncated = true
+			break
+		}
+		st, err := os.Stat(s.objectPath(bucket, k))
+		if err != nil {
+			continue
+		}
+		m, _ := s.getMeta(bucket, k)
+		res.Contents = append(res.Contents, listEntry{
+			Key: k, LastModified: m.modTime.Format(time.RFC3339), ETag: m.etag, Size: st.Size(), StorageClass: "STANDARD",
+		})
+		last = k
+	}
+	if res.IsTruncated {
+		if v2 {
+			res.NextContinuationToken = last
+		} else {
+			res.NextMarker = last
+		}
+	}
+	res.KeyCount = len(res.Contents) + len(res.CommonPrefixes)
+	writeXML(w, res)
+}
+
+func (s *Server) createMultipart(w http.ResponseWriter, bucket, key string) {
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("upload-%d", s.nextID)
+	s.uploads[id] = &upload{bucket: bucket, key: key, parts: map[int]string{}}
+	s.mu.Unlock()
+	writeXML(w, struct {
+		XMLName  xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ InitiateMultipartUploadResult"`
+		Bucket   string   `xml:"Bucket"`
+		Key      string   `xml:"Key"`
+		UploadID string   `xml:"UploadId"`
+	}{Bucket: bucket, Key: key, UploadID: id})
+}
+
+func (s *Server) uploadPart(w http.ResponseWriter, r *http.Request, id, number string) {
+	n, err := strconv.Atoi(number)
+	if err != nil || n < 1 {
+		writeError(w, http.StatusBadRequest, "InvalidArgument", "bad partNumber")
+		return
+	}
+	s.mu.Lock()
+	up := s.uploads[id]
+	s.mu.Unlock()
+	if up == nil {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+	body, err := readBody(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "IncompleteBody", err.Error())
+		return
+	}
+	p := filepath.Join(s.root, "uploads", id, strconv.Itoa(n))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err == nil {
+		err = os.WriteFile(p, body, 0o644)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	s.mu.Lock()
+	up.parts[n] = p
+	s.mu.Unlock()
+	sum := md5.Sum(body)
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) completeMultipart(w http.ResponseWriter, r *http.Request, bucket, key, id string) {
+	var req struct {
+		Parts []struct {
+			PartNumber int `xml:"PartNumber"`
+		} `xml:"Part"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "MalformedXML", err.Error())
+		return
+	}
+	s.mu.Lock()
+	up := s.uploads[id]
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	if up == nil || up.bucket != bucket || up.key != key {
+		writeError(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist.")
+		return
+	}
+	var body []byte
+	var sums []byte
+	for _, part := range req.Parts {
+		p, ok := up.parts[part.PartNumber]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "InvalidPart", "part "+strconv.Itoa(part.PartNumber)+" was not uploaded")
+			return
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+			return
+		}
+		sum := md5.Sum(b)
+		sums = append(sums, sum[:]...)
+		body = append(body, b...)
+	}
+	_ = os.RemoveAll(filepath.Join(s.root, "uploads", id))
+	if err := s.PutObject(bucket, key, body); err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	// Multipart ETags are the MD5 of the part MD5s plus the part count.
+	sum := md5.Sum(sums)
+	etag := fmt.Sprintf(`"%s-%d"`, hex.EncodeToString(sum[:]), len(req.Parts))
+	s.setMeta(bucket, key, etag)
+	writeXML(w, struct {
+		XMLName xml.Name `xml:"http://s3.amazonaws.com/doc/2006-03-01/ CompleteMultipartUploadResult"`
+		Bucket  string   `xml:"Bucket"`
+		Key     string   `xml:"Key"`
+		ETag    string   `xml:"ETag"`
+	}{Bucket: bucket, Key: key, ETag: etag})
+}
+
+// readBody returns the request payload, decoding aws-chunked framing when
+// the SDK streams a signed body.
+func readBody(r *http.Request) ([]byte, error) {
+	if !strings.HasPrefix(r.Header.Get("x-amz-content-sha256"), "STREAMING-") &&
+		!slices.Contains(strings.Split(r.Header.Get("Content-Encoding"), ","), "aws-chunked") {
+		return io.ReadAll(r.Body)
+	}
+	var out []byte
+	br := bufio.NewReader(r.Body)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		sizeHex, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+		n, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return nil, errors.New("bad aws-chunked frame")
+		}
+		if n == 0 {
+			return out, nil // trailers, if any, are ignored
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+		if _, err := br.Discard(2); err != nil { // CRLF
+			return nil, err
+		}
+	}
+}
+
+func writeXML(w http.ResponseWriter, v any) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "InternalError", err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(b)
+}
+
+func writeError(w http.ResponseWriter, status int, code, msg string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_ = xml.NewEncoder(w).Encode(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string   `xml:"Code"`
+		Message string   `xml:"Message"`
+	}{Code: code, Message: msg})
+}
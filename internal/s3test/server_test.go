@@ -0,0 +1,175 @@
+package s3test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+func newClient(t *testing.T) (*Server, *s3.Client) {
+	t.Helper()
+	srv := NewServer(t)
+	srv.SetEnv(t)
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := s3.NewFromConfig(cfg, func(o *s3.Options) { o.UsePathStyle = true })
+	if _, err := cl.CreateBucket(context.Background(), &s3.CreateBucketInput{Bucket: aws.String("b")}); err != nil {
+		t.Fatalf("create bucket: %v", err)
+	}
+	return srv, cl
+}
+
+func TestPutGetHeadDelete(t *testing.T) {
+	srv, cl := newClient(t)
+	ctx := context.Background()
+	if _, err := cl.PutObject(ctx, &s3.PutObjectInput{Bucket: aws.String("b"), Key: aws.String("dir/obj"), Body: strings.NewReader("hello world")}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := srv.Object("b", "dir/obj"); string(got) != "hello world" {
+		t.Fatalf("stored %q", got)
+	}
+
+	out, err := cl.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("b"), Key: aws.String("dir/obj")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(out.Body)
+	out.Body.Close()
+	if string(b) != "hello world" || aws.ToString(out.ETag) != `"5eb63bbbe01eeed093cb22bb8f5acdc3"` {
+		t.Fatalf("get %q etag %s", b, aws.ToString(out.ETag))
+	}
+
+	rng, err := cl.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("b"), Key: aws.String("dir/obj"), Range: aws.String("bytes=6-")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = io.ReadAll(rng.Body)
+	rng.Body.Close()
+	if string(b) != "world" {
+		t.Fatalf("range get %q", b)
+	}
+
+	head, err := cl.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("b"), Key: aws.String("dir/obj")})
+	if err != nil || aws.ToInt64(head.ContentLength) != 11 {
+		t.Fatalf("head %+v %v", head, err)
+	}
+
+	if _, err := cl.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String("b"), Key: aws.String("dir/obj")}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = cl.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String("b"), Key: aws.String("dir/obj")})
+	var nsk *s3types.NoSuchKey
+	if !errors.As(err, &nsk) {
+		t.Fatalf("get after delete: %v", err)
+	}
+	_, err = cl.HeadObject(ctx, &s3.HeadObjectInput{Bucket: aws.String("b"), Key: aws.String("dir/obj")})
+	var api smithy.APIError
+	if !errors.As(err, &api) || api.ErrorCode() != "NotFound" {
+		t.Fatalf("head after delete: %v", err)
+	}
+}
+
+func TestMissingBucket(t *testing.T) {
+	_, cl := newClient(t)
+	_, err := cl.GetObject(context.Background(), &s3.GetObjectInput{Bucket: aws.String("nope"), Key: aws.String("k")})
+	var api smithy.APIError
+	if !errors.As(err, &api) || api.ErrorCode() != "NoSuchBucket" {
+		t.Fatalf("got %v", err)
+	}
+}
+
+func TestMultipart(t *testing.T) {
+	srv, cl := newClient(t)
+	ctx := context.Background()
+	up, err := cl.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("b"), Key: aws.String("big")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := [][]byte{bytes.Repeat([]byte("a"), 5<<20), []byte("tail")}
+	var done []s3types.CompletedPart
+	for i, p := range parts {
+		out, err := cl.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket: aws.String("b"), Key: aws.String("big"), UploadId: up.UploadId,
+			PartNumber: aws.Int32(int32(i + 1)), Body: bytes.NewReader(p),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		done = append(done, s3types.CompletedPart{ETag: out.ETag, PartNumber: aws.Int32(int32(i + 1))})
+	}
+	fin, err := cl.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket: aws.String("b"), Key: aws.String("big"), UploadId: up.UploadId,
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: done},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(aws.ToString(fin.ETag), `-2"`) {
+		t.Fatalf("multipart etag %s", aws.ToString(fin.ETag))
+	}
+	got, _ := srv.Object("b", "big")
+	if !bytes.Equal(got, append(append([]byte{}, parts[0]...), parts[1]...)) {
+		t.Fatalf("assembled object has %d bytes", len(got))
+	}
+
+	// Aborted uploads leave nothing behind.
+	up, err = cl.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{Bucket: aws.String("b"), Key: aws.String("gone")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{Bucket: aws.String("b"), Key: aws.String("gone"), UploadId: up.UploadId}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srv.Object("b", "gone"); err == nil {
+		t.Fatal("aborted upload was stored")
+	}
+}
+
+func TestListObjectsV2(t *testing.T) {
+	srv, cl := newClient(t)
+	for _, k := range []string{"a/1", "a/2", "a/3", "a/sub/4", "b/5", "top"} {
+		if err := srv.PutObject("b", k, []byte(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	// Paginate two keys at a time under a/.
+	var keys []string
+	p := s3.NewListObjectsV2Paginator(cl, &s3.ListObjectsV2Input{Bucket: aws.String("b"), Prefix: aws.String("a/"), MaxKeys: aws.Int32(2)})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range page.Contents {
+			keys = append(keys, aws.ToString(o.Key))
+		}
+	}
+	if strings.Join(keys, ",") != "a/1,a/2,a/3,a/sub/4" {
+		t.Fatalf("keys %v", keys)
+	}
+
+	out, err := cl.ListObjectsV2(ctx, &s3.ListObjectsV2Input{Bucket: aws.String("b"), Delimiter: aws.String("/")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var prefixes []string
+	for _, cp := range out.CommonPrefixes {
+		prefixes = append(prefixes, aws.ToString(cp.Prefix))
+	}
+	if strings.Join(prefixes, ",") != "a/,b/" || len(out.Contents) != 1 || aws.ToString(out.Contents[0].Key) != "top" {
+		t.Fatalf("prefixes %v contents %d", prefixes, len(out.Contents))
+	}
+}
@@ -0,0 +1,72 @@
+// Package tracing sets up OpenTelemetry tracing for the worker and gives the
+// rest of the code a tracer to start spans with.
+package tracing
+
+import (
+	"context"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the instrumentation scope of the spans started here.
+const Name = "github.com/yourorg/zone-names"
+
+// Enabled reports whether the environment asks for OTLP trace export, via
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT.
+func Enabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Setup installs a global tracer provider exporting over OTLP/gRPC, configured
+// by the standard OTEL_EXPORTER_OTLP_* variables, and the W3C trace context
+// propagator. service names the process unless OTEL_SERVICE_NAME is set.
+// Call the returned function on shutdown to flush buffered spans.
+func Setup(ctx context.Context, service string) (func(context.Context) error, error) {
+	exp, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return Install(sdktrace.NewBatchSpanProcessor(exp), service)
+}
+
+// Install installs a global tracer provider sending spans to sp; Setup uses
+// it with the OTLP exporter, tests with an in-memory one
+// (sdktrace.NewSimpleSpanProcessor(tracetest.NewInMemoryExporter())).
+func Install(sp sdktrace.SpanProcessor, service string) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(service)))
+	if err != nil {
+		return nil, err
+	}
+	// Variables come last so that OTEL_SERVICE_NAME wins.
+	if env, err := resource.New(context.Background(), resource.WithFromEnv()); err == nil {
+		res, _ = resource.Merge(res, env)
+	}
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sp), sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp.Shutdown, nil
+}
+
+// Start starts a span named name as a child of the span in ctx, if any. Until
+// a provider is installed, spans are no-ops.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(Name).Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End ends span, marking it failed with err if err is not nil.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStartEnd(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	shutdown, err := Install(sdktrace.NewSimpleSpanProcessor(exp), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+
+	ctx, parent := Start(context.Background(), "parent")
+	_, child := Start(ctx, "child", attribute.String("k", "v"))
+	End(child, errors.New("boom"))
+	End(parent, nil)
+
+	spans := exp.GetSpans()
+	if len(spans) != 2 || spans[0].Name != "child" || spans[1].Name != "parent" {
+		t.Fatalf("spans %+v", spans.Snapshots())
+	}
+	c, p := spans[0], spans[1]
+	if c.Parent.SpanID() != p.SpanContext.SpanID() || c.Status.Code != codes.Error || len(c.Events) != 1 || p.Status.Code == codes.Error {
+		t.Fatalf("child %+v", c)
+	}
+	if c.Attributes[0] != attribute.String("k", "v") || c.InstrumentationLibrary.Name != Name {
+		t.Fatalf("child attributes %v, scope %v", c.Attributes, c.InstrumentationLibrary)
+	}
+	if v, _ := p.Resource.Set().Value("service.name"); v.AsString() != "test" {
+		t.Fatalf("resource %v", p.Resource)
+	}
+}
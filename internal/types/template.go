@@ -0,0 +1,69 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// TemplateData is what text/template placeholders in ZoneURI, OutputURI and
+// ScratchSubdir can refer to, e.g. "s3://zones/{{.Date}}/com.zone.gz" or
+// `{{.Time.Format "2006/01/02"}}`.
+type TemplateData struct {
+	Date string    // Time as 2006-01-02
+	Time time.Time // the run's nominal time, in WorkflowParams.TimeZone
+}
+
+// Templated reports whether any templated field contains a placeholder.
+func (p WorkflowParams) Templated() bool {
+	for _, s := range []string{p.ZoneURI, p.OutputURI, p.ScratchSubdir} {
+		if strings.Contains(s, "{{") {
+			return true
+		}
+	}
+	return false
+}
+
+// Render returns p with the placeholders in ZoneURI, OutputURI and
+// ScratchSubdir expanded for the nominal time t. The workflow uses the
+// schedule time for runs started by a Temporal Schedule (backfills
+// included) and its start time otherwise. Dates are taken in p.TimeZone.
+func (p WorkflowParams) Render(t time.Time) (WorkflowParams, error) {
+	loc, err := p.Location()
+	if err != nil {
+		return p, err
+	}
+	t = t.In(loc)
+	data := TemplateData{Date: t.Format("2006-01-02"), Time: t}
+	for _, f := range []struct {
+		name string
+		v    *string
+	}{{"ZoneURI", &p.ZoneURI}, {"OutputURI", &p.OutputURI}, {"ScratchSubdir", &p.ScratchSubdir}} {
+		if !strings.Contains(*f.v, "{{") {
+			continue
+		}
+		tmpl, err := template.New(f.name).Option("missingkey=error").Parse(*f.v)
+		if err != nil {
+			return p, fmt.Errorf("%s: %w", f.name, err)
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, data); err != nil {
+			return p, fmt.Errorf("%s: %w", f.name, err)
+		}
+		*f.v = b.String()
+	}
+	return p, nil
+}
+
+// Location returns the time zone named by TimeZone; UTC if it is empty.
+func (p WorkflowParams) Location() (*time.Location, error) {
+	if p.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(p.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("TimeZone: %w", err)
+	}
+	return loc, nil
+}
@@ -1,28 +1,424 @@
 package types
 
+import (
+	"strings"
+	"time"
+)
+
+// WorkflowParams are the inputs of Zone2NamesWorkflow. ZoneURI and OutputURI
+// are required; every other field is optional, with the zero value meaning
+// the default, and is left out of the JSON encoding (memos, manifests) when
+// unset. OutputLayout encodes as {} then.
 type WorkflowParams struct {
-	ZoneURI   string // file:// or s3://
-	OutputURI string // where names.txt goes (same scheme); manifest.json at same prefix
-	Shards    int
-	Filters   []string // e.g. ["A","AAAA","CNAME"]
-	IDNMode   string   // "alabel"|"ulabel"|"none"
+	ZoneURI   string   // file:// or s3://
+	OutputURI string   // where names.txt goes (same scheme); manifest.json at same prefix
+	Shards    int      `json:",omitempty"`
+	Filters   []string `json:",omitempty"` // e.g. ["A","AAAA","CNAME"]
+	IDNMode   string   `json:",omitempty"` // "alabel"|"ulabel"|"none"
+	// ShardMode is "fixed" (default: Shards shards) or "auto" (Shards must be
+	// 0; the count is picked from the input size, see ShardCount). Either way
+	// the manifest records the count used.
+	ShardMode string `json:",omitempty"`
+	// TargetShardBytes is the uncompressed zone text per shard in auto mode.
+	// Defaults to DefaultTargetShardBytes.
+	TargetShardBytes int64 `json:",omitempty"`
 	// Optional relative subdirectory under scratch root where this workflow writes temp files.
 	// If empty, activities may use the scratch root directly.
-	ScratchSubdir string
+	ScratchSubdir string `json:",omitempty"`
 	// If true, workflow will skip cleaning up the scratch subdir after completion/failure.
-	KeepScratch bool
+	KeepScratch bool `json:",omitempty"`
+	// If true, run the full pipeline even when the manifest at the output location
+	// shows the same input was already processed with the same parameters.
+	Force bool `json:",omitempty"`
+	// AllowInclude lets a file:// zone $INCLUDE other files, as long as they
+	// lie under the zone file's own directory. Without it a zone that uses
+	// $INCLUDE fails to parse.
+	AllowInclude bool `json:",omitempty"`
+	// How the merged names are laid out at OutputURI; zero value is a single file.
+	OutputLayout OutputLayout
+	// OutputFormat is "text" (default: one name per line) or "parquet".
+	OutputFormat string `json:",omitempty"`
+	// SortOrder is "bytes" (default: plain byte order) or "canonical" (DNS
+	// canonical order, RFC 4034 §6.1: labels compared right to left, so
+	// subdomains sort directly after their parent).
+	SortOrder string `json:",omitempty"`
+	// MergeStrategy is "single" (default: one activity merges every shard),
+	// "hierarchical" (groups of MergeFanIn shards are merged in parallel
+	// activities, then merged once more) or "concat" (shards are concatenated
+	// without a global sort; output is sorted only within each shard).
+	MergeStrategy string `json:",omitempty"`
+	// MergeFanIn is the most shards a single merge step opens at once in the
+	// hierarchical strategy. Defaults to DefaultMergeFanIn.
+	MergeFanIn int `json:",omitempty"`
+	// SplitShardBytes is the shard size above which a shard is split into
+	// sub-shards before dedupe, to even out skew. 0 means the default: four
+	// times the mean shard size, but at least MinSplitShardBytes. -1 disables
+	// splitting.
+	SplitShardBytes int64 `json:",omitempty"`
+	// MaxParallelDedupe caps how many shard dedupe activities are scheduled
+	// at once; the rest start as earlier ones finish. 0 schedules every
+	// shard at once. Each running dedupe holds a Badger DB open.
+	MaxParallelDedupe int `json:",omitempty"`
+	// TimeZone is the IANA zone template dates are rendered in, e.g.
+	// "Europe/Berlin" (default UTC). Schedules set it to their own zone.
+	TimeZone string `json:",omitempty"`
+	// MetricsZone, if set, is the zone label on this run's metrics, e.g.
+	// "com" for a zone file named "com-20241018.zone.gz". See ZoneLabel.
+	MetricsZone string `json:",omitempty"`
+	// Notify, if set, posts a webhook when the run finishes.
+	Notify *Notify `json:",omitempty"`
+}
+
+// Notify configures the completion webhook.
+type Notify struct {
+	URL string // http:// or https:// endpoint; receives one POST per event
+	// Secret, if set, keys an HMAC-SHA256 of the request body, sent as
+	// "sha256=<hex>" in the SignatureHeader. It is part of the workflow input,
+	// so anyone who can read the workflow history can read it; it is masked
+	// in the memo and not written to the manifest.
+	Secret string
+	// Events to send (EventSucceeded, EventSkipped, EventFailed); empty means all.
+	Events []string
+}
+
+// Notification events.
+const (
+	EventSucceeded = "succeeded"
+	EventSkipped   = "skipped" // input unchanged; the previous output stands
+	EventFailed    = "failed"
+)
+
+// Wants reports whether the webhook should be called for event. A nil
+// Notify wants nothing.
+func (n *Notify) Wants(event string) bool {
+	if n == nil || n.URL == "" {
+		return false
+	}
+	if len(n.Events) == 0 {
+		return true
+	}
+	for _, e := range n.Events {
+		if strings.EqualFold(e, event) {
+			return true
+		}
+	}
+	return false
+}
+
+// Shard modes.
+const (
+	ShardsFixed = "fixed"
+	ShardsAuto  = "auto"
+)
+
+// DefaultShards is the shard count in fixed mode when Shards is unset, and in
+// auto mode when the input size is unknown.
+const DefaultShards = 32
+
+// DefaultTargetShardBytes is the auto mode shard size when TargetShardBytes is unset.
+const DefaultTargetShardBytes = 256 << 20
+
+// GzipRatio is how much a gzip-compressed zone is assumed to expand, for
+// sizing shards in auto mode and estimating scratch space; zone files
+// typically compress 4-6x.
+const GzipRatio = 5
+
+// ShardCount returns how many shards to partition the zone into, given its
+// size as stored (compressed for .gz zones; 0 if unknown). In auto mode that
+// is the estimated uncompressed size over TargetShardBytes, between 1 and
+// MaxShards.
+func (p WorkflowParams) ShardCount(size int64) int {
+	if p.ShardMode != ShardsAuto {
+		if p.Shards <= 0 {
+			return DefaultShards
+		}
+		return p.Shards
+	}
+	if size <= 0 {
+		return DefaultShards
+	}
+	if strings.HasSuffix(strings.ToLower(p.ZoneURI), ".gz") {
+		size *= GzipRatio
+	}
+	target := p.targetShardBytes()
+	return int(min(max((size+target-1)/target, 1), MaxShards))
+}
+
+func (p WorkflowParams) targetShardBytes() int64 {
+	if p.TargetShardBytes <= 0 {
+		return DefaultTargetShardBytes
+	}
+	return p.TargetShardBytes
+}
+
+// MinSplitShardBytes is the smallest default split threshold: shards below
+// it are never split unless SplitShardBytes asks for it.
+const MinSplitShardBytes = 64 << 20
+
+// MaxSplitParts caps how many sub-shards one shard is split into.
+const MaxSplitParts = 64
+
+// ShardSplits returns, by shard index, how many sub-shards each shard of r
+// above the split threshold should be split into. Each sub-shard is then
+// expected to be around the threshold or below.
+func (p WorkflowParams) ShardSplits(r PartitionResult) map[int]int {
+	threshold := p.SplitShardBytes
+	if threshold < 0 || len(r.ShardBytes) == 0 {
+		return nil
+	}
+	if threshold == 0 {
+		var total int64
+		for _, b := range r.ShardBytes {
+			total += b
+		}
+		threshold = max(4*total/int64(len(r.ShardBytes)), MinSplitShardBytes)
+	}
+	splits := map[int]int{}
+	for i, b := range r.ShardBytes {
+		if b > threshold {
+			splits[i] = int(min((b+threshold-1)/threshold, MaxSplitParts))
+		}
+	}
+	return splits
+}
+
+// Merge strategies.
+const (
+	MergeSingle       = "single"
+	MergeHierarchical = "hierarchical"
+	MergeConcat       = "concat"
+)
+
+// DefaultMergeFanIn is the hierarchical merge group size used when MergeFanIn is unset.
+const DefaultMergeFanIn = 32
+
+// Merge returns MergeStrategy with the default applied.
+func (p WorkflowParams) Merge() string {
+	if p.MergeStrategy == "" {
+		return MergeSingle
+	}
+	return p.MergeStrategy
+}
+
+// Name sort orders.
+const (
+	OrderBytes     = "bytes"
+	OrderCanonical = "canonical"
+)
+
+// Order returns SortOrder with the default applied.
+func (p WorkflowParams) Order() string {
+	if p.SortOrder == "" {
+		return OrderBytes
+	}
+	return p.SortOrder
+}
+
+// Output formats.
+const (
+	FormatText    = "text"
+	FormatParquet = "parquet"
+)
+
+// Format returns OutputFormat with the default applied.
+func (p WorkflowParams) Format() string {
+	if p.OutputFormat == "" {
+		return FormatText
+	}
+	return p.OutputFormat
+}
+
+// ZoneLabel names the zone in metrics: MetricsZone if set, else the zone
+// file's name up to the first dot, lowercased, if that looks like a TLD
+// ("s3://zones/2024-05-02/com.zone.gz" gives "com"). Other names, such as
+// date-stamped "com-20241018.zone.gz", give "other", so file naming can't
+// blow up the label's cardinality.
+func (p WorkflowParams) ZoneLabel() string {
+	if p.MetricsZone != "" {
+		return strings.ToLower(p.MetricsZone)
+	}
+	name := p.ZoneURI[strings.LastIndexByte(p.ZoneURI, '/')+1:]
+	name, _, _ = strings.Cut(strings.ToLower(name), ".")
+	if !tldLike(name) {
+		return "other"
+	}
+	return name
+}
+
+// tldLike accepts lowercase names shaped like a TLD: letters only ("com",
+// "root"), or an A-label ("xn--p1ai").
+func tldLike(name string) bool {
+	if name == "" || len(name) > 63 {
+		return false
+	}
+	if rest, ok := strings.CutPrefix(name, "xn--"); ok {
+		return rest != "" && strings.Trim(rest, "abcdefghijklmnopqrstuvwxyz0123456789-") == ""
+	}
+	return strings.Trim(name, "abcdefghijklmnopqrstuvwxyz") == ""
+}
+
+// WantsRRTypes reports whether the RR types seen for each name must be carried
+// through partition and dedupe. Only formats with an RR types column need it.
+func (p WorkflowParams) WantsRRTypes() bool { return p.Format() == FormatParquet }
+
+// Output layout modes.
+const (
+	LayoutSingle = "single" // one file at OutputURI (default)
+	LayoutParts  = "parts"  // size-capped part files next to OutputURI
+)
+
+// OutputLayout controls how merged names are written.
+//
+// In "parts" mode, OutputURI names the series: ".../names.txt" produces
+// ".../names-00000.txt.zst", ".../names-00001.txt.zst", ... Parts are sorted
+// and non-overlapping, and each part's first/last name is recorded in the
+// manifest so consumers can locate a name without scanning every part.
+type OutputLayout struct {
+	Mode string `json:",omitempty"` // LayoutSingle or LayoutParts; empty means single
+	// PartMaxBytes caps the uncompressed size of each part. A part is closed
+	// after the name that reaches the cap. Defaults to 256 MiB.
+	PartMaxBytes int64 `json:",omitempty"`
+	// Compression of text part files: "zstd" (default) or "none". Parquet
+	// parts are always written with zstd-compressed pages instead.
+	Compression string `json:",omitempty"`
+}
+
+// DefaultPartMaxBytes is the part size cap used when PartMaxBytes is unset.
+const DefaultPartMaxBytes = 256 << 20
+
+// WithDefaults fills in unset fields. Part settings are cleared for the single
+// layout so that equivalent layouts compare equal.
+func (l OutputLayout) WithDefaults() OutputLayout {
+	if l.Mode == "" {
+		l.Mode = LayoutSingle
+	}
+	if l.Mode != LayoutParts {
+		return OutputLayout{Mode: l.Mode}
+	}
+	if l.PartMaxBytes <= 0 {
+		l.PartMaxBytes = DefaultPartMaxBytes
+	}
+	if l.Compression == "" {
+		l.Compression = "zstd"
+	}
+	return l
+}
+
+// SameOutput reports whether p and q produce identical output for identical
+// input. Fields that only affect how the work is done (shard count outside
+// concat merges, scratch handling, Force) are ignored.
+func (p WorkflowParams) SameOutput(q WorkflowParams) bool {
+	if p.OutputURI != q.OutputURI || p.IDNMode != q.IDNMode {
+		return false
+	}
+	if p.Format() != q.Format() || p.Order() != q.Order() || p.OutputLayout.WithDefaults() != q.OutputLayout.WithDefaults() {
+		return false
+	}
+	// single and hierarchical merges produce the same bytes; concat doesn't,
+	// and its order also depends on how names were sharded.
+	if (p.Merge() == MergeConcat) != (q.Merge() == MergeConcat) {
+		return false
+	}
+	if p.Merge() == MergeConcat && !sameSharding(p, q) {
+		return false
+	}
+	return sameTypeSet(p.Filters, q.Filters)
+}
+
+// sameSharding reports whether p and q split the same input into the same
+// shards, skewed shards included. In auto mode the count follows from the
+// input, which callers compare separately.
+func sameSharding(p, q WorkflowParams) bool {
+	if p.SplitShardBytes != q.SplitShardBytes {
+		return false
+	}
+	if p.ShardMode == ShardsAuto || q.ShardMode == ShardsAuto {
+		return p.ShardMode == q.ShardMode && p.targetShardBytes() == q.targetShardBytes()
+	}
+	return p.ShardCount(0) == q.ShardCount(0)
+}
+
+func sameTypeSet(a, b []string) bool {
+	set := func(xs []string) map[string]bool {
+		m := make(map[string]bool, len(xs))
+		for _, x := range xs {
+			m[strings.ToUpper(x)] = true
+		}
+		return m
+	}
+	sa, sb := set(a), set(b)
+	if len(sa) != len(sb) {
+		return false
+	}
+	for k := range sa {
+		if !sb[k] {
+			return false
+		}
+	}
+	return true
 }
 
 type PartitionResult struct {
-	ShardURIs []string
-	Records   uint64
-	SizeBytes int64
-	InputHash string // optional; not filled in this scaffold
+	ShardURIs  []string
+	ShardLines []uint64 // lines written to each shard, by index
+	ShardBytes []int64  // bytes written to each shard, by index
+	Records    uint64
+	SizeBytes  int64  // raw input bytes read (before decompression)
+	InputHash  string // hex SHA-256 of the raw input bytes
+	InputETag  string // S3 ETag of the input, if any
+	// Includes is set when the zone pulled in other files with $INCLUDE,
+	// which InputHash doesn't cover.
+	Includes bool `json:",omitempty"`
+	Timing   PhaseTiming
+}
+
+// SplitShardParams asks SplitShard to re-hash one shard into Parts sub-shards.
+type SplitShardParams struct {
+	ShardURI string
+	Parts    int
+	Zone     string `json:",omitempty"` // metrics label, WorkflowParams.ZoneLabel
+}
+
+// SplitShardResult lists the sub-shards in the same form as PartitionResult.
+type SplitShardResult struct {
+	ShardURIs  []string
+	ShardLines []uint64
+	ShardBytes []int64
+}
+
+// ReplaceShards returns r with every shard i in subs replaced, in place, by
+// its sub-shards.
+func (r PartitionResult) ReplaceShards(subs map[int]SplitShardResult) PartitionResult {
+	counts := len(r.ShardLines) == len(r.ShardURIs) && len(r.ShardBytes) == len(r.ShardURIs)
+	out := r
+	out.ShardURIs, out.ShardLines, out.ShardBytes = nil, nil, nil
+	for i, uri := range r.ShardURIs {
+		s, ok := subs[i]
+		if !ok {
+			out.ShardURIs = append(out.ShardURIs, uri)
+			if counts {
+				out.ShardLines = append(out.ShardLines, r.ShardLines[i])
+				out.ShardBytes = append(out.ShardBytes, r.ShardBytes[i])
+			}
+			continue
+		}
+		out.ShardURIs = append(out.ShardURIs, s.ShardURIs...)
+		if counts {
+			out.ShardLines = append(out.ShardLines, s.ShardLines...)
+			out.ShardBytes = append(out.ShardBytes, s.ShardBytes...)
+		}
+	}
+	return out
 }
 
 type ShardDedupeParams struct {
 	ShardURI  string // input shard
 	OutputURI string // output sorted unique shard
+	// WithTypes means shard lines are "name<TAB>TYPE"; the output then carries
+	// the union of types per name as "name<TAB>A,NS,...".
+	WithTypes bool
+	SortOrder string // see WorkflowParams.SortOrder
+	Zone      string `json:",omitempty"` // metrics label, WorkflowParams.ZoneLabel
 }
 
 type ShardStats struct {
@@ -35,14 +431,196 @@ type MergeParams struct {
 	OutURI          string // final names.txt
 	ManifestURI     string // manifest.json
 	Params          WorkflowParams
-	ShardStats      []ShardStats
-	TotalSeen       uint64
+	// Shards and SplitShards are recorded in the manifest. A zero Shards
+	// (params from before the field) means len(ShardStats).
+	Shards      int `json:",omitempty"`
+	SplitShards int `json:",omitempty"`
+	ShardStats  []ShardStats
+	TotalSeen   uint64
+	Input       FileInfo // input zone as observed by StreamPartition
+	// Timings of the phases that ran before merge; Merge is filled in by the activity.
+	Phases PhaseTimings
 }
+
+// MergeShardsParams merges a group of sorted shards into one sorted
+// intermediate file (hierarchical merge strategy).
+type MergeShardsParams struct {
+	ShardURIs []string
+	OutputURI string
+	SortOrder string
+	Zone      string `json:",omitempty"` // metrics label, WorkflowParams.ZoneLabel
+}
+
 type MergeStats struct {
 	Emitted uint64
+	// Skipped is set when the run was short-circuited because the input was
+	// unchanged since the previous manifest; Emitted then comes from that manifest.
+	Skipped bool
+}
+
+// UnchangedParams asks whether ZoneURI still matches the input recorded in
+// the manifest at ManifestURI.
+type UnchangedParams struct {
+	ZoneURI     string
+	ManifestURI string
+	Params      WorkflowParams
+}
+
+type UnchangedResult struct {
+	Unchanged bool
+	Reason    string // why the previous output can't be reused; empty when Unchanged
+	Previous  MergeStats
+}
+
+// NotifyParams is the input of the Notify activity.
+type NotifyParams struct {
+	Notify      Notify
+	Event       string
+	WorkflowID  string
+	RunID       string
+	ZoneURI     string
+	OutputURI   string
+	ManifestURI string // summarised in the notification unless Event is EventFailed
+	Error       string // why the run failed; EventFailed only
+}
+
+// Webhook request headers. DeliveryHeader is "<run ID>/<event>" and stays the
+// same across retries, so receivers can drop duplicates.
+const (
+	EventHeader     = "X-Zone-Names-Event"
+	DeliveryHeader  = "X-Zone-Names-Delivery"
+	SignatureHeader = "X-Zone-Names-Signature"
+)
+
+// Notification is the JSON body posted to Notify.URL.
+type Notification struct {
+	Event       string           `json:"event"`
+	WorkflowID  string           `json:"workflow_id"`
+	RunID       string           `json:"run_id"`
+	ZoneURI     string           `json:"zone"`
+	OutputURI   string           `json:"output"`
+	ManifestURI string           `json:"manifest"`
+	Error       string           `json:"error,omitempty"`
+	Summary     *ManifestSummary `json:"summary,omitempty"` // not set for EventFailed
+	SentAt      time.Time        `json:"sent_at"`
+}
+
+// ManifestSummary is the part of a Manifest included in notifications.
+type ManifestSummary struct {
+	Input     FileInfo  `json:"input"`
+	Output    FileInfo  `json:"output"`
+	Parts     int       `json:"parts,omitempty"`
+	TotalSeen uint64    `json:"total_seen"`
+	Unique    uint64    `json:"unique"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // CleanupParams instructs the cleanup activity which subdir to remove.
 type CleanupParams struct {
 	ScratchSubdir string
 }
+
+// ScratchOwnerFile is written into a run's scratch subdirectory with the ID
+// of the workflow that owns it, so leftovers of crashed or terminated runs
+// can be matched to their workflow even with a custom ScratchSubdir.
+const ScratchOwnerFile = ".workflow-id"
+
+// ManifestVersion is the schema version written to manifest.json. Bump it
+// whenever a field is removed or changes meaning.
+const ManifestVersion = 1
+
+// Manifest is the document written next to the names output.
+type Manifest struct {
+	Version     int            `json:"version"`
+	Input       FileInfo       `json:"input"`
+	Output      FileInfo       `json:"output"`
+	ManifestURI string         `json:"manifest"`
+	Params      WorkflowParams `json:"params"`
+	TotalSeen   uint64         `json:"total_seen"`
+	Unique      uint64         `json:"unique"`
+	// Shards is the shard count partition used, which in auto mode Params
+	// doesn't say.
+	Shards int `json:"shards"`
+	// SplitShards is how many of those were split into sub-shards before
+	// dedupe; ShardStats has one entry per shard deduped, sub-shards included.
+	SplitShards int          `json:"split_shards,omitempty"`
+	ShardStats  []ShardStats `json:"shard_stats"`
+	Parts       []PartInfo   `json:"parts,omitempty"` // only for the "parts" layout, in name order
+	Phases      PhaseTimings `json:"phases"`
+	Worker      string       `json:"worker"` // identity of the worker that wrote the manifest
+	CreatedAt   time.Time    `json:"created_at"`
+}
+
+// FileInfo identifies an object by location, size and content digest.
+type FileInfo struct {
+	URI    string `json:"uri"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	ETag   string `json:"etag,omitempty"` // S3 only
+	// Includes marks a zone input that $INCLUDEs other files; SHA256 covers
+	// only this one, so an unchanged digest doesn't mean unchanged input.
+	Includes bool `json:"includes,omitempty"`
+}
+
+// PartInfo describes one part file of a "parts" layout. Bytes and SHA256
+// refer to the stored (possibly compressed) object; First and Last are the
+// first and last names it contains.
+type PartInfo struct {
+	FileInfo
+	First string `json:"first"`
+	Last  string `json:"last"`
+	Count uint64 `json:"count"`
+}
+
+// PhaseTiming records when a pipeline phase ran and where.
+type PhaseTiming struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Worker     string    `json:"worker,omitempty"` // empty when the phase spans several workers
+}
+
+type PhaseTimings struct {
+	Partition PhaseTiming `json:"partition"`
+	Dedupe    PhaseTiming `json:"dedupe"`
+	Merge     PhaseTiming `json:"merge"`
+}
+
+// Progress is what Zone2NamesWorkflow reports to the "progress" query.
+type Progress struct {
+	Phase         string // one of the Phase* constants
+	Shards        int    // shards produced by partition; 0 before that
+	ShardsDeduped int
+	Records       uint64 // records read by partition
+	Unique        uint64 // names written; set once merge is done
+}
+
+// QueryProgress is the name of the workflow query returning Progress.
+const QueryProgress = "progress"
+
+// Workflow phases reported in Progress.
+const (
+	PhaseStarting     = "starting"
+	PhaseChecking     = "checking" // comparing the input with the previous manifest
+	PhasePartitioning = "partitioning"
+	PhaseDeduping     = "deduping"
+	PhaseMerging      = "merging"
+	PhaseCleanup      = "cleanup"
+	PhaseNotifying    = "notifying" // posting the completion webhook
+	PhaseDone         = "done"
+	PhaseSkipped      = "skipped" // input unchanged; nothing was done
+	PhaseFailed       = "failed"
+	PhaseCanceled     = "canceled"
+)
+
+// Types of the non-retryable application errors the workflow and activities
+// fail with when retrying can't help. Callers can match them with
+// temporal.ApplicationError.Type.
+const (
+	ErrTypeInvalidParams = "InvalidParams" // rejected by Validate, or an unusable parameter
+	ErrTypeInvalidInput  = "InvalidInput"  // the zone file can't be parsed
+	ErrTypeNotFound      = "NotFound"      // a file, object or bucket doesn't exist
+	ErrTypeAccessDenied  = "AccessDenied"  // permissions or credentials
+	// The worker's scratch file system is too small for the zone, or filled
+	// up while an activity was writing to it.
+	ErrTypeInsufficientSpace = "InsufficientSpace"
+)
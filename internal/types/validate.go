@@ -0,0 +1,168 @@
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// MaxShards bounds Shards: every shard is a scratch file during partition and
+// a Badger DB during dedupe.
+const MaxShards = 4096
+
+// Validate reports the first problem with p, or nil. Zero values that have a
+// default (Shards, IDNMode, OutputFormat, ...) are accepted. Templated
+// fields are checked as rendered for an arbitrary date.
+func (p WorkflowParams) Validate() error {
+	if _, err := p.Location(); err != nil {
+		return err
+	}
+	if p.Templated() {
+		r, err := p.Render(time.Time{})
+		if err != nil {
+			return err
+		}
+		p = r
+	}
+	if err := checkURI("ZoneURI", p.ZoneURI); err != nil {
+		return err
+	}
+	if err := checkURI("OutputURI", p.OutputURI); err != nil {
+		return err
+	}
+	if p.OutputURI == p.ZoneURI {
+		return errors.New("OutputURI must differ from ZoneURI")
+	}
+	if p.AllowInclude && !strings.HasPrefix(p.ZoneURI, "file://") {
+		return errors.New("AllowInclude needs a file:// ZoneURI")
+	}
+	if err := checkSubdir(p.ScratchSubdir); err != nil {
+		return err
+	}
+	if p.Shards < 0 || p.Shards > MaxShards {
+		return fmt.Errorf("Shards must be between 1 and %d (0 for the default), got %d", MaxShards, p.Shards)
+	}
+	if err := oneOf("ShardMode", p.ShardMode, ShardsFixed, ShardsAuto); err != nil {
+		return err
+	}
+	if p.ShardMode == ShardsAuto && p.Shards != 0 {
+		return fmt.Errorf("Shards must be 0 when ShardMode is auto, got %d", p.Shards)
+	}
+	if p.TargetShardBytes < 0 {
+		return fmt.Errorf("TargetShardBytes must not be negative, got %d", p.TargetShardBytes)
+	}
+	for _, f := range p.Filters {
+		if _, ok := dns.StringToType[strings.ToUpper(f)]; !ok {
+			return fmt.Errorf("Filters: unknown RR type %q", f)
+		}
+	}
+	if err := oneOf("IDNMode", p.IDNMode, "alabel", "ulabel", "none"); err != nil {
+		return err
+	}
+	if err := oneOf("OutputFormat", p.OutputFormat, FormatText, FormatParquet); err != nil {
+		return err
+	}
+	if err := oneOf("SortOrder", p.SortOrder, OrderBytes, OrderCanonical); err != nil {
+		return err
+	}
+	if err := oneOf("MergeStrategy", p.MergeStrategy, MergeSingle, MergeHierarchical, MergeConcat); err != nil {
+		return err
+	}
+	if p.MergeFanIn < 0 || p.MergeFanIn == 1 {
+		return fmt.Errorf("MergeFanIn must be at least 2 (0 for the default), got %d", p.MergeFanIn)
+	}
+	if p.SplitShardBytes < 0 && p.SplitShardBytes != -1 {
+		return fmt.Errorf("SplitShardBytes must be positive, 0 for the default or -1 to disable, got %d", p.SplitShardBytes)
+	}
+	if p.MaxParallelDedupe < 0 {
+		return fmt.Errorf("MaxParallelDedupe must not be negative, got %d", p.MaxParallelDedupe)
+	}
+	if err := oneOf("OutputLayout.Mode", p.OutputLayout.Mode, LayoutSingle, LayoutParts); err != nil {
+		return err
+	}
+	if p.OutputLayout.PartMaxBytes < 0 {
+		return fmt.Errorf("OutputLayout.PartMaxBytes must not be negative, got %d", p.OutputLayout.PartMaxBytes)
+	}
+	if err := oneOf("OutputLayout.Compression", p.OutputLayout.Compression, "zstd", "none"); err != nil {
+		return err
+	}
+	// Parts are indexed by their first and last names, which only works if
+	// the output is globally sorted.
+	if p.Merge() == MergeConcat && p.OutputLayout.Mode == LayoutParts {
+		return errors.New("MergeStrategy concat can't be used with the parts layout: its output isn't globally sorted")
+	}
+	if z := p.MetricsZone; z != "" && (len(z) > 63 || strings.Trim(strings.ToLower(z), "abcdefghijklmnopqrstuvwxyz0123456789-_") != "") {
+		return fmt.Errorf("MetricsZone: want at most 63 letters, digits, '-' or '_', got %q", z)
+	}
+	if n := p.Notify; n != nil {
+		u, err := url.Parse(n.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("Notify.URL: want an http:// or https:// URL, got %q", n.URL)
+		}
+		for _, e := range n.Events {
+			if err := oneOf("Notify.Events", strings.ToLower(e), EventSucceeded, EventSkipped, EventFailed); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func checkURI(field, uri string) error {
+	if uri == "" {
+		return errors.New(field + " is required")
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return fmt.Errorf("%s: %w", field, err)
+	}
+	switch u.Scheme {
+	case "file":
+		if u.Path == "" {
+			return fmt.Errorf("%s: no path in %q", field, uri)
+		}
+	case "s3":
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return fmt.Errorf("%s: want s3://bucket/key, got %q", field, uri)
+		}
+	default:
+		return fmt.Errorf("%s: unsupported scheme in %q (want file:// or s3://)", field, uri)
+	}
+	return nil
+}
+
+// checkSubdir accepts a relative path that stays under, and isn't, the
+// scratch root: cleanup removes the whole subdirectory.
+func checkSubdir(sub string) error {
+	if sub != "" && filepath.Clean(sub) == "." {
+		return fmt.Errorf("ScratchSubdir must name a directory below the scratch root, got %q", sub)
+	}
+	if path.IsAbs(sub) || filepath.IsAbs(sub) {
+		return fmt.Errorf("ScratchSubdir must be relative to the scratch root, got %q", sub)
+	}
+	for _, el := range strings.FieldsFunc(sub, func(r rune) bool { return r == '/' || r == filepath.Separator }) {
+		if el == ".." {
+			return fmt.Errorf("ScratchSubdir must not contain \"..\", got %q", sub)
+		}
+	}
+	return nil
+}
+
+// oneOf accepts v if it is empty (the default) or one of allowed.
+func oneOf(field, v string, allowed ...string) error {
+	if v == "" {
+		return nil
+	}
+	for _, a := range allowed {
+		if v == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: unsupported value %q (want one of %s)", field, v, strings.Join(allowed, ", "))
+}
@@ -0,0 +1,239 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	ok := WorkflowParams{ZoneURI: "s3://zones/com.zone.gz", OutputURI: "file:///data/com/names.txt"}
+	if err := ok.Validate(); err != nil {
+		t.Fatalf("minimal params: %v", err)
+	}
+
+	for name, tc := range map[string]struct {
+		mut  func(*WorkflowParams)
+		want string
+	}{
+		"no zone":         {func(p *WorkflowParams) { p.ZoneURI = "" }, "ZoneURI is required"},
+		"http zone":       {func(p *WorkflowParams) { p.ZoneURI = "https://x/com.zone" }, "unsupported scheme"},
+		"plain path":      {func(p *WorkflowParams) { p.OutputURI = "/data/names.txt" }, "unsupported scheme"},
+		"s3 without key":  {func(p *WorkflowParams) { p.OutputURI = "s3://bucket/" }, "s3://bucket/key"},
+		"output is zone":  {func(p *WorkflowParams) { p.OutputURI = p.ZoneURI }, "differ from ZoneURI"},
+		"include on s3":   {func(p *WorkflowParams) { p.AllowInclude = true }, "AllowInclude"},
+		"absolute subdir": {func(p *WorkflowParams) { p.ScratchSubdir = "/tmp/x" }, "ScratchSubdir"},
+		"subdir escapes":  {func(p *WorkflowParams) { p.ScratchSubdir = "runs/../../x" }, "ScratchSubdir"},
+		"subdir is root":  {func(p *WorkflowParams) { p.ScratchSubdir = "." }, "ScratchSubdir"},
+		"subdir is root/": {func(p *WorkflowParams) { p.ScratchSubdir = "./" }, "ScratchSubdir"},
+		"subdir is .//.":  {func(p *WorkflowParams) { p.ScratchSubdir = ".//." }, "ScratchSubdir"},
+		"negative shards": {func(p *WorkflowParams) { p.Shards = -1 }, "Shards"},
+		"too many shards": {func(p *WorkflowParams) { p.Shards = MaxShards + 1 }, "Shards"},
+		"concat parts":    {func(p *WorkflowParams) { p.MergeStrategy, p.OutputLayout.Mode = MergeConcat, LayoutParts }, "concat"},
+		"metrics zone":    {func(p *WorkflowParams) { p.MetricsZone = "com/2024" }, "MetricsZone"},
+		"bad filter":      {func(p *WorkflowParams) { p.Filters = []string{"A", "BOGUS"} }, `"BOGUS"`},
+		"bad idn":         {func(p *WorkflowParams) { p.IDNMode = "punycode" }, "IDNMode"},
+		"bad format":      {func(p *WorkflowParams) { p.OutputFormat = "csv" }, "OutputFormat"},
+		"bad order":       {func(p *WorkflowParams) { p.SortOrder = "reverse" }, "SortOrder"},
+		"bad merge":       {func(p *WorkflowParams) { p.MergeStrategy = "magic" }, "MergeStrategy"},
+		"shard mode":      {func(p *WorkflowParams) { p.ShardMode = "dynamic" }, "ShardMode"},
+		"auto with count": {func(p *WorkflowParams) { p.ShardMode, p.Shards = ShardsAuto, 8 }, "Shards must be 0"},
+		"negative target": {func(p *WorkflowParams) { p.ShardMode, p.TargetShardBytes = ShardsAuto, -1 }, "TargetShardBytes"},
+		"parallel dedupe": {func(p *WorkflowParams) { p.MaxParallelDedupe = -1 }, "MaxParallelDedupe"},
+		"split bytes":     {func(p *WorkflowParams) { p.SplitShardBytes = -2 }, "SplitShardBytes"},
+		"fan-in 1":        {func(p *WorkflowParams) { p.MergeFanIn = 1 }, "MergeFanIn"},
+		"bad layout":      {func(p *WorkflowParams) { p.OutputLayout.Mode = "dir" }, "OutputLayout.Mode"},
+		"negative part":   {func(p *WorkflowParams) { p.OutputLayout.PartMaxBytes = -1 }, "PartMaxBytes"},
+		"bad compression": {func(p *WorkflowParams) { p.OutputLayout.Compression = "gzip" }, "Compression"},
+		"notify no url":   {func(p *WorkflowParams) { p.Notify = &Notify{} }, "Notify.URL"},
+		"notify s3 url":   {func(p *WorkflowParams) { p.Notify = &Notify{URL: "s3://b/hook"} }, "Notify.URL"},
+		"notify event":    {func(p *WorkflowParams) { p.Notify = &Notify{URL: "https://h/x", Events: []string{"done"}} }, "Notify.Events"},
+	} {
+		p := ok
+		tc.mut(&p)
+		err := p.Validate()
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want error containing %q", name, err, tc.want)
+		}
+	}
+
+	full := ok
+	full.ScratchSubdir = "runs/com..2024"
+	full.Shards, full.Filters, full.IDNMode = MaxShards, []string{"a", "NS", "DS"}, "ulabel"
+	full.OutputFormat, full.SortOrder, full.MergeStrategy, full.MergeFanIn = FormatParquet, OrderCanonical, MergeHierarchical, 2
+	full.MaxParallelDedupe = 8
+	full.OutputLayout = OutputLayout{Mode: LayoutParts, PartMaxBytes: 1 << 20, Compression: "none"}
+	full.Notify = &Notify{URL: "https://hooks.example/zone", Secret: "k", Events: []string{EventSucceeded, "Failed"}}
+	if err := full.Validate(); err != nil {
+		t.Fatalf("full params: %v", err)
+	}
+}
+
+func TestNotifyWants(t *testing.T) {
+	var none *Notify
+	all := &Notify{URL: "http://h/"}
+	failures := &Notify{URL: "http://h/", Events: []string{"FAILED"}}
+	for _, tc := range []struct {
+		n     *Notify
+		event string
+		want  bool
+	}{
+		{none, EventFailed, false},
+		{&Notify{}, EventFailed, false},
+		{all, EventSucceeded, true},
+		{all, EventSkipped, true},
+		{failures, EventFailed, true},
+		{failures, EventSucceeded, false},
+	} {
+		if got := tc.n.Wants(tc.event); got != tc.want {
+			t.Errorf("%+v.Wants(%q) = %v", tc.n, tc.event, got)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	p := WorkflowParams{
+		ZoneURI:       "s3://zones/{{.Date}}/com.zone.gz",
+		OutputURI:     `s3://out/com/{{.Time.Format "2006/01/02"}}/names.txt`,
+		ScratchSubdir: "com-{{.Date}}",
+		Shards:        4,
+	}
+	if !p.Templated() || (WorkflowParams{ZoneURI: "s3://z/a"}).Templated() {
+		t.Fatal("Templated")
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("templated params: %v", err)
+	}
+	r, err := p.Render(time.Date(2024, 5, 1, 23, 30, 0, 0, time.FixedZone("x", -3600)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.ZoneURI != "s3://zones/2024-05-02/com.zone.gz" || r.OutputURI != "s3://out/com/2024/05/02/names.txt" ||
+		r.ScratchSubdir != "com-2024-05-02" || r.Shards != 4 || r.Templated() {
+		t.Fatalf("rendered %+v", r)
+	}
+	// 2024-05-02 00:30 UTC is still May 1st in New York.
+	p.TimeZone = "America/New_York"
+	if r, err := p.Render(time.Date(2024, 5, 2, 0, 30, 0, 0, time.UTC)); err != nil || r.ZoneURI != "s3://zones/2024-05-01/com.zone.gz" {
+		t.Fatalf("rendered in %s: %q, %v", p.TimeZone, r.ZoneURI, err)
+	}
+	p.TimeZone = "Mars/Olympus"
+	if err := p.Validate(); err == nil || !strings.Contains(err.Error(), "TimeZone") {
+		t.Fatalf("bad time zone: %v", err)
+	}
+	p.TimeZone = ""
+
+	for _, bad := range []string{"s3://z/{{.Day}}/a.zone", "s3://z/{{.Date", "{{.Date}}/a.zone"} {
+		p.ZoneURI = bad
+		if err := p.Validate(); err == nil || !strings.Contains(err.Error(), "ZoneURI") {
+			t.Errorf("%q: got %v", bad, err)
+		}
+	}
+}
+
+func TestShardCount(t *testing.T) {
+	auto := WorkflowParams{ZoneURI: "s3://zones/com.zone", ShardMode: ShardsAuto}
+	gz := auto
+	gz.ZoneURI += ".gz"
+	small := auto
+	small.TargetShardBytes = 1 << 20
+	for _, tc := range []struct {
+		p    WorkflowParams
+		size int64
+		want int
+	}{
+		{WorkflowParams{}, 1 << 40, DefaultShards},
+		{WorkflowParams{Shards: 7}, 1 << 40, 7},
+		{auto, 0, DefaultShards}, // size unknown
+		{auto, 2 << 20, 1},
+		{auto, 25 << 30, 100},
+		{gz, 25 << 30, 100 * GzipRatio},
+		{small, 10<<20 + 1, 11},
+		{small, 1 << 40, MaxShards},
+	} {
+		if got := tc.p.ShardCount(tc.size); got != tc.want {
+			t.Errorf("%s %s/%d: ShardCount(%d) = %d, want %d", tc.p.ZoneURI, tc.p.ShardMode, tc.p.TargetShardBytes, tc.size, got, tc.want)
+		}
+	}
+}
+
+func TestShardSplits(t *testing.T) {
+	const mb = 1 << 20
+	r := PartitionResult{ShardBytes: []int64{10 * mb, 10 * mb, 1000 * mb, 10 * mb, 10 * mb, 10 * mb, 10 * mb, 10 * mb, 10 * mb}}
+	// Default threshold: 4x the mean of 120 MB -> ceil(1000/480) = 3 parts.
+	if got := (WorkflowParams{}).ShardSplits(r); len(got) != 1 || got[2] != 3 {
+		t.Fatalf("default: %v", got)
+	}
+	if got := (WorkflowParams{SplitShardBytes: -1}).ShardSplits(r); len(got) != 0 {
+		t.Fatalf("disabled: %v", got)
+	}
+	if got := (WorkflowParams{SplitShardBytes: 5 * mb}).ShardSplits(r); len(got) != len(r.ShardBytes) || got[0] != 2 || got[2] != MaxSplitParts {
+		t.Fatalf("5MB: %v", got)
+	}
+	// Even shards below the minimum default threshold stay as they are.
+	if got := (WorkflowParams{}).ShardSplits(PartitionResult{ShardBytes: []int64{1, 1, 1, 60 * mb}}); len(got) != 0 {
+		t.Fatalf("small: %v", got)
+	}
+}
+
+func TestSameOutputSplit(t *testing.T) {
+	p := WorkflowParams{OutputURI: "s3://o/names.txt", Shards: 8}
+	q := p
+	q.SplitShardBytes = 1 << 20
+	// Splitting doesn't change a globally sorted output...
+	if !p.SameOutput(q) {
+		t.Fatal("single merge: different split threshold reported as different output")
+	}
+	// ...but it does change the order of a concatenation.
+	p.MergeStrategy, q.MergeStrategy = MergeConcat, MergeConcat
+	if p.SameOutput(q) {
+		t.Fatal("concat: different split threshold reported as same output")
+	}
+	q.SplitShardBytes = 0
+	if !p.SameOutput(q) {
+		t.Fatal("concat: same params reported as different output")
+	}
+}
+
+func TestReplaceShards(t *testing.T) {
+	r := PartitionResult{
+		ShardURIs:  []string{"s0", "s1", "s2"},
+		ShardLines: []uint64{1, 10, 2},
+		ShardBytes: []int64{5, 50, 6},
+		Records:    13,
+	}
+	got := r.ReplaceShards(map[int]SplitShardResult{1: {
+		ShardURIs: []string{"s1-00", "s1-01"}, ShardLines: []uint64{4, 6}, ShardBytes: []int64{20, 30},
+	}})
+	if strings.Join(got.ShardURIs, ",") != "s0,s1-00,s1-01,s2" || got.Records != 13 ||
+		fmt.Sprint(got.ShardLines) != "[1 4 6 2]" || fmt.Sprint(got.ShardBytes) != "[5 20 30 6]" {
+		t.Fatalf("got %+v", got)
+	}
+	if len(r.ShardURIs) != 3 {
+		t.Fatalf("receiver modified: %+v", r)
+	}
+}
+
+func TestZoneLabel(t *testing.T) {
+	for uri, want := range map[string]string{
+		"s3://zones/2024-05-02/com.zone.gz": "com",
+		"file:///data/Example.zone":         "example",
+		"file:///data/xn--p1ai.txt":         "xn--p1ai",
+		"root.zone":                         "root",
+		"s3://zones/":                       "other",
+		"file:///data/zone file.txt":        "other",
+		"s3://zones/com-20241018.zone.gz":   "other",
+		"file:///data/2024-05-02.zone":      "other",
+		"file:///data/zone_v2.txt":          "other",
+		"file:///data/xn--.zone":            "other",
+	} {
+		if got := (WorkflowParams{ZoneURI: uri}).ZoneLabel(); got != want {
+			t.Errorf("ZoneLabel(%q) = %q, want %q", uri, got, want)
+		}
+	}
+	p := WorkflowParams{ZoneURI: "s3://zones/com-20241018.zone.gz", MetricsZone: "COM"}
+	if got := p.ZoneLabel(); got != "com" {
+		t.Errorf("ZoneLabel with MetricsZone = %q, want com", got)
+	}
+}
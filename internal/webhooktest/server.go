@@ -0,0 +1,90 @@
+// Package webhooktest runs an in-process stand-in for a Notify webhook
+// receiver. It records every delivery, checks its HMAC signature and can be
+// told to fail the next few requests to exercise retries.
+package webhooktest
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// Delivery is one request received by the server.
+type Delivery struct {
+	Header       http.Header
+	Body         []byte
+	Notification types.Notification // Body decoded; zero if it wasn't valid JSON
+	// SignatureOK reports whether the SignatureHeader matched the body under
+	// the server's secret. Always false when the server has no secret.
+	SignatureOK bool
+	Status      int // status the server answered with
+}
+
+// Server is a running webhook receiver.
+type Server struct {
+	URL string
+
+	secret string
+
+	mu         sync.Mutex
+	deliveries []Delivery
+	failNext   int
+	failStatus int
+}
+
+// NewServer starts a receiver that verifies signatures with secret (which may
+// be empty) and stops it when the test ends.
+func NewServer(t testing.TB, secret string) *Server {
+	t.Helper()
+	s := &Server{secret: secret}
+	srv := httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = srv.URL
+	t.Cleanup(srv.Close)
+	return s
+}
+
+// FailNext makes the next n requests fail with status.
+func (s *Server) FailNext(n, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failNext, s.failStatus = n, status
+}
+
+// Deliveries returns the requests received so far, failed ones included.
+func (s *Server) Deliveries() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Delivery(nil), s.deliveries...)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	d := Delivery{Header: r.Header.Clone(), Body: body, Status: http.StatusNoContent}
+	_ = json.Unmarshal(body, &d.Notification)
+	if s.secret != "" {
+		mac := hmac.New(sha256.New, []byte(s.secret))
+		mac.Write(body)
+		want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		d.SignatureOK = hmac.Equal([]byte(r.Header.Get(types.SignatureHeader)), []byte(want))
+	}
+	if r.Method != http.MethodPost {
+		d.Status = http.StatusMethodNotAllowed
+	}
+
+	s.mu.Lock()
+	if s.failNext > 0 {
+		s.failNext--
+		d.Status = s.failStatus
+	}
+	s.deliveries = append(s.deliveries, d)
+	s.mu.Unlock()
+	w.WriteHeader(d.Status)
+}
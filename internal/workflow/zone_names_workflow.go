@@ -1,7 +1,9 @@
 package workflow
 
 import (
+	"fmt"
 	"path"
+	"slices"
 	"strings"
 	"time"
 
@@ -11,10 +13,27 @@ import (
 	"github.com/yourorg/zone-names/internal/types"
 )
 
+// scheduledStartTime is set by the server on runs started by a Temporal
+// Schedule, backfills included, to the time the run was scheduled for.
+var scheduledStartTime = temporal.NewSearchAttributeKeyTime("TemporalScheduledStartTime")
+
+// Change IDs for workflow.GetVersion. Runs started before a change replay at
+// DefaultVersion and keep the activity sequence they were started with.
+// Steps driven only by parameters older runs can't carry (Notify,
+// MaxParallelDedupe, MergeStrategy) need no version.
+const (
+	changeCheckUnchanged = "check-unchanged"
+	changeDedupeQueue    = "dedupe-task-queue"
+	changeSplitShards    = "split-shards"
+)
+
 func Zone2NamesWorkflow(ctx workflow.Context, p types.WorkflowParams) (types.MergeStats, error) {
 	ao := workflow.ActivityOptions{
 		StartToCloseTimeout: 4 * time.Hour,
 		HeartbeatTimeout:    1 * time.Minute,
+		// On cancellation, wait for running activities to stop before
+		// cleaning up the scratch files they are writing.
+		WaitForCancellation: true,
 		RetryPolicy: &temporal.RetryPolicy{
 			InitialInterval:    5 * time.Second,
 			BackoffCoefficient: 2.0,
@@ -30,70 +49,332 @@ func Zone2NamesWorkflow(ctx workflow.Context, p types.WorkflowParams) (types.Mer
 	mergeAO := ao
 	mergeAO.HeartbeatTimeout = 5 * time.Minute
 	mergeCtx := workflow.WithActivityOptions(ctx, mergeAO)
+	// Webhook deliveries are short and retried for longer, with backoff, so a
+	// receiver outage of a few minutes doesn't lose the notification.
+	notifyAO := workflow.ActivityOptions{
+		StartToCloseTimeout: 1 * time.Minute,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval:    5 * time.Second,
+			BackoffCoefficient: 2.0,
+			MaximumInterval:    5 * time.Minute,
+			MaximumAttempts:    10,
+		},
+	}
+
+	// Expand {{.Date}} etc. for the schedule time, so a delayed or backfilled
+	// run still processes its own day; unscheduled runs use their start time.
+	if p.Templated() {
+		t, ok := workflow.GetTypedSearchAttributes(ctx).GetTime(scheduledStartTime)
+		if !ok {
+			t = workflow.Now(ctx)
+		}
+		var err error
+		if p, err = p.Render(t); err != nil {
+			return types.MergeStats{}, invalidParams(err)
+		}
+	}
 
 	// Default scratch subdir to the workflow ID if not provided.
 	if p.ScratchSubdir == "" {
 		p.ScratchSubdir = workflow.GetInfo(ctx).WorkflowExecution.ID
 	}
+	// Fail before any activity runs: a bad parameter would otherwise only
+	// surface, and be retried, deep inside one.
+	if err := p.Validate(); err != nil {
+		return types.MergeStats{}, invalidParams(err)
+	}
+
+	// build out paths
+	outNames := p.OutputURI
+	manURI := ManifestPath(outNames)
+
+	progress := types.Progress{Phase: types.PhaseStarting}
+	if err := workflow.SetQueryHandler(ctx, types.QueryProgress, func() (types.Progress, error) {
+		return progress, nil
+	}); err != nil {
+		return types.MergeStats{}, err
+	}
+	// notify posts the completion webhook if p.Notify asks for event. A
+	// delivery that still fails after retries is logged, not returned: the
+	// run's outcome doesn't depend on the receiver.
+	notify := func(ctx workflow.Context, event string, runErr error) {
+		if !p.Notify.Wants(event) {
+			return
+		}
+		progress.Phase = types.PhaseNotifying
+		exec := workflow.GetInfo(ctx).WorkflowExecution
+		np := types.NotifyParams{
+			Notify:      *p.Notify,
+			Event:       event,
+			WorkflowID:  exec.ID,
+			RunID:       exec.RunID,
+			ZoneURI:     p.ZoneURI,
+			OutputURI:   outNames,
+			ManifestURI: manURI,
+		}
+		if runErr != nil {
+			np.Error = runErr.Error()
+		}
+		if err := workflow.ExecuteActivity(workflow.WithActivityOptions(ctx, notifyAO), "Activities.Notify", np).Get(ctx, nil); err != nil {
+			workflow.GetLogger(ctx).Warn("webhook notification failed", "event", event, "error", err)
+		}
+	}
+	// fail cleans up and notifies, then returns err. A cancelled run does
+	// both on a disconnected context, since activities can't be started on
+	// the cancelled one; returning the CanceledError marks the run cancelled.
+	fail := func(err error) (types.MergeStats, error) {
+		ctx := ctx
+		cancelled := ctx.Err() != nil
+		if cancelled {
+			ctx, _ = workflow.NewDisconnectedContext(ctx)
+		}
+		progress.Phase = types.PhaseCleanup
+		_ = workflow.ExecuteActivity(ctx, "Activities.CleanupScratch", types.CleanupParams{ScratchSubdir: p.ScratchSubdir}).Get(ctx, nil)
+		notify(ctx, types.EventFailed, err)
+		progress.Phase = types.PhaseFailed
+		if cancelled {
+			progress.Phase = types.PhaseCanceled
+		}
+		return types.MergeStats{}, err
+	}
+
+	// Skip the whole pipeline when the previous run at this location already
+	// processed the same input with the same parameters.
+	if !p.Force && workflow.GetVersion(ctx, changeCheckUnchanged, workflow.DefaultVersion, 1) >= 1 {
+		progress.Phase = types.PhaseChecking
+		var prev types.UnchangedResult
+		up := types.UnchangedParams{ZoneURI: p.ZoneURI, ManifestURI: manURI, Params: p}
+		err := workflow.ExecuteActivity(ctx, "Activities.CheckUnchanged", up).Get(ctx, &prev)
+		switch {
+		case err != nil:
+			// Not fatal: fall through and do the work.
+			workflow.GetLogger(ctx).Warn("unchanged check failed; running full pipeline", "error", err)
+		case prev.Unchanged:
+			workflow.GetLogger(ctx).Info("input unchanged since previous run; skipping", "manifest", manURI)
+			progress.Unique = prev.Previous.Emitted
+			notify(ctx, types.EventSkipped, nil)
+			progress.Phase = types.PhaseSkipped
+			return prev.Previous, nil
+		default:
+			workflow.GetLogger(ctx).Info("input changed; running full pipeline", "reason", prev.Reason)
+		}
+	}
 
+	progress.Phase = types.PhasePartitioning
 	var part types.PartitionResult
 	if err := workflow.ExecuteActivity(ctx, "Activities.StreamPartition", p).Get(ctx, &part); err != nil {
 		// On failure, try to clean up temp files for this workflow
-		_ = workflow.ExecuteActivity(ctx, "Activities.CleanupScratch", types.CleanupParams{ScratchSubdir: p.ScratchSubdir}).Get(ctx, nil)
-		return types.MergeStats{}, err
+		return fail(err)
 	}
+	progress.Shards, progress.Records = len(part.ShardURIs), part.Records
+	partShards := len(part.ShardURIs)
 
-	// fan-out dedupe
-	stats := make([]types.ShardStats, len(part.ShardURIs))
-	futures := make([]workflow.Future, len(part.ShardURIs))
-	for i, shard := range part.ShardURIs {
-		out := shard + ".sorted"
-		dp := types.ShardDedupeParams{ShardURI: shard, OutputURI: out}
-		futures[i] = workflow.ExecuteActivity(dedupeCtx, "Activities.ShardDedupeBadger", dp)
+	// Re-hash shards far above the rest into sub-shards, so a skewed shard
+	// doesn't dominate dedupe time and scratch space.
+	// Runs started before splitting existed go straight to dedupe.
+	splits := p.ShardSplits(part)
+	if len(splits) > 0 && workflow.GetVersion(ctx, changeSplitShards, workflow.DefaultVersion, 1) == workflow.DefaultVersion {
+		splits = nil
 	}
-	for i := range futures {
-		if err := futures[i].Get(ctx, &stats[i]); err != nil {
-			// Cleanup on dedupe failure
-			_ = workflow.ExecuteActivity(ctx, "Activities.CleanupScratch", types.CleanupParams{ScratchSubdir: p.ScratchSubdir}).Get(ctx, nil)
-			return types.MergeStats{}, err
+	if len(splits) > 0 {
+		workflow.GetLogger(ctx).Info("splitting skewed shards", "shards", len(splits))
+		var err error
+		if part, err = splitShards(ctx, p, part, splits); err != nil {
+			return fail(err)
 		}
+		progress.Shards = len(part.ShardURIs)
 	}
 
-	// build out paths
-	outNames := p.OutputURI
-	manURI := manifestPath(outNames)
+	// fan-out dedupe; results are collected in completion order so the
+	// progress count is accurate
+	progress.Phase = types.PhaseDeduping
+	if workflow.GetVersion(ctx, changeDedupeQueue, workflow.DefaultVersion, 1) >= 1 {
+		dedupeCtx = workflow.WithTaskQueue(dedupeCtx, DedupeTaskQueue(workflow.GetInfo(ctx).TaskQueueName))
+	}
+	dedupeTiming := types.PhaseTiming{StartedAt: workflow.Now(ctx).UTC()}
+	stats := make([]types.ShardStats, len(part.ShardURIs))
+	sel := workflow.NewSelector(ctx)
+	var dedupeErr error
+	next, running := 0, 0
+	startDedupe := func() {
+		i, shard := next, part.ShardURIs[next]
+		next++
+		running++
+		dp := types.ShardDedupeParams{ShardURI: shard, OutputURI: shard + ".sorted", WithTypes: p.WantsRRTypes(), SortOrder: p.Order(), Zone: p.ZoneLabel()}
+		sel.AddFuture(workflow.ExecuteActivity(dedupeCtx, "Activities.ShardDedupeBadger", dp), func(f workflow.Future) {
+			running--
+			if err := f.Get(ctx, &stats[i]); err != nil {
+				dedupeErr = err
+				return
+			}
+			progress.ShardsDeduped++
+		})
+	}
+	// Sliding window: at most MaxParallelDedupe scheduled at once, the next
+	// shard starting whenever one finishes.
+	window := len(part.ShardURIs)
+	if p.MaxParallelDedupe > 0 {
+		window = min(window, p.MaxParallelDedupe)
+	}
+	for next < window {
+		startDedupe()
+	}
+	for running > 0 {
+		sel.Select(ctx)
+		// Cleanup on dedupe failure; when cancelled, only once every
+		// running dedupe has stopped.
+		if dedupeErr != nil && ctx.Err() == nil {
+			return fail(dedupeErr)
+		}
+		if dedupeErr == nil && ctx.Err() == nil && next < len(part.ShardURIs) {
+			startDedupe()
+		}
+	}
+	if dedupeErr != nil {
+		return fail(dedupeErr)
+	}
+	if ctx.Err() != nil {
+		return fail(temporal.NewCanceledError())
+	}
+	dedupeTiming.FinishedAt = workflow.Now(ctx).UTC()
 
 	mp := types.MergeParams{
 		SortedShardURIs: make([]string, len(part.ShardURIs)),
 		OutURI:          outNames,
 		ManifestURI:     manURI,
 		Params:          p,
+		Shards:          partShards,
+		SplitShards:     len(splits),
 		ShardStats:      stats,
 		TotalSeen:       part.Records,
+		Input:           types.FileInfo{URI: p.ZoneURI, Bytes: part.SizeBytes, SHA256: part.InputHash, ETag: part.InputETag, Includes: part.Includes},
+		Phases:          types.PhaseTimings{Partition: part.Timing, Dedupe: dedupeTiming},
 	}
 	for i, shard := range part.ShardURIs {
 		mp.SortedShardURIs[i] = shard + ".sorted"
 	}
 
+	progress.Phase = types.PhaseMerging
+	if p.Merge() == types.MergeHierarchical {
+		reduced, err := reduceSorted(mergeCtx, mp.SortedShardURIs, p)
+		if err != nil {
+			return fail(err)
+		}
+		mp.SortedShardURIs = reduced
+	}
+
 	var ms types.MergeStats
 	if err := workflow.ExecuteActivity(mergeCtx, "Activities.MergeSortedAndWriteManifest", mp).Get(ctx, &ms); err != nil {
 		// Cleanup on merge failure
-		_ = workflow.ExecuteActivity(ctx, "Activities.CleanupScratch", types.CleanupParams{ScratchSubdir: p.ScratchSubdir}).Get(ctx, nil)
-		return types.MergeStats{}, err
+		return fail(err)
 	}
+	progress.Unique = ms.Emitted
 
 	// Success path: optionally cleanup unless user asked to keep scratch
 	if !p.KeepScratch {
+		progress.Phase = types.PhaseCleanup
 		_ = workflow.ExecuteActivity(ctx, "Activities.CleanupScratch", types.CleanupParams{ScratchSubdir: p.ScratchSubdir}).Get(ctx, nil)
 	}
+	notify(ctx, types.EventSucceeded, nil)
+	progress.Phase = types.PhaseDone
 	return ms, nil
 }
 
-func manifestPath(out string) string {
-	// replace "names.txt" with "manifest.json" if present; otherwise append ".manifest.json"
-	if strings.HasSuffix(strings.ToLower(out), "names.txt") {
-		return out[:len(out)-len("names.txt")] + "manifest.json"
+// splitShards runs SplitShard for each shard in splits (index to part count)
+// in parallel and returns part with those shards replaced by their sub-shards.
+func splitShards(ctx workflow.Context, p types.WorkflowParams, part types.PartitionResult, splits map[int]int) (types.PartitionResult, error) {
+	idx := make([]int, 0, len(splits))
+	for i := range splits {
+		idx = append(idx, i)
+	}
+	slices.Sort(idx) // map order isn't deterministic; the schedule must be
+	futures := make([]workflow.Future, len(idx))
+	for k, i := range idx {
+		sp := types.SplitShardParams{ShardURI: part.ShardURIs[i], Parts: splits[i], Zone: p.ZoneLabel()}
+		futures[k] = workflow.ExecuteActivity(ctx, "Activities.SplitShard", sp)
+	}
+	subs := make(map[int]types.SplitShardResult, len(idx))
+	var splitErr error
+	for k, f := range futures {
+		var res types.SplitShardResult
+		if err := f.Get(ctx, &res); err != nil {
+			if splitErr == nil {
+				splitErr = err
+			}
+			if ctx.Err() == nil {
+				return part, splitErr
+			}
+			continue
+		}
+		subs[idx[k]] = res
+	}
+	if splitErr != nil {
+		return part, splitErr
+	}
+	return part.ReplaceShards(subs), nil
+}
+
+// reduceSorted merges groups of at most MergeFanIn sorted shards in parallel
+// activities, level by level, until few enough files remain for the final
+// merge to open at once. Intermediates are written next to the shards in scratch.
+func reduceSorted(ctx workflow.Context, uris []string, p types.WorkflowParams) ([]string, error) {
+	fanIn := p.MergeFanIn
+	if fanIn <= 1 {
+		fanIn = types.DefaultMergeFanIn
+	}
+	for level := 0; len(uris) > fanIn; level++ {
+		var next []string
+		var futures []workflow.Future
+		for start := 0; start < len(uris); start += fanIn {
+			group := uris[start:min(start+fanIn, len(uris))]
+			dir := group[0][:strings.LastIndex(group[0], "/")+1]
+			out := fmt.Sprintf("%smerge-%d-%03d.sorted", dir, level, len(next))
+			mp := types.MergeShardsParams{ShardURIs: group, OutputURI: out, SortOrder: p.Order(), Zone: p.ZoneLabel()}
+			futures = append(futures, workflow.ExecuteActivity(ctx, "Activities.MergeShards", mp))
+			next = append(next, out)
+		}
+		// As for dedupe, a cancelled run waits for every merge to stop.
+		var mergeErr error
+		for _, f := range futures {
+			if err := f.Get(ctx, nil); err != nil && mergeErr == nil {
+				mergeErr = err
+			}
+			if mergeErr != nil && ctx.Err() == nil {
+				return nil, mergeErr
+			}
+		}
+		if mergeErr != nil {
+			return nil, mergeErr
+		}
+		uris = next
+	}
+	return uris, nil
+}
+
+// ManifestPath returns the manifest location for an output URI.
+func ManifestPath(out string) string {
+	// replace "names.txt" (or "names.parquet") with "manifest.json" if present;
+	// otherwise append ".manifest.json" to the name without its extension
+	lower := strings.ToLower(out)
+	for _, base := range []string{"names.txt", "names.parquet"} {
+		if strings.HasSuffix(lower, base) {
+			return out[:len(out)-len(base)] + "manifest.json"
+		}
 	}
 	dir, file := path.Split(out)
-	return dir + strings.TrimSuffix(file, ".txt") + ".manifest.json"
+	file = strings.TrimSuffix(strings.TrimSuffix(file, ".txt"), ".parquet")
+	return dir + file + ".manifest.json"
+}
+
+// invalidParams fails the run with a non-retryable error of type
+// types.ErrTypeInvalidParams.
+func invalidParams(err error) error {
+	return temporal.NewNonRetryableApplicationError("invalid parameters: "+err.Error(), types.ErrTypeInvalidParams, err)
+}
+
+// DedupeTaskQueue is the task queue the dedupe activities of workflows on
+// taskQueue are scheduled on. cmd/worker polls it with a separate worker, so
+// how many dedupes (and Badger DBs) run at once can be limited on its own.
+func DedupeTaskQueue(taskQueue string) string {
+	return taskQueue + "-dedupe"
 }
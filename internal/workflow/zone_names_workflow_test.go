@@ -0,0 +1,744 @@
+package workflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.temporal.io/sdk/activity"
+	"go.temporal.io/sdk/contrib/opentelemetry"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/worker"
+	"go.temporal.io/sdk/workflow"
+
+	"github.com/yourorg/zone-names/internal/activities"
+	"github.com/yourorg/zone-names/internal/tracing"
+	"github.com/yourorg/zone-names/internal/types"
+)
+
+// testWorkflowID is the workflow ID the SDK test environment assigns.
+const testWorkflowID = "default-test-workflow-id"
+
+func newEnv(t *testing.T) *testsuite.TestWorkflowEnvironment {
+	var s testsuite.WorkflowTestSuite
+	env := s.NewTestWorkflowEnvironment()
+	// Register the real activities so they can be mocked by name.
+	activities.New(activities.Config{ScratchDir: t.TempDir()}).Register(env)
+	return env
+}
+
+func baseParams() types.WorkflowParams {
+	return types.WorkflowParams{
+		ZoneURI:   "s3://zones/example.zone.gz",
+		OutputURI: "s3://out/example/names.txt",
+		Shards:    2,
+	}
+}
+
+var partResult = types.PartitionResult{
+	ShardURIs: []string{"file:///scratch/w/shard-00.txt", "file:///scratch/w/shard-01.txt"},
+	Records:   10,
+	SizeBytes: 123,
+	InputHash: "abc",
+}
+
+// errPermanent fails an activity without retries so failure-path tests stay fast.
+var errPermanent = temporal.NewNonRetryableApplicationError("boom", "test", errors.New("boom"))
+
+func mockChanged(env *testsuite.TestWorkflowEnvironment) {
+	env.OnActivity("Activities.CheckUnchanged", mock.Anything, mock.Anything).
+		Return(types.UnchangedResult{Reason: "no previous manifest"}, nil)
+}
+
+func TestWorkflowHappyPath(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).
+		Return(types.ShardStats{Total: 5, Unique: 4}, nil).Times(2)
+	var got types.MergeParams
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { got = args.Get(1).(types.MergeParams) }).
+		Return(types.MergeStats{Emitted: 8}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, types.CleanupParams{ScratchSubdir: testWorkflowID}).
+		Return(nil).Once()
+
+	env.ExecuteWorkflow(Zone2NamesWorkflow, baseParams())
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	var res types.MergeStats
+	if err := env.GetWorkflowResult(&res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Emitted != 8 || res.Skipped {
+		t.Fatalf("result %+v", res)
+	}
+	env.AssertExpectations(t)
+
+	if got.ManifestURI != "s3://out/example/manifest.json" {
+		t.Fatalf("manifest uri %q", got.ManifestURI)
+	}
+	if len(got.SortedShardURIs) != 2 || got.SortedShardURIs[1] != "file:///scratch/w/shard-01.txt.sorted" {
+		t.Fatalf("sorted shards %q", got.SortedShardURIs)
+	}
+	if got.TotalSeen != 10 || len(got.ShardStats) != 2 || got.ShardStats[0].Unique != 4 {
+		t.Fatalf("merge params %+v", got)
+	}
+	if got.Input.SHA256 != "abc" || got.Input.Bytes != 123 || got.Input.URI != baseParams().ZoneURI {
+		t.Fatalf("input %+v", got.Input)
+	}
+	// The default scratch subdir is threaded through to the activities.
+	if got.Params.ScratchSubdir != testWorkflowID {
+		t.Fatalf("scratch subdir %q", got.Params.ScratchSubdir)
+	}
+}
+
+func TestWorkflowExplicitScratchSubdir(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	var partParams types.WorkflowParams
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { partParams = args.Get(1).(types.WorkflowParams) }).
+		Return(partResult, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil)
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, types.CleanupParams{ScratchSubdir: "mine"}).Return(nil).Once()
+
+	p := baseParams()
+	p.ScratchSubdir = "mine"
+	env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	if partParams.ScratchSubdir != "mine" {
+		t.Fatalf("scratch subdir %q", partParams.ScratchSubdir)
+	}
+	env.AssertExpectations(t)
+}
+
+func TestWorkflowKeepScratch(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil)
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	p := baseParams()
+	p.KeepScratch = true
+	env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	env.AssertActivityNumberOfCalls(t, "Activities.CleanupScratch", 0)
+}
+
+func TestWorkflowFailuresCleanUp(t *testing.T) {
+	cases := []struct {
+		name  string
+		setup func(env *testsuite.TestWorkflowEnvironment)
+	}{
+		{"partition", func(env *testsuite.TestWorkflowEnvironment) {
+			env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(types.PartitionResult{}, errPermanent)
+		}},
+		{"dedupe", func(env *testsuite.TestWorkflowEnvironment) {
+			env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+			env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, errPermanent)
+		}},
+		{"merge", func(env *testsuite.TestWorkflowEnvironment) {
+			env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+			env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil)
+			env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{}, errPermanent)
+		}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newEnv(t)
+			mockChanged(env)
+			tc.setup(env)
+			// Cleanup runs on failure even when KeepScratch is set.
+			env.OnActivity("Activities.CleanupScratch", mock.Anything, types.CleanupParams{ScratchSubdir: testWorkflowID}).
+				Return(nil).Once()
+
+			p := baseParams()
+			p.KeepScratch = true
+			env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+			if err := env.GetWorkflowError(); err == nil {
+				t.Fatal("want workflow error")
+			}
+			env.AssertExpectations(t)
+		})
+	}
+}
+
+func TestWorkflowSkipsUnchangedInput(t *testing.T) {
+	env := newEnv(t)
+	env.OnActivity("Activities.CheckUnchanged", mock.Anything, mock.Anything).
+		Return(types.UnchangedResult{Unchanged: true, Previous: types.MergeStats{Emitted: 42, Skipped: true}}, nil)
+
+	env.ExecuteWorkflow(Zone2NamesWorkflow, baseParams())
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	var res types.MergeStats
+	_ = env.GetWorkflowResult(&res)
+	if res.Emitted != 42 || !res.Skipped {
+		t.Fatalf("result %+v", res)
+	}
+	env.AssertActivityNumberOfCalls(t, "Activities.StreamPartition", 0)
+}
+
+// TestWorkflowUnchangedCheckFailure checks that a failed unchanged check
+// doesn't fail the run: the full pipeline runs instead.
+func TestWorkflowUnchangedCheckFailure(t *testing.T) {
+	env := newEnv(t)
+	env.OnActivity("Activities.CheckUnchanged", mock.Anything, mock.Anything).Return(types.UnchangedResult{}, errPermanent)
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil)
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{Emitted: 7}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	env.ExecuteWorkflow(Zone2NamesWorkflow, baseParams())
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	var res types.MergeStats
+	_ = env.GetWorkflowResult(&res)
+	if res.Emitted != 7 || res.Skipped {
+		t.Fatalf("result %+v", res)
+	}
+	env.AssertActivityNumberOfCalls(t, "Activities.MergeSortedAndWriteManifest", 1)
+}
+
+func TestWorkflowForceSkipsUnchangedCheck(t *testing.T) {
+	env := newEnv(t)
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil)
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{Emitted: 1}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	p := baseParams()
+	p.Force = true
+	env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	env.AssertActivityNumberOfCalls(t, "Activities.CheckUnchanged", 0)
+}
+
+func TestWorkflowHierarchicalMerge(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	shards := make([]string, 7)
+	for i := range shards {
+		shards[i] = "file:///scratch/w/shard-0" + string(rune('0'+i)) + ".txt"
+	}
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).
+		Return(types.PartitionResult{ShardURIs: shards}, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil)
+	// 7 shards with fan-in 3: level 0 -> 3 files, which the final merge opens directly.
+	env.OnActivity("Activities.MergeShards", mock.Anything, mock.Anything).Return(types.MergeStats{}, nil).Times(3)
+	var got types.MergeParams
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { got = args.Get(1).(types.MergeParams) }).
+		Return(types.MergeStats{}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	p := baseParams()
+	p.MergeStrategy = types.MergeHierarchical
+	p.MergeFanIn = 3
+	env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	env.AssertExpectations(t)
+	want := []string{
+		"file:///scratch/w/merge-0-000.sorted",
+		"file:///scratch/w/merge-0-001.sorted",
+		"file:///scratch/w/merge-0-002.sorted",
+	}
+	if len(got.SortedShardURIs) != len(want) {
+		t.Fatalf("final merge inputs %q", got.SortedShardURIs)
+	}
+	for i := range want {
+		if got.SortedShardURIs[i] != want[i] {
+			t.Fatalf("final merge inputs %q", got.SortedShardURIs)
+		}
+	}
+}
+
+// TestWorkflowConcatSkipsReduce checks that the concat strategy hands the
+// shards to the final merge in order, without a MergeShards level.
+func TestWorkflowConcatSkipsReduce(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	shards := make([]string, 7)
+	for i := range shards {
+		shards[i] = "file:///scratch/w/shard-0" + string(rune('0'+i)) + ".txt"
+	}
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).
+		Return(types.PartitionResult{ShardURIs: shards}, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil)
+	env.OnActivity("Activities.MergeShards", mock.Anything, mock.Anything).Return(types.MergeStats{}, nil)
+	var got types.MergeParams
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { got = args.Get(1).(types.MergeParams) }).
+		Return(types.MergeStats{}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	p := baseParams()
+	p.MergeStrategy = types.MergeConcat
+	p.MergeFanIn = 3
+	env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	env.AssertActivityNumberOfCalls(t, "Activities.MergeShards", 0)
+	if len(got.SortedShardURIs) != len(shards) {
+		t.Fatalf("final merge inputs %q", got.SortedShardURIs)
+	}
+	for i := range shards {
+		if got.SortedShardURIs[i] != shards[i]+".sorted" {
+			t.Fatalf("final merge inputs %q", got.SortedShardURIs)
+		}
+	}
+}
+
+func TestManifestPath(t *testing.T) {
+	cases := map[string]string{
+		"s3://b/com/names.txt":       "s3://b/com/manifest.json",
+		"s3://b/com/NAMES.TXT":       "s3://b/com/manifest.json",
+		"s3://b/com.names.txt":       "s3://b/com.manifest.json",
+		"s3://b/com/names.parquet":   "s3://b/com/manifest.json",
+		"s3://b/com/output.txt":      "s3://b/com/output.manifest.json",
+		"s3://b/com/output":          "s3://b/com/output.manifest.json",
+		"file:///tmp/out/list.txt":   "file:///tmp/out/list.manifest.json",
+		"file:///tmp/out/x.parquet":  "file:///tmp/out/x.manifest.json",
+		"names.txt":                  "manifest.json",
+		"relative/dir/whatever.data": "relative/dir/whatever.data.manifest.json",
+	}
+	for in, want := range cases {
+		if got := ManifestPath(in); got != want {
+			t.Errorf("ManifestPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWorkflowProgressQuery(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).
+		After(time.Hour).Return(types.ShardStats{Total: 5, Unique: 4}, nil)
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{Emitted: 8}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	query := func() types.Progress {
+		t.Helper()
+		v, err := env.QueryWorkflow(types.QueryProgress)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var p types.Progress
+		if err := v.Get(&p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	var during types.Progress
+	env.RegisterDelayedCallback(func() { during = query() }, 30*time.Minute)
+	env.ExecuteWorkflow(Zone2NamesWorkflow, baseParams())
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	if want := (types.Progress{Phase: types.PhaseDeduping, Shards: 2, Records: 10}); during != want {
+		t.Fatalf("during dedupe: %+v, want %+v", during, want)
+	}
+	if want := (types.Progress{Phase: types.PhaseDone, Shards: 2, ShardsDeduped: 2, Records: 10, Unique: 8}); query() != want {
+		t.Fatalf("after: %+v, want %+v", query(), want)
+	}
+}
+
+func TestWorkflowNotify(t *testing.T) {
+	hook := &types.Notify{URL: "https://hooks.example/zone", Secret: "k"}
+	run := func(t *testing.T, n *types.Notify, setup func(env *testsuite.TestWorkflowEnvironment)) (*testsuite.TestWorkflowEnvironment, []types.NotifyParams) {
+		env := newEnv(t)
+		setup(env)
+		env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+		var sent []types.NotifyParams
+		env.OnActivity("Activities.Notify", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { sent = append(sent, args.Get(1).(types.NotifyParams)) }).Return(nil)
+		p := baseParams()
+		p.Notify = n
+		env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+		return env, sent
+	}
+	succeed := func(env *testsuite.TestWorkflowEnvironment) {
+		mockChanged(env)
+		env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+		env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil)
+		env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{Emitted: 3}, nil)
+	}
+
+	t.Run("succeeded", func(t *testing.T) {
+		env, sent := run(t, hook, succeed)
+		if err := env.GetWorkflowError(); err != nil {
+			t.Fatal(err)
+		}
+		want := types.NotifyParams{
+			Notify:      *hook,
+			Event:       types.EventSucceeded,
+			WorkflowID:  testWorkflowID,
+			ZoneURI:     baseParams().ZoneURI,
+			OutputURI:   baseParams().OutputURI,
+			ManifestURI: "s3://out/example/manifest.json",
+		}
+		if len(sent) != 1 || sent[0].RunID == "" {
+			t.Fatalf("sent %+v", sent)
+		}
+		sent[0].RunID = ""
+		if !reflect.DeepEqual(sent[0], want) {
+			t.Fatalf("sent %+v, want %+v", sent[0], want)
+		}
+	})
+	t.Run("failed", func(t *testing.T) {
+		env, sent := run(t, hook, func(env *testsuite.TestWorkflowEnvironment) {
+			mockChanged(env)
+			env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(types.PartitionResult{}, errPermanent)
+		})
+		if err := env.GetWorkflowError(); err == nil {
+			t.Fatal("want workflow error")
+		}
+		if len(sent) != 1 || sent[0].Event != types.EventFailed || !strings.Contains(sent[0].Error, "boom") {
+			t.Fatalf("sent %+v", sent)
+		}
+	})
+	t.Run("skipped", func(t *testing.T) {
+		_, sent := run(t, hook, func(env *testsuite.TestWorkflowEnvironment) {
+			env.OnActivity("Activities.CheckUnchanged", mock.Anything, mock.Anything).
+				Return(types.UnchangedResult{Unchanged: true, Previous: types.MergeStats{Emitted: 3, Skipped: true}}, nil)
+		})
+		if len(sent) != 1 || sent[0].Event != types.EventSkipped {
+			t.Fatalf("sent %+v", sent)
+		}
+	})
+	t.Run("event filter", func(t *testing.T) {
+		_, sent := run(t, &types.Notify{URL: hook.URL, Events: []string{types.EventFailed}}, succeed)
+		if len(sent) != 0 {
+			t.Fatalf("sent %+v", sent)
+		}
+	})
+	t.Run("delivery failure", func(t *testing.T) {
+		env := newEnv(t)
+		succeed(env)
+		env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+		env.OnActivity("Activities.Notify", mock.Anything, mock.Anything).Return(errPermanent)
+		p := baseParams()
+		p.Notify = hook
+		env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+		// The run still succeeds.
+		if err := env.GetWorkflowError(); err != nil {
+			t.Fatal(err)
+		}
+		env.AssertActivityNumberOfCalls(t, "Activities.Notify", 1)
+	})
+}
+
+func TestWorkflowRendersTemplates(t *testing.T) {
+	run := func(t *testing.T, scheduled time.Time) types.WorkflowParams {
+		env := newEnv(t)
+		env.SetStartTime(time.Date(2024, 5, 3, 6, 0, 0, 0, time.UTC))
+		if !scheduled.IsZero() {
+			if err := env.SetTypedSearchAttributesOnStart(temporal.NewSearchAttributes(scheduledStartTime.ValueSet(scheduled))); err != nil {
+				t.Fatal(err)
+			}
+		}
+		var got types.WorkflowParams
+		env.OnActivity("Activities.CheckUnchanged", mock.Anything, mock.Anything).
+			Run(func(args mock.Arguments) { got = args.Get(1).(types.UnchangedParams).Params }).
+			Return(types.UnchangedResult{Unchanged: true}, nil)
+		p := baseParams()
+		p.ZoneURI = "s3://zones/{{.Date}}/example.zone.gz"
+		p.OutputURI = `s3://out/{{.Time.Format "20060102"}}/names.txt`
+		env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+		if err := env.GetWorkflowError(); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	t.Run("start time", func(t *testing.T) {
+		if got := run(t, time.Time{}); got.ZoneURI != "s3://zones/2024-05-03/example.zone.gz" || got.OutputURI != "s3://out/20240503/names.txt" {
+			t.Fatalf("params %+v", got)
+		}
+	})
+	t.Run("schedule time", func(t *testing.T) {
+		if got := run(t, time.Date(2024, 4, 30, 6, 0, 0, 0, time.UTC)); got.ZoneURI != "s3://zones/2024-04-30/example.zone.gz" {
+			t.Fatalf("params %+v", got)
+		}
+	})
+}
+
+func TestWorkflowRejectsInvalidParams(t *testing.T) {
+	for name, mut := range map[string]func(*types.WorkflowParams){
+		"shards":         func(p *types.WorkflowParams) { p.Shards = -4 },
+		"idn mode":       func(p *types.WorkflowParams) { p.IDNMode = "punycode" },
+		"scheme":         func(p *types.WorkflowParams) { p.ZoneURI = "gs://zones/example.zone.gz" },
+		"output is zone": func(p *types.WorkflowParams) { p.OutputURI = p.ZoneURI },
+		"scratch subdir": func(p *types.WorkflowParams) { p.ScratchSubdir = "../other-run" },
+		"template":       func(p *types.WorkflowParams) { p.OutputURI = "s3://out/{{.Day}}/names.txt" },
+	} {
+		t.Run(name, func(t *testing.T) {
+			env := newEnv(t)
+			env.OnActivity("Activities.CheckUnchanged", mock.Anything, mock.Anything).
+				Return(types.UnchangedResult{Unchanged: true}, nil)
+			p := baseParams()
+			mut(&p)
+			env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+			var ae *temporal.ApplicationError
+			if err := env.GetWorkflowError(); !errors.As(err, &ae) || !ae.NonRetryable() || ae.Type() != types.ErrTypeInvalidParams {
+				t.Fatalf("want non-retryable %s, got %v", types.ErrTypeInvalidParams, err)
+			}
+			env.AssertActivityNumberOfCalls(t, "Activities.CheckUnchanged", 0)
+		})
+	}
+}
+
+// The SDK test environment resolves cancelled activities at once, whether or
+// not they stop, so this covers what the workflow does after cancellation
+// rather than WaitForCancellation.
+func TestWorkflowCancelCleansUp(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+	// The first dedupe to start cancels the run.
+	var cancelOnce sync.Once
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(
+		func(context.Context, types.ShardDedupeParams) (types.ShardStats, error) {
+			cancelOnce.Do(env.CancelWorkflow)
+			return types.ShardStats{}, temporal.NewCanceledError()
+		})
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, types.CleanupParams{ScratchSubdir: testWorkflowID}).
+		Return(nil).Once()
+	var event string
+	env.OnActivity("Activities.Notify", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { event = args.Get(1).(types.NotifyParams).Event }).Return(nil).Once()
+
+	p := baseParams()
+	p.Notify = &types.Notify{URL: "https://hooks.example/zone"}
+	env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+	if err := env.GetWorkflowError(); !temporal.IsCanceledError(err) {
+		t.Fatalf("want cancelled, got %v", err)
+	}
+	env.AssertExpectations(t)
+	if event != types.EventFailed {
+		t.Fatalf("notified %q", event)
+	}
+	v, err := env.QueryWorkflow(types.QueryProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pr types.Progress
+	if err := v.Get(&pr); err != nil || pr.Phase != types.PhaseCanceled {
+		t.Fatalf("progress %+v %v", pr, err)
+	}
+}
+
+func TestWorkflowMaxParallelDedupe(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	shards := types.PartitionResult{Records: 10}
+	for i := 0; i < 5; i++ {
+		shards.ShardURIs = append(shards.ShardURIs, fmt.Sprintf("file:///scratch/w/shard-%02d.txt", i))
+	}
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(shards, nil)
+	var mu sync.Mutex
+	var running, peak int
+	var queues []string
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, _ types.ShardDedupeParams) (types.ShardStats, error) {
+			mu.Lock()
+			running++
+			peak = max(peak, running)
+			queues = append(queues, activity.GetInfo(ctx).TaskQueue)
+			mu.Unlock()
+			time.Sleep(20 * time.Millisecond)
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return types.ShardStats{Total: 2, Unique: 2}, nil
+		}).Times(5)
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{Emitted: 10}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	p := baseParams()
+	p.MaxParallelDedupe = 2
+	env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	env.AssertExpectations(t)
+	if peak != 2 {
+		t.Fatalf("peak concurrent dedupes %d, want 2", peak)
+	}
+	for _, q := range queues {
+		if q != DedupeTaskQueue("default-test-taskqueue") {
+			t.Fatalf("dedupe scheduled on %q", q)
+		}
+	}
+}
+
+func TestWorkflowSplitsSkewedShards(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	part := partResult
+	part.ShardLines, part.ShardBytes = []uint64{1, 9}, []int64{10, 90}
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(part, nil)
+	env.OnActivity("Activities.SplitShard", mock.Anything, types.SplitShardParams{ShardURI: "file:///scratch/w/shard-01.txt", Parts: 3, Zone: "example"}).
+		Return(types.SplitShardResult{
+			ShardURIs:  []string{"file:///scratch/w/shard-01-00.txt", "file:///scratch/w/shard-01-01.txt", "file:///scratch/w/shard-01-02.txt"},
+			ShardLines: []uint64{3, 3, 3},
+			ShardBytes: []int64{30, 30, 30},
+		}, nil).Once()
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).
+		Return(types.ShardStats{Total: 2, Unique: 2}, nil).Times(4)
+	var got types.MergeParams
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { got = args.Get(1).(types.MergeParams) }).
+		Return(types.MergeStats{Emitted: 8}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	p := baseParams()
+	p.SplitShardBytes = 40
+	env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+	env.AssertExpectations(t)
+	// Sub-shards take the place of the shard they came from.
+	want := "file:///scratch/w/shard-00.txt.sorted,file:///scratch/w/shard-01-00.txt.sorted," +
+		"file:///scratch/w/shard-01-01.txt.sorted,file:///scratch/w/shard-01-02.txt.sorted"
+	if strings.Join(got.SortedShardURIs, ",") != want || len(got.ShardStats) != 4 || got.Shards != 2 || got.SplitShards != 1 {
+		t.Fatalf("merge params %+v", got)
+	}
+}
+
+// TestWorkflowBeforeUnchangedCheck replays a run started before the
+// unchanged check: it goes straight to partition.
+func TestWorkflowBeforeUnchangedCheck(t *testing.T) {
+	env := newEnv(t)
+	env.OnGetVersion(changeCheckUnchanged, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil)
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{Emitted: 1}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	env.ExecuteWorkflow(Zone2NamesWorkflow, baseParams())
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	env.AssertActivityNumberOfCalls(t, "Activities.CheckUnchanged", 0)
+}
+
+// TestWorkflowBeforeDedupeQueue replays a run started before the dedupe task
+// queue: its dedupes stay on the workflow's own queue.
+func TestWorkflowBeforeDedupeQueue(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	env.OnGetVersion(changeDedupeQueue, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+	var mu sync.Mutex
+	var queues []string
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(
+		func(ctx context.Context, _ types.ShardDedupeParams) (types.ShardStats, error) {
+			mu.Lock()
+			queues = append(queues, activity.GetInfo(ctx).TaskQueue)
+			mu.Unlock()
+			return types.ShardStats{}, nil
+		}).Times(2)
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{Emitted: 1}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	env.ExecuteWorkflow(Zone2NamesWorkflow, baseParams())
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	for _, q := range queues {
+		if q != "default-test-taskqueue" {
+			t.Fatalf("dedupe scheduled on %q", q)
+		}
+	}
+}
+
+// TestWorkflowBeforeSplits replays a run started before shard splitting: a
+// skewed shard is deduplicated whole.
+func TestWorkflowBeforeSplits(t *testing.T) {
+	env := newEnv(t)
+	mockChanged(env)
+	env.OnGetVersion(changeSplitShards, workflow.DefaultVersion, 1).Return(workflow.DefaultVersion)
+	part := partResult
+	part.ShardLines, part.ShardBytes = []uint64{1, 9}, []int64{10, 90}
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(part, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{}, nil).Times(2)
+	var got types.MergeParams
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) { got = args.Get(1).(types.MergeParams) }).
+		Return(types.MergeStats{Emitted: 1}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+
+	p := baseParams()
+	p.SplitShardBytes = 40
+	env.ExecuteWorkflow(Zone2NamesWorkflow, p)
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatalf("workflow err: %v", err)
+	}
+	env.AssertActivityNumberOfCalls(t, "Activities.SplitShard", 0)
+	if len(got.SortedShardURIs) != 2 || got.SplitShards != 0 {
+		t.Fatalf("merge params %+v", got)
+	}
+}
+
+func TestWorkflowTracing(t *testing.T) {
+	exp := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Install(sdktrace.NewSimpleSpanProcessor(exp), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shutdown(context.Background())
+	tracer, err := opentelemetry.NewTracingInterceptor(opentelemetry.TracerOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := newEnv(t)
+	env.SetWorkerOptions(worker.Options{Interceptors: []interceptor.WorkerInterceptor{tracer}})
+	mockChanged(env)
+	env.OnActivity("Activities.StreamPartition", mock.Anything, mock.Anything).Return(partResult, nil)
+	env.OnActivity("Activities.ShardDedupeBadger", mock.Anything, mock.Anything).Return(types.ShardStats{Total: 5, Unique: 4}, nil)
+	env.OnActivity("Activities.MergeSortedAndWriteManifest", mock.Anything, mock.Anything).Return(types.MergeStats{Emitted: 8}, nil)
+	env.OnActivity("Activities.CleanupScratch", mock.Anything, mock.Anything).Return(nil)
+	env.ExecuteWorkflow(Zone2NamesWorkflow, baseParams())
+	if err := env.GetWorkflowError(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := map[string]int{}
+	for _, s := range exp.GetSpans() {
+		names[s.Name]++
+	}
+	if names["RunWorkflow:Zone2NamesWorkflow"] != 1 || names["StartActivity:Activities.StreamPartition"] != 1 ||
+		names["StartActivity:Activities.ShardDedupeBadger"] != 2 {
+		t.Fatalf("spans %v", names)
+	}
+}
@@ -0,0 +1,251 @@
+// Package zonegen writes deterministic synthetic DNS zone files for tests.
+//
+// The same Config always produces byte-identical files, so outputs derived
+// from them can be compared against golden files.
+package zonegen
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Config describes the zone to generate.
+type Config struct {
+	Origin string // zone apex without trailing dot, e.g. "example"
+	Names  int    // distinct owner names below the apex
+	Seed   uint64
+	// Types maps RR type to relative weight; each name gets 1-3 types drawn
+	// from it. Defaults to a mix of A, AAAA, NS, CNAME, MX and TXT.
+	Types map[string]int
+	// IDNShare is the fraction of names whose first label is an IDN (written
+	// as an A-label, as zone files carry them).
+	IDNShare float64
+	// DupShare is the fraction of records written a second time, possibly in
+	// a different file and with the owner in upper case.
+	DupShare float64
+	// Includes splits the records over this many files pulled in with
+	// $INCLUDE from the main file; 0 writes a single file.
+	Includes int
+	// Gzip compresses the main file (included files stay plain, as the
+	// parser opens them directly).
+	Gzip bool
+}
+
+// Stats describes what was generated.
+type Stats struct {
+	Records int      // RR lines written, including the SOA and duplicates
+	Names   []string // distinct lowercase owner names, apex included, byte-sorted
+}
+
+var defaultTypes = map[string]int{"A": 40, "AAAA": 15, "NS": 20, "CNAME": 10, "MX": 10, "TXT": 5}
+
+// Runes used for IDN labels besides a-z.
+var idnRunes = []rune("äöüéèçñßøå")
+
+// Write generates the zone into dir and returns the path of the main file
+// ("<origin>.zone" or "<origin>.zone.gz").
+func Write(dir string, cfg Config) (string, Stats, error) {
+	g := &gen{cfg: cfg, rng: rand.New(rand.NewPCG(cfg.Seed, cfg.Seed^0x9e3779b97f4a7c15))}
+	if g.cfg.Types == nil {
+		g.cfg.Types = defaultTypes
+	}
+	lines, st := g.records()
+
+	files := max(cfg.Includes, 1)
+	chunks := make([][]string, files)
+	for i, l := range lines {
+		chunks[i%files] = append(chunks[i%files], l)
+	}
+
+	header := fmt.Sprintf("$ORIGIN %s.\n$TTL 3600\n@ IN SOA ns1.%s. hostmaster.%s. 1 7200 3600 1209600 3600\n", cfg.Origin, cfg.Origin, cfg.Origin)
+	main := filepath.Join(dir, cfg.Origin+".zone")
+	var body strings.Builder
+	body.WriteString(header)
+	if cfg.Includes == 0 {
+		body.WriteString(strings.Join(chunks[0], ""))
+	} else {
+		for i, chunk := range chunks {
+			name := fmt.Sprintf("%s.part-%d.zone", cfg.Origin, i)
+			inc := fmt.Sprintf("$ORIGIN %s.\n", cfg.Origin) + strings.Join(chunk, "")
+			if err := os.WriteFile(filepath.Join(dir, name), []byte(inc), 0o644); err != nil {
+				return "", Stats{}, err
+			}
+			fmt.Fprintf(&body, "$INCLUDE %s %s.\n", name, cfg.Origin)
+		}
+	}
+
+	if cfg.Gzip {
+		main += ".gz"
+	}
+	f, err := os.Create(main)
+	if err != nil {
+		return "", Stats{}, err
+	}
+	defer f.Close()
+	var w io.Writer = f
+	var zw *gzip.Writer
+	if cfg.Gzip {
+		zw = gzip.NewWriter(f) // zero ModTime keeps the header deterministic
+		w = zw
+	}
+	bw := bufio.NewWriter(w)
+	if _, err := bw.WriteString(body.String()); err != nil {
+		return "", Stats{}, err
+	}
+	if err := bw.Flush(); err != nil {
+		return "", Stats{}, err
+	}
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			return "", Stats{}, err
+		}
+	}
+	return main, st, f.Close()
+}
+
+type gen struct {
+	cfg Config
+	rng *rand.Rand
+}
+
+// records returns RR lines (without the SOA) and stats.
+func (g *gen) records() ([]string, Stats) {
+	seen := map[string]bool{g.cfg.Origin: true}
+	var lines []string
+	// A couple of apex records so "@" is exercised.
+	lines = append(lines, "@ IN NS ns1\n", "@ IN NS ns2\n")
+	for len(seen) < g.cfg.Names+1 {
+		rel := g.name()
+		full := rel + "." + g.cfg.Origin
+		if seen[full] {
+			continue
+		}
+		seen[full] = true
+		for _, t := range g.types() {
+			lines = append(lines, fmt.Sprintf("%s %d IN %s %s\n", rel, 300+g.rng.IntN(3000), t, g.rdata(t)))
+		}
+	}
+	if g.cfg.DupShare > 0 {
+		// Interleave copies of random records, some with an upper-case owner.
+		withDups := make([]string, 0, len(lines)+int(float64(len(lines))*g.cfg.DupShare)+1)
+		for _, l := range lines {
+			withDups = append(withDups, l)
+			if g.rng.Float64() >= g.cfg.DupShare {
+				continue
+			}
+			d := lines[g.rng.IntN(len(lines))]
+			if !strings.HasPrefix(d, "@") && g.rng.IntN(2) == 0 {
+				owner, rest, _ := strings.Cut(d, " ")
+				d = strings.ToUpper(owner) + " " + rest
+			}
+			withDups = append(withDups, d)
+		}
+		lines = withDups
+	}
+
+	names := make([]string, 0, len(seen))
+	for n := range seen {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return lines, Stats{Records: len(lines) + 1, Names: names}
+}
+
+// name returns a relative owner name of one to three labels.
+func (g *gen) name() string {
+	var first string
+	if g.rng.Float64() < g.cfg.IDNShare {
+		first = g.idnLabel()
+	} else {
+		first = g.label()
+	}
+	switch g.rng.IntN(10) {
+	case 0:
+		return g.label() + "." + g.label() + "." + first
+	case 1, 2:
+		return []string{"www", "mail", "api", "cdn"}[g.rng.IntN(4)] + "." + first
+	default:
+		return first
+	}
+}
+
+func (g *gen) label() string {
+	const alnum = "abcdefghijklmnopqrstuvwxyz0123456789"
+	n := 3 + g.rng.IntN(10)
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alnum[g.rng.IntN(len(alnum))]
+		if i > 0 && i < n-1 && g.rng.IntN(12) == 0 {
+			b[i] = '-'
+		}
+	}
+	return string(b)
+}
+
+func (g *gen) idnLabel() string {
+	for {
+		rs := []rune(g.label())
+		rs = slices.DeleteFunc(rs, func(r rune) bool { return r == '-' })
+		for range 1 + g.rng.IntN(2) {
+			rs[g.rng.IntN(len(rs))] = idnRunes[g.rng.IntN(len(idnRunes))]
+		}
+		if a, err := idna.ToASCII(string(rs)); err == nil && strings.HasPrefix(a, "xn--") {
+			return a
+		}
+	}
+}
+
+// types draws 1-3 distinct RR types by weight, in a stable order.
+func (g *gen) types() []string {
+	keys := make([]string, 0, len(g.cfg.Types))
+	total := 0
+	for k, w := range g.cfg.Types {
+		keys = append(keys, k)
+		total += w
+	}
+	slices.Sort(keys) // map order is random; the draw must not be
+	n := 1 + g.rng.IntN(3)
+	var out []string
+	for range n {
+		r := g.rng.IntN(total)
+		for _, k := range keys {
+			if r -= g.cfg.Types[k]; r < 0 {
+				if !slices.Contains(out, k) {
+					out = append(out, k)
+				}
+				break
+			}
+		}
+	}
+	return out
+}
+
+func (g *gen) rdata(t string) string {
+	switch t {
+	case "A":
+		return fmt.Sprintf("192.0.2.%d", g.rng.IntN(256))
+	case "AAAA":
+		return fmt.Sprintf("2001:db8::%x", g.rng.IntN(1<<16))
+	case "NS":
+		return fmt.Sprintf("ns%d.%s.", 1+g.rng.IntN(2), g.cfg.Origin)
+	case "CNAME":
+		return "www." + g.cfg.Origin + "."
+	case "MX":
+		return fmt.Sprintf("%d mx.%s.", 10*(1+g.rng.IntN(3)), g.cfg.Origin)
+	case "TXT":
+		return fmt.Sprintf(`"v=synthetic %d"`, g.rng.IntN(1000))
+	case "SRV":
+		return fmt.Sprintf("10 5 %d sip.%s.", 5060+g.rng.IntN(10), g.cfg.Origin)
+	default:
+		return `\# 0`
+	}
+}
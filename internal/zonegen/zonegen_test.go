@@ -0,0 +1,83 @@
+package zonegen
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func parse(t *testing.T, path string) (records int, names []string) {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gr, err := gzip.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = gr
+	}
+	zp := dns.NewZoneParser(r, "", path)
+	zp.SetIncludeAllowed(true)
+	seen := map[string]bool{}
+	for rr, ok := zp.Next(); ok; rr, ok = zp.Next() {
+		records++
+		seen[strings.ToLower(strings.TrimSuffix(rr.Header().Name, "."))] = true
+	}
+	if err := zp.Err(); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for n := range seen {
+		names = append(names, n)
+	}
+	slices.Sort(names)
+	return records, names
+}
+
+func TestWriteParsesBack(t *testing.T) {
+	for _, cfg := range []Config{
+		{Origin: "test", Names: 300, Seed: 1, IDNShare: 0.2, DupShare: 0.3},
+		{Origin: "test", Names: 300, Seed: 2, Includes: 3, Gzip: true},
+	} {
+		path, st, err := Write(t.TempDir(), cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, names := parse(t, path)
+		if records != st.Records {
+			t.Fatalf("records %d, stats say %d", records, st.Records)
+		}
+		if len(names) != cfg.Names+1 || !slices.Equal(names, st.Names) {
+			t.Fatalf("names differ from stats (%d vs %d)", len(names), len(st.Names))
+		}
+	}
+}
+
+func TestWriteDeterministic(t *testing.T) {
+	cfg := Config{Origin: "test", Names: 200, Seed: 7, IDNShare: 0.1, DupShare: 0.2, Includes: 2}
+	a, b := t.TempDir(), t.TempDir()
+	if _, _, err := Write(a, cfg); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Write(b, cfg); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"test.zone", "test.part-0.zone", "test.part-1.zone"} {
+		x, _ := os.ReadFile(filepath.Join(a, f))
+		y, _ := os.ReadFile(filepath.Join(b, f))
+		if len(x) == 0 || !bytes.Equal(x, y) {
+			t.Fatalf("%s differs between runs", f)
+		}
+	}
+}